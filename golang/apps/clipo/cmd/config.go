@@ -1,11 +1,32 @@
 package cmd
 
 import (
+	"os"
+	"strings"
+
 	"github.com/rs/zerolog/log"
 
+	"github.com/mmrath/gobase/golang/apps/clipo/internal/account"
 	"github.com/mmrath/gobase/golang/apps/clipo/internal/config"
+	"github.com/mmrath/gobase/golang/pkg/auth"
+	pkgconfig "github.com/mmrath/gobase/golang/pkg/config"
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+	"github.com/mmrath/gobase/golang/pkg/logutil"
 )
 
+// ConfigOptions select the configuration files loaded by LoadConfig. Paths are
+// relative to the golang directory, which the app is run from.
+var ConfigOptions = pkgconfig.OptionsFromEnv("./apps/clipo/resources/config")
+
+// Run runs the subcommand in args. The only one is "config print", which prints
+// the effective configuration with the source of every value.
+func Run(args []string) error {
+	if len(args) != 2 || args[0] != "config" || args[1] != "print" {
+		return errutil.Errorf("unknown command %q, expected \"config print\"", strings.Join(args, " "))
+	}
+	return pkgconfig.Print(os.Stdout, &config.Config{}, ConfigOptions)
+}
+
 func LoadConfig() config.Config {
 	cfg := config.Config{
 		Web: config.WebConfig{
@@ -13,12 +34,27 @@ func LoadConfig() config.Config {
 		},
 	}
 
-	err := config.LoadConfig(&cfg)
+	err := config.LoadConfig(&cfg, ConfigOptions)
 	if err != nil {
 		panic(err)
 	}
+	logutil.SetGlobalLevel(cfg.LogLevel)
 
+	// Secrets are masked when marshalled, so the config can be logged as a whole.
 	log.Info().Interface("conf", cfg).Msg("config loaded successfully")
 
 	return cfg
 }
+
+// NewConfigWatcher returns a watcher applying reloaded settings to the components.
+func NewConfigWatcher(cfg *config.Config, jwtService auth.JWTService, origins *CorsOrigins, notifier account.Notifier) *pkgconfig.Watcher {
+	watcher := pkgconfig.NewWatcher(cfg, ConfigOptions)
+	watcher.Subscribe(func(c interface{}) {
+		cfg := c.(*config.Config)
+		logutil.SetGlobalLevel(cfg.LogLevel)
+		jwtService.SetValidity(cfg.JWT)
+		origins.Set(*cfg)
+		notifier.SetFrom(cfg.SMTP.From)
+	})
+	return watcher
+}
@@ -4,7 +4,11 @@ package cmd
 import (
 	"compress/flate"
 	"github.com/mmrath/gobase/golang/pkg/health"
+	"github.com/mmrath/gobase/golang/pkg/metrics"
+	"github.com/mmrath/gobase/golang/pkg/tracing"
 	"net/http"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/mmrath/gobase/golang/apps/clipo/internal/config"
@@ -19,10 +23,18 @@ import (
 )
 
 // NewMux configures application resources and routes.
-func NewMux(cfg config.Config, userHandler *account.Handler, jwtService auth.JWTService) (*chi.Mux, error) {
+func NewMux(
+	cfg config.Config,
+	userHandler *account.Handler,
+	jwtService auth.JWTService,
+	origins *CorsOrigins,
+	healthService health.Service,
+) (*chi.Mux, error) {
 
 	r := chi.NewRouter()
 
+	r.Use(tracing.Middleware)
+	r.Use(metrics.Middleware)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
@@ -32,9 +44,15 @@ func NewMux(cfg config.Config, userHandler *account.Handler, jwtService auth.JWT
 
 	// use CORS middleware if client is not served by this api, e.g. from other domain or CDN
 	if cfg.Web.CorsEnabled {
-		r.Use(corsConfig(cfg).Handler)
+		r.Use(corsConfig(origins).Handler)
 	}
 
+	// liveness and readiness probes
+	healthService.RegisterRoutes(r)
+
+	// public keys for verifying access tokens, consumed by other services
+	r.Get("/.well-known/jwks.json", jwtService.JWKSHandler())
+
 	r.Route("/clipo/api", func(r chi.Router) {
 		// Protected routes
 		r.Group(func(r chi.Router) {
@@ -45,6 +63,11 @@ func NewMux(cfg config.Config, userHandler *account.Handler, jwtService auth.JWT
 			r.Get("/account", userHandler.Account())
 			r.Get("/account/profile", userHandler.GetProfile())
 			r.Post("/account/profile", userHandler.UpdateProfile())
+			r.Get("/account/mfa", userHandler.GetMFAStatus())
+			r.Post("/account/mfa/totp/enroll", userHandler.EnrollTOTP())
+			r.Post("/account/mfa/totp/confirm", userHandler.ConfirmTOTP())
+			r.Post("/account/mfa/totp/disable", userHandler.DisableTOTP())
+			r.Post("/account/mfa/recovery-codes", userHandler.RegenerateRecoveryCodes())
 		})
 
 		// Public routes
@@ -52,8 +75,12 @@ func NewMux(cfg config.Config, userHandler *account.Handler, jwtService auth.JWT
 			r.Route("/account", func(r chi.Router) {
 				r.Get("/activate", userHandler.Activate())
 				r.Post("/register", userHandler.Register())
-				r.Post("/login", userHandler.Login(jwtService))
-				r.Post("/logout", userHandler.Logout())
+				r.Post("/login", userHandler.Login())
+				r.Post("/login/mfa", userHandler.LoginMFA())
+				r.Post("/login/magic", userHandler.InitMagicLogin())
+				r.Post("/login/magic/verify", userHandler.LoginMagic())
+				r.Post("/logout", userHandler.Logout(jwtService))
+				r.Post("/token/refresh", userHandler.RefreshToken())
 				r.Post("/reset-password/init", userHandler.InitPasswordReset())
 				r.Post("/reset-password/finish", userHandler.ResetPassword())
 			})
@@ -65,10 +92,38 @@ func NewMux(cfg config.Config, userHandler *account.Handler, jwtService auth.JWT
 	return r, nil
 }
 
-func corsConfig(cfg config.Config) *cors.Cors {
+// CorsOrigins are the origins allowed by CORS, which can change while serving.
+type CorsOrigins struct {
+	origins atomic.Value
+}
+
+func NewCorsOrigins(cfg config.Config) *CorsOrigins {
+	o := &CorsOrigins{}
+	o.Set(cfg)
+	return o
+}
+
+// Set allows the origins of cfg, or the AppDomainName if there are none.
+func (o *CorsOrigins) Set(cfg config.Config) {
+	origins := cfg.Web.CorsOrigins
+	if len(origins) == 0 {
+		origins = []string{cfg.AppDomainName}
+	}
+	o.origins.Store(origins)
+}
+
+func (o *CorsOrigins) allow(r *http.Request, origin string) bool {
+	for _, allowed := range o.origins.Load().([]string) {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func corsConfig(origins *CorsOrigins) *cors.Cors {
 	return cors.New(cors.Options{
-		AllowedOrigins: []string{cfg.AppDomainName},
-		// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
+		AllowOriginFunc:  origins.allow,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
 		ExposedHeaders:   []string{"Link"},
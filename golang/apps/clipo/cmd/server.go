@@ -3,69 +3,73 @@ package cmd
 import (
 	"context"
 	"net/http"
-	"os"
-	"os/signal"
-	"strings"
 
 	"github.com/mmrath/gobase/golang/apps/clipo/internal/config"
 	"github.com/mmrath/gobase/golang/apps/clipo/internal/templateutil"
+	pkgconfig "github.com/mmrath/gobase/golang/pkg/config"
 	"github.com/mmrath/gobase/golang/pkg/db"
-
-	"github.com/rs/zerolog/log"
+	"github.com/mmrath/gobase/golang/pkg/health"
+	"github.com/mmrath/gobase/golang/pkg/metrics"
+	"github.com/mmrath/gobase/golang/pkg/model"
+	"github.com/mmrath/gobase/golang/pkg/server"
+	"github.com/mmrath/gobase/golang/pkg/tracing"
 
 	"github.com/mmrath/gobase/golang/apps/clipo/internal/account"
 	"github.com/mmrath/gobase/golang/pkg/email"
 )
 
-// App provides an http.App.
+// App serves the application routes.
 type App struct {
-	*http.Server
+	Handler http.Handler
+	server  *server.Server
 }
 
 func NewDB(cfg config.Config) (*db.DB, error) {
-	return db.Open(cfg.DB)
+	database, err := db.Open(cfg.DB)
+	if err != nil {
+		return nil, err
+	}
+	metrics.MustReplace(database.StatsCollector())
+	return database, nil
 }
 
-func NewNotifier(cfg config.Config, mailer email.Mailer, registry *templateutil.Registry) account.Notifier {
-	return account.NewNotifier(cfg.AppDomainName, mailer, registry)
+// NewHealthService checks the database, its schema version and the mail server.
+func NewHealthService(cfg config.Config, database *db.DB) health.Service {
+	return health.NewService(cfg.Health,
+		health.NewDBChecker(database),
+		health.NewMigrationChecker(database, model.SchemaVersion),
+		health.NewSMTPChecker(cfg.SMTP),
+	)
 }
 
-// NewApp creates and configures an APIServer serving all application routes.
-func NewApp(cfg config.Config, mux http.Handler) (*App, error) {
-	var addr string
-	port := cfg.Web.Port
-
-	if strings.Contains(port, ":") {
-		addr = port
-	} else {
-		addr = ":" + port
-	}
+func NewNotifier(cfg config.Config, mailer email.Mailer, registry *templateutil.Registry) account.Notifier {
+	return account.NewNotifier(cfg.AppDomainName, cfg.SMTP.From, mailer, registry)
+}
 
-	srv := http.Server{
-		Addr:    addr,
-		Handler: mux,
+// NewApp creates and configures a server serving all application routes, which
+// runs the config watcher and the metrics server and closes the database and
+// flushes the traces when it shuts down.
+func NewApp(cfg config.Config, mux http.Handler, watcher *pkgconfig.Watcher, database *db.DB, healthService health.Service) (*App, error) {
+	shutdownTracing, err := tracing.Setup("clipo", cfg.Tracing)
+	if err != nil {
+		return nil, err
 	}
 
-	return &App{&srv}, nil
+	srv := server.New(cfg.Web.Port, mux, cfg.Web.Server)
+	// hooks run in reverse order, so spans of the other hooks are flushed too
+	srv.OnShutdown("tracing", shutdownTracing)
+	healthService.SetReadiness(srv.Ready)
+	srv.Go(watcher.Run)
+	srv.Go(func(ctx context.Context) {
+		metrics.Serve(ctx, cfg.Metrics)
+	})
+	srv.OnShutdown("db", func(ctx context.Context) error {
+		return database.Close()
+	})
+	return &App{Handler: mux, server: srv}, nil
 }
 
-// Start runs ListenAndServe on the http.App with graceful shutdown.
-func (srv *App) Start() {
-	log.Print("starting server...")
-	go func() {
-		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
-			panic(err)
-		}
-	}()
-	log.Printf("listening on %s\n", srv.Addr)
-
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
-	sig := <-quit
-	log.Print("shutting down server... reason:", sig)
-
-	if err := srv.Shutdown(context.Background()); err != nil {
-		panic(err)
-	}
-	log.Print("server gracefully stopped")
+// Run serves until the process receives SIGINT or SIGTERM and then shuts down gracefully.
+func (app *App) Run() error {
+	return app.server.Run(context.Background())
 }
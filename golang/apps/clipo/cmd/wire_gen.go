@@ -25,17 +25,20 @@ func BuildApp() (*App, error) {
 	if err != nil {
 		return nil, errutil.Wrapf(err, "unable to create db connection")
 	}
-	service := account.NewService(notifier, db)
-	handler := account.NewHandler(service)
-	jwtService, err := auth.NewJWTService(config2.JWT)
+	jwtService, err := auth.NewJWTService(config2.JWT, account.NewRevocationChecker(db))
 	if err != nil {
 		return nil, errutil.Wrapf(err, "unable to create JWT service")
 	}
-	mux, err := NewMux(config2, handler, jwtService)
+	service := account.NewService(notifier, db, jwtService, config2.MFA.Issuer)
+	handler := account.NewHandler(service)
+	corsOrigins := NewCorsOrigins(config2)
+	healthService := NewHealthService(config2, db)
+	mux, err := NewMux(config2, handler, jwtService, corsOrigins, healthService)
 	if err != nil {
 		return nil, errutil.Wrapf(err, "unable to create http router")
 	}
-	server, err := NewApp(config2, mux)
+	watcher := NewConfigWatcher(&config2, jwtService, corsOrigins, notifier)
+	server, err := NewApp(config2, mux, watcher, db, healthService)
 	if err != nil {
 		return nil, errutil.Wrapf(err, "unable to create server")
 	}
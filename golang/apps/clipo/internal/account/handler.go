@@ -3,9 +3,11 @@ package account
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/mmrath/gobase/golang/pkg/errutil"
 
+	"github.com/dgrijalva/jwt-go"
 	"github.com/go-chi/jwtauth"
 	"github.com/go-chi/render"
 	"github.com/rs/zerolog/log"
@@ -15,16 +17,51 @@ import (
 )
 
 var AuthTokenCookieName = "jwt"
+var RefreshTokenCookieName = "refresh_token"
+
+// refreshTokenCookiePath limits the refresh token cookie to the endpoints which consume it.
+var refreshTokenCookiePath = "/clipo/api/account"
 
 type Handler struct {
 	service *Service
 }
 
+type TokenResponse struct {
+	AccessToken           string    `json:"accessToken"`
+	AccessTokenExpiresAt  time.Time `json:"accessTokenExpiresAt"`
+	RefreshToken          string    `json:"refreshToken"`
+	RefreshTokenExpiresAt time.Time `json:"refreshTokenExpiresAt"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// MFAChallengeResponse is returned by login instead of the tokens when the user has a second factor enabled.
+type MFAChallengeResponse struct {
+	MFARequired       bool      `json:"mfaRequired"`
+	MFAToken          string    `json:"mfaToken"`
+	MFATokenExpiresAt time.Time `json:"mfaTokenExpiresAt"`
+}
+
+type MFALoginRequest struct {
+	MFAToken string `json:"mfaToken"`
+	Code     string `json:"code"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
 func NewHandler(userService *Service) *Handler {
 	return &Handler{service: userService}
 }
 
-func (h *Handler) Login(service auth.JWTService) http.HandlerFunc {
+func (h *Handler) Login() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		data := model.LoginRequest{}
@@ -39,41 +76,303 @@ func (h *Handler) Login(service auth.JWTService) http.HandlerFunc {
 			return
 		}
 
-		var token string
-		token, err = service.NewToken(&user)
+		h.completeLogin(w, r, user)
+	}
+}
+
+// InitMagicLogin emails a login link and code to the user.
+func (h *Handler) InitMagicLogin() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := MagicLoginRequest{}
+		if err := render.DecodeJSON(r.Body, &data); err != nil {
+			errutil.RenderError(w, r, errutil.NewBadRequest("invalid magic login request"))
+			return
+		}
 
+		err := h.service.InitiateMagicLogin(r.Context(), data)
 		if err != nil {
 			errutil.RenderError(w, r, err)
 			return
 		}
 
-		http.SetCookie(w, &http.Cookie{
-			Name:       AuthTokenCookieName,
-			Value:      token,
-			Path:       "/",
-			RawExpires: "0",
-			HttpOnly:   true,
+		render.Status(r, http.StatusOK)
+		render.JSON(w, r, nil)
+	}
+}
+
+// LoginMagic logs in with the key of a login link or an emailed code.
+func (h *Handler) LoginMagic() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := MagicLoginVerifyRequest{}
+		if err := render.DecodeJSON(r.Body, &data); err != nil {
+			errutil.RenderError(w, r, errutil.NewBadRequest("invalid magic login request"))
+			return
+		}
+
+		user, err := h.service.LoginWithMagicLink(r.Context(), data)
+		if err != nil {
+			errutil.RenderError(w, r, err)
+			return
+		}
+
+		h.completeLogin(w, r, user)
+	}
+}
+
+// completeLogin asks for the second factor if the user has one enabled, or
+// starts the session otherwise.
+func (h *Handler) completeLogin(w http.ResponseWriter, r *http.Request, user model.User) {
+	challenge, err := h.service.MFAChallenge(r.Context(), user)
+	if err != nil {
+		errutil.RenderError(w, r, err)
+		return
+	}
+	if challenge != nil {
+		render.Status(r, http.StatusOK)
+		render.JSON(w, r, MFAChallengeResponse{
+			MFARequired:       true,
+			MFAToken:          challenge.Value,
+			MFATokenExpiresAt: challenge.ExpiresAt,
 		})
+		return
+	}
 
-		w.Header().Add("Authorization", fmt.Sprintf("Bearer %s", token))
-		w.WriteHeader(http.StatusOK)
+	session, err := h.service.NewSession(r.Context(), user)
+
+	if err != nil {
+		errutil.RenderError(w, r, err)
+		return
 	}
+
+	writeSession(w, r, session)
 }
 
-func (h *Handler) Logout() http.HandlerFunc {
+// LoginMFA is the second login step for users with two-factor authentication enabled.
+func (h *Handler) LoginMFA() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		http.SetCookie(w, &http.Cookie{
-			Name:       AuthTokenCookieName,
-			Value:      "",
-			Path:       "/",
-			RawExpires: "0",
-			MaxAge:     -1, // Delete
-			HttpOnly:   true,
-		})
+		data := MFALoginRequest{}
+		if err := render.DecodeJSON(r.Body, &data); err != nil {
+			errutil.RenderError(w, r, errutil.NewBadRequest("invalid mfa login request"))
+			return
+		}
+
+		user, err := h.service.LoginWithMFA(r.Context(), data.MFAToken, data.Code)
+		if err != nil {
+			errutil.RenderError(w, r, err)
+			return
+		}
+
+		session, err := h.service.NewSession(r.Context(), user)
+		if err != nil {
+			errutil.RenderError(w, r, err)
+			return
+		}
+
+		writeSession(w, r, session)
+	}
+}
+
+func (h *Handler) GetMFAStatus() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status, err := h.service.GetMFAStatus(r.Context())
+		if err != nil {
+			errutil.RenderError(w, r, err)
+			return
+		}
+		render.Status(r, http.StatusOK)
+		render.JSON(w, r, status)
+	}
+}
+
+func (h *Handler) EnrollTOTP() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		enrollment, err := h.service.EnrollTOTP(r.Context())
+		if err != nil {
+			errutil.RenderError(w, r, err)
+			return
+		}
 		render.Status(r, http.StatusOK)
+		render.JSON(w, r, enrollment)
 	}
 }
 
+func (h *Handler) ConfirmTOTP() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := MFACodeRequest{}
+		if err := render.DecodeJSON(r.Body, &data); err != nil {
+			errutil.RenderError(w, r, errutil.NewBadRequest("invalid request"))
+			return
+		}
+
+		codes, err := h.service.ConfirmTOTP(r.Context(), data.Code)
+		if err != nil {
+			errutil.RenderError(w, r, err)
+			return
+		}
+		render.Status(r, http.StatusOK)
+		render.JSON(w, r, RecoveryCodesResponse{RecoveryCodes: codes})
+	}
+}
+
+func (h *Handler) DisableTOTP() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := MFACodeRequest{}
+		if err := render.DecodeJSON(r.Body, &data); err != nil {
+			errutil.RenderError(w, r, errutil.NewBadRequest("invalid request"))
+			return
+		}
+
+		if err := h.service.DisableTOTP(r.Context(), data.Code); err != nil {
+			errutil.RenderError(w, r, err)
+			return
+		}
+		render.Status(r, http.StatusOK)
+		render.JSON(w, r, struct{}{})
+	}
+}
+
+func (h *Handler) RegenerateRecoveryCodes() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := MFACodeRequest{}
+		if err := render.DecodeJSON(r.Body, &data); err != nil {
+			errutil.RenderError(w, r, errutil.NewBadRequest("invalid request"))
+			return
+		}
+
+		codes, err := h.service.RegenerateRecoveryCodes(r.Context(), data.Code)
+		if err != nil {
+			errutil.RenderError(w, r, err)
+			return
+		}
+		render.Status(r, http.StatusOK)
+		render.JSON(w, r, RecoveryCodesResponse{RecoveryCodes: codes})
+	}
+}
+
+func (h *Handler) RefreshToken() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		refreshToken, err := refreshTokenFromRequest(r)
+		if err != nil {
+			errutil.RenderError(w, r, err)
+			return
+		}
+
+		if refreshToken == "" {
+			errutil.RenderError(w, r, errutil.NewUnauthorized("refresh token is required"))
+			return
+		}
+
+		session, err := h.service.RefreshSession(r.Context(), refreshToken)
+
+		if err != nil {
+			clearSessionCookies(w)
+			errutil.RenderError(w, r, err)
+			return
+		}
+
+		writeSession(w, r, session)
+	}
+}
+
+func (h *Handler) Logout(jwtService auth.JWTService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		refreshToken, err := refreshTokenFromRequest(r)
+		if err != nil {
+			errutil.RenderError(w, r, err)
+			return
+		}
+
+		if refreshToken != "" {
+			err = h.service.RevokeSession(r.Context(), refreshToken)
+		} else if accessToken := accessTokenFromRequest(r); accessToken != "" {
+			// clients without the refresh token cookie can still log out with a valid access token
+			if token, decodeErr := jwtService.Decode(accessToken); decodeErr == nil {
+				claims, _ := token.Claims.(jwt.MapClaims)
+				tokenID, _ := claims["jti"].(string)
+				err = h.service.RevokeSessionByTokenID(r.Context(), tokenID)
+			}
+		}
+
+		if err != nil {
+			errutil.RenderError(w, r, err)
+			return
+		}
+
+		clearSessionCookies(w)
+		render.Status(r, http.StatusOK)
+	}
+}
+
+// accessTokenFromRequest returns the access token of the Authorization header or,
+// like the authenticator, the jwt cookie.
+func accessTokenFromRequest(r *http.Request) string {
+	if token := jwtauth.TokenFromHeader(r); token != "" {
+		return token
+	}
+	return jwtauth.TokenFromCookie(r)
+}
+
+func refreshTokenFromRequest(r *http.Request) (string, error) {
+	if c, err := r.Cookie(RefreshTokenCookieName); err == nil && c.Value != "" {
+		return c.Value, nil
+	}
+
+	if r.ContentLength == 0 {
+		return "", nil
+	}
+
+	data := RefreshTokenRequest{}
+	if err := render.DecodeJSON(r.Body, &data); err != nil {
+		return "", errutil.NewBadRequest("invalid refresh token request")
+	}
+	return data.RefreshToken, nil
+}
+
+func writeSession(w http.ResponseWriter, r *http.Request, session Session) {
+	http.SetCookie(w, &http.Cookie{
+		Name:       AuthTokenCookieName,
+		Value:      session.AccessToken.Value,
+		Path:       "/",
+		RawExpires: "0",
+		HttpOnly:   true,
+	})
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     RefreshTokenCookieName,
+		Value:    session.RefreshToken.Value,
+		Path:     refreshTokenCookiePath,
+		Expires:  session.RefreshToken.ExpiresAt,
+		HttpOnly: true,
+	})
+
+	w.Header().Add("Authorization", fmt.Sprintf("Bearer %s", session.AccessToken.Value))
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, TokenResponse{
+		AccessToken:           session.AccessToken.Value,
+		AccessTokenExpiresAt:  session.AccessToken.ExpiresAt,
+		RefreshToken:          session.RefreshToken.Value,
+		RefreshTokenExpiresAt: session.RefreshToken.ExpiresAt,
+	})
+}
+
+func clearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:       AuthTokenCookieName,
+		Value:      "",
+		Path:       "/",
+		RawExpires: "0",
+		MaxAge:     -1, // Delete
+		HttpOnly:   true,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     RefreshTokenCookieName,
+		Value:    "",
+		Path:     refreshTokenCookiePath,
+		MaxAge:   -1, // Delete
+		HttpOnly: true,
+	})
+}
+
 func (h *Handler) Register() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
@@ -84,7 +383,7 @@ func (h *Handler) Register() http.HandlerFunc {
 			return
 		}
 
-		user, err := h.service.Register(data)
+		user, err := h.service.Register(r.Context(), data)
 
 		if err != nil {
 			log.Error().Err(err).Msg("error during sign up")
@@ -100,7 +399,7 @@ func (h *Handler) Register() http.HandlerFunc {
 func (h *Handler) Activate() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		key := r.URL.Query().Get("key")
-		err := h.service.Activate(key)
+		err := h.service.Activate(r.Context(), key)
 		if err != nil {
 			errutil.RenderError(w, r, err)
 			return
@@ -152,7 +451,7 @@ func (h *Handler) InitPasswordReset() http.HandlerFunc {
 			return
 		}
 
-		err := h.service.InitiatePasswordReset(data.Email)
+		err := h.service.InitiatePasswordReset(r.Context(), data.Email)
 
 		if err != nil {
 			log.Error().Err(err).Msg("defaultError initiating password reset")
@@ -174,7 +473,7 @@ func (h *Handler) ResetPassword() http.HandlerFunc {
 			return
 		}
 
-		err := h.service.ResetPassword(data)
+		err := h.service.ResetPassword(r.Context(), data)
 
 		if err != nil {
 			log.Error().Err(err).Msg("error initiating password reset")
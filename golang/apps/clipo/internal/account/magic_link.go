@@ -0,0 +1,242 @@
+package account
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/mmrath/gobase/golang/pkg/crypto"
+	"github.com/mmrath/gobase/golang/pkg/db"
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+	"github.com/mmrath/gobase/golang/pkg/model"
+	"github.com/mmrath/gobase/golang/pkg/validate"
+)
+
+const (
+	// loginKeyValidity is how long an emailed login link or code can be used.
+	loginKeyValidity = 15 * time.Minute
+	// maxLoginCodeAttempts limits guessing of the short login code.
+	maxLoginCodeAttempts = 5
+
+	loginCodeDigits = 6
+)
+
+const invalidLoginKeyMsg = "login link or code is invalid or expired"
+
+type MagicLoginRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// MagicLoginVerifyRequest carries either the key of an emailed link or the
+// email address together with the emailed code.
+type MagicLoginVerifyRequest struct {
+	Key   string `json:"key"`
+	Email string `json:"email"`
+	Code  string `json:"code"`
+}
+
+// InitiateMagicLogin emails a single use login link and code to the user. Unknown
+// or inactive email addresses are not reported, so the endpoint cannot be used to
+// find out which addresses have an account.
+func (s *Service) InitiateMagicLogin(ctx context.Context, request MagicLoginRequest) error {
+	err := validate.Struct(request)
+	if err != nil {
+		return err
+	}
+
+	loginKey, err := generateLoginKey()
+	if err != nil {
+		return err
+	}
+	loginCode, err := generateLoginCode()
+	if err != nil {
+		return err
+	}
+	loginKeyHash, err := crypto.SHA256([]byte(loginKey))
+	if err != nil {
+		return errutil.Wrap(err, "failed to hash login key")
+	}
+	loginCodeHash, err := crypto.SHA256([]byte(loginCode))
+	if err != nil {
+		return errutil.Wrap(err, "failed to hash login code")
+	}
+	expiresAt := time.Now().Add(loginKeyValidity)
+
+	var user model.User
+	var found bool
+	err = s.db.RunInTx(ctx, func(tx *db.Tx) error {
+		user, found, err = s.initiateMagicLoginTx(tx, request.Email, loginKeyHash, loginCodeHash, expiresAt)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		log.Info().Str("email", request.Email).Msg("magic login requested for unknown or inactive user")
+		return nil
+	}
+
+	err = s.notifier.NotifyLoginLink(ctx, user, loginKey, loginCode, loginKeyValidity)
+	if err != nil {
+		// failing only for existing users would reveal that they have an account
+		log.Error().Err(err).Int64("id", user.ID).Msg("failed to send login link email")
+	}
+	return nil
+}
+
+func (s *Service) initiateMagicLoginTx(tx *db.Tx, email, loginKeyHash, loginCodeHash string, expiresAt time.Time) (model.User, bool, error) {
+	user, err := s.userDao.FindByEmail(tx, email)
+	if err != nil {
+		if db.IsNoDataFound(err) {
+			return user, false, nil
+		}
+		return user, false, errutil.Wrap(err, "failed to find user by email")
+	}
+	if !user.Active {
+		return user, false, nil
+	}
+
+	uc, err := s.userCredentialDao.Get(tx, user.ID)
+	if err != nil {
+		if db.IsNoDataFound(err) {
+			cred := model.UserCredential{
+				ID:                user.ID,
+				LoginKey:          loginKeyHash,
+				LoginCode:         loginCodeHash,
+				LoginKeyExpiresAt: expiresAt,
+			}
+			err = s.userCredentialDao.Insert(tx, &cred)
+			return user, true, errutil.Wrap(err, "failed to insert credentials")
+		}
+		return user, false, errutil.Wrap(err, "failed to get credentials from db")
+	}
+	if uc.Locked {
+		return user, false, nil
+	}
+
+	err = s.userCredentialDao.UpdateLoginKey(tx, user.ID, loginKeyHash, loginCodeHash, expiresAt)
+	return user, true, errutil.Wrap(err, "failed to update login key")
+}
+
+// LoginWithMagicLink logs the user in with the key of an emailed login link, or
+// with the email address and emailed code.
+func (s *Service) LoginWithMagicLink(ctx context.Context, request MagicLoginVerifyRequest) (user model.User, err error) {
+	if request.Key == "" && (request.Email == "" || request.Code == "") {
+		return model.User{}, errutil.NewBadRequest("either key or email and code are required")
+	}
+	defer func() { countLogin(loginMagicLink, err) }()
+
+	var loginErr error
+	err = s.db.RunInTx(ctx, func(tx *db.Tx) error {
+		if request.Key != "" {
+			user, loginErr = s.loginWithKeyTx(tx, request.Key)
+		} else {
+			user, loginErr = s.loginWithCodeTx(tx, request.Email, request.Code)
+		}
+		if errutil.IsClientError(loginErr) {
+			// commit the login code attempt counter
+			return nil
+		}
+		return loginErr
+	})
+	if err != nil {
+		return user, err
+	}
+	return user, loginErr
+}
+
+func (s *Service) loginWithKeyTx(tx *db.Tx, key string) (model.User, error) {
+	keyHash, err := crypto.SHA256([]byte(key))
+	if err != nil {
+		return model.User{}, errutil.Wrap(err, "failed to hash login key")
+	}
+	uc, err := s.userCredentialDao.FindByLoginKey(tx, keyHash)
+	if err != nil {
+		if db.IsNoDataFound(err) {
+			return model.User{}, errutil.NewUnauthorized(invalidLoginKeyMsg)
+		}
+		return model.User{}, errutil.Wrap(err, "failed to find login key")
+	}
+	return s.consumeLoginKeyTx(tx, uc)
+}
+
+func (s *Service) loginWithCodeTx(tx *db.Tx, email, code string) (model.User, error) {
+	user, err := s.userDao.FindByEmail(tx, email)
+	if err != nil {
+		if db.IsNoDataFound(err) {
+			return user, errutil.NewUnauthorized(invalidLoginKeyMsg)
+		}
+		return user, errutil.Wrap(err, "failed to find user by email")
+	}
+	uc, err := s.userCredentialDao.Get(tx, user.ID)
+	if err != nil {
+		if db.IsNoDataFound(err) {
+			return user, errutil.NewUnauthorized(invalidLoginKeyMsg)
+		}
+		return user, errutil.Wrap(err, "failed to get credentials from db")
+	}
+	if uc.LoginCode == "" || uc.LoginCodeAttempts >= maxLoginCodeAttempts {
+		return user, errutil.NewUnauthorized(invalidLoginKeyMsg)
+	}
+
+	codeHash, err := crypto.SHA256([]byte(strings.TrimSpace(code)))
+	if err != nil {
+		return user, errutil.Wrap(err, "failed to hash login code")
+	}
+	if subtle.ConstantTimeCompare([]byte(codeHash), []byte(uc.LoginCode)) != 1 {
+		err = s.userCredentialDao.IncrementLoginCodeAttempts(tx, uc.ID)
+		if err != nil {
+			return user, errutil.Wrap(err, "failed to increment login code attempts")
+		}
+		return user, errutil.NewUnauthorized(invalidLoginKeyMsg)
+	}
+	return s.consumeLoginKeyTx(tx, uc)
+}
+
+func (s *Service) consumeLoginKeyTx(tx *db.Tx, uc model.UserCredential) (model.User, error) {
+	user, err := s.userDao.Find(tx, uc.ID)
+	if err != nil {
+		return user, errutil.Wrap(err, "failed to find user")
+	}
+	if uc.LoginKeyExpiresAt.IsZero() || uc.LoginKeyExpiresAt.Before(time.Now()) {
+		return user, errutil.NewUnauthorized(invalidLoginKeyMsg)
+	}
+	if !user.Active {
+		return user, errutil.NewUnauthorized("user is not active")
+	}
+	if uc.Locked {
+		return user, errutil.NewUnauthorized("account is locked")
+	}
+
+	err = s.userCredentialDao.ConsumeLoginKey(tx, uc.ID)
+	if err != nil {
+		return user, errutil.Wrap(err, "failed to consume login key")
+	}
+	return user, nil
+}
+
+func generateLoginKey() (string, error) {
+	data, err := crypto.GenerateRandomBytes(32)
+	if err != nil {
+		return "", errutil.Wrap(err, "failed to generate login key")
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func generateLoginCode() (string, error) {
+	data, err := crypto.GenerateRandomBytes(8)
+	if err != nil {
+		return "", errutil.Wrap(err, "failed to generate login code")
+	}
+	mod := uint64(1)
+	for i := 0; i < loginCodeDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", loginCodeDigits, binary.BigEndian.Uint64(data)%mod), nil
+}
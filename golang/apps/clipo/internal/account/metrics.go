@@ -0,0 +1,48 @@
+package account
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+	"github.com/mmrath/gobase/golang/pkg/metrics"
+)
+
+const (
+	loginPassword  = "password"
+	loginMFA       = "mfa"
+	loginMagicLink = "magic_link"
+)
+
+var (
+	registrationsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "account_registrations_total",
+		Help: "Number of accounts registered.",
+	})
+	loginsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "account_logins_total",
+		Help: "Number of login attempts by method and outcome: success, rejected if the credentials were not accepted, or error.",
+	}, []string{"method", "outcome"})
+	lockoutsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "account_lockouts_total",
+		Help: "Number of accounts locked after too many invalid attempts.",
+	})
+)
+
+func init() {
+	metrics.MustRegister(registrationsTotal, loginsTotal, lockoutsTotal)
+}
+
+// countLogin counts a login attempt of the given method which returned err.
+func countLogin(method string, err error) {
+	outcome := "success"
+	if errutil.IsClientError(err) {
+		outcome = "rejected"
+	} else if err != nil {
+		outcome = "error"
+	}
+	loginsTotal.WithLabelValues(method, outcome).Inc()
+}
+
+func countLockout() {
+	lockoutsTotal.Inc()
+}
@@ -0,0 +1,353 @@
+package account
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/mmrath/gobase/golang/pkg/auth"
+	"github.com/mmrath/gobase/golang/pkg/credential"
+	"github.com/mmrath/gobase/golang/pkg/crypto"
+	"github.com/mmrath/gobase/golang/pkg/db"
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+	"github.com/mmrath/gobase/golang/pkg/model"
+	"github.com/mmrath/gobase/golang/pkg/otp"
+)
+
+const recoveryCodeCount = 10
+
+// recoveryCodeAlphabet leaves out characters which are easily confused.
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type MFAStatus struct {
+	TOTPEnabled            bool `json:"totpEnabled"`
+	RecoveryCodesRemaining int  `json:"recoveryCodesRemaining"`
+}
+
+// MFAChallenge returns a token for the second login step if the user has a
+// second factor enabled, or nil if the password is sufficient.
+func (s *Service) MFAChallenge(ctx context.Context, user model.User) (*auth.Token, error) {
+	var uc model.UserCredential
+	err := s.db.RunInTx(ctx, func(tx *db.Tx) (err error) {
+		uc, err = s.userCredentialDao.Get(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, errutil.Wrap(err, "failed to get credentials from db")
+	}
+	if !uc.TOTPEnabled {
+		return nil, nil
+	}
+
+	token, err := s.jwtService.NewMFAToken(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// LoginWithMFA completes a login started with the password by checking a TOTP or recovery code.
+func (s *Service) LoginWithMFA(ctx context.Context, mfaToken string, code string) (user model.User, err error) {
+	defer func() { countLogin(loginMFA, err) }()
+	userID, err := s.jwtService.ParseMFAToken(mfaToken)
+	if err != nil {
+		return model.User{}, err
+	}
+
+	var loginErr error
+	err = s.db.RunInTx(ctx, func(tx *db.Tx) error {
+		user, loginErr = s.loginWithMFATx(tx, userID, code)
+		if errutil.IsClientError(loginErr) {
+			// commit the invalid attempt counter
+			return nil
+		}
+		return loginErr
+	})
+	if err != nil {
+		return user, err
+	}
+	return user, loginErr
+}
+
+func (s *Service) loginWithMFATx(tx *db.Tx, userID int64, code string) (model.User, error) {
+	user, err := s.userDao.Find(tx, userID)
+	if err != nil {
+		return user, errutil.Wrap(err, "failed to find user")
+	}
+	if !user.Active {
+		return user, errutil.NewUnauthorized("user is not active")
+	}
+
+	uc, err := s.userCredentialDao.Get(tx, userID)
+	if err != nil {
+		return user, errutil.Wrap(err, "failed to get credentials from db")
+	}
+	if !uc.TOTPEnabled {
+		return user, errutil.NewUnauthorized("two-factor authentication is not enabled")
+	}
+
+	err = s.verifySecondFactorTx(tx, uc, code)
+	if err != nil {
+		return user, err
+	}
+
+	if uc.InvalidAttempts > 0 {
+		err = s.userCredentialDao.ResetInvalidAttempts(tx, userID)
+		if err != nil {
+			return user, errutil.Wrap(err, "failed resetting invalid attempts")
+		}
+	}
+	return user, nil
+}
+
+// verifySecondFactorTx accepts a TOTP code which has not been used before or an
+// unused recovery code. Failures count towards the account lockout.
+func (s *Service) verifySecondFactorTx(tx *db.Tx, uc model.UserCredential, code string) error {
+	if uc.Locked {
+		return errutil.NewUnauthorized("account is locked")
+	}
+
+	step, ok, err := otp.Validate(uc.TOTPSecret, code, time.Now())
+	if err != nil {
+		return errutil.Wrap(err, "failed to validate totp code")
+	}
+	if ok && step > uc.TOTPLastUsedStep {
+		err = s.userCredentialDao.UpdateTOTPLastUsedStep(tx, uc.ID, step)
+		return errutil.Wrap(err, "failed to update last used totp step")
+	}
+
+	if !ok {
+		codeHash, err := hashRecoveryCode(code)
+		if err != nil {
+			return err
+		}
+		used, err := s.recoveryCodeDao.Use(tx, uc.ID, codeHash)
+		if err != nil {
+			return errutil.Wrap(err, "failed to use recovery code")
+		}
+		if used {
+			return nil
+		}
+	}
+
+	lock := uc.InvalidAttempts >= credential.MaxInvalidAttempts
+	err = s.userCredentialDao.IncrementInvalidAttempts(tx, uc.ID, lock)
+	if err != nil {
+		return errutil.Wrap(err, "failed to increment invalid attempts")
+	}
+	if lock {
+		countLockout()
+	}
+	return errutil.NewUnauthorized("invalid code")
+}
+
+// EnrollTOTP starts the enrollment of an authenticator app. The secret is only
+// enforced once confirmed with ConfirmTOTP.
+func (s *Service) EnrollTOTP(ctx context.Context) (enrollment TOTPEnrollment, err error) {
+	id, err := auth.UserIDFromContext(ctx)
+	if err != nil {
+		return enrollment, err
+	}
+
+	err = s.db.RunInTx(ctx, func(tx *db.Tx) error {
+		enrollment, err = s.enrollTOTPTx(tx, id)
+		return err
+	})
+	return enrollment, err
+}
+
+func (s *Service) enrollTOTPTx(tx *db.Tx, id int64) (TOTPEnrollment, error) {
+	uc, err := s.userCredentialDao.Get(tx, id)
+	if err != nil {
+		return TOTPEnrollment{}, errutil.Wrap(err, "failed to get credentials from db")
+	}
+	if uc.TOTPEnabled {
+		return TOTPEnrollment{}, errutil.NewBadRequest("two-factor authentication is already enabled")
+	}
+
+	user, err := s.userDao.Find(tx, id)
+	if err != nil {
+		return TOTPEnrollment{}, errutil.Wrap(err, "failed to find user")
+	}
+
+	secret, err := otp.GenerateSecret()
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	err = s.userCredentialDao.UpdateTOTPSecret(tx, id, secret)
+	if err != nil {
+		return TOTPEnrollment{}, errutil.Wrap(err, "failed to store totp secret")
+	}
+	return TOTPEnrollment{Secret: secret, URI: otp.URI(s.mfaIssuer, user.Email, secret)}, nil
+}
+
+// ConfirmTOTP enables the enrolled authenticator after checking a code from it
+// and returns a fresh set of recovery codes, which are not retrievable afterwards.
+func (s *Service) ConfirmTOTP(ctx context.Context, code string) (codes []string, err error) {
+	id, err := auth.UserIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.RunInTx(ctx, func(tx *db.Tx) error {
+		codes, err = s.confirmTOTPTx(tx, id, code)
+		return err
+	})
+	return codes, err
+}
+
+func (s *Service) confirmTOTPTx(tx *db.Tx, id int64, code string) ([]string, error) {
+	uc, err := s.userCredentialDao.Get(tx, id)
+	if err != nil {
+		return nil, errutil.Wrap(err, "failed to get credentials from db")
+	}
+	if uc.TOTPEnabled {
+		return nil, errutil.NewBadRequest("two-factor authentication is already enabled")
+	}
+	if uc.TOTPSecret == "" {
+		return nil, errutil.NewBadRequest("two-factor authentication enrollment has not been started")
+	}
+
+	step, ok, err := otp.Validate(uc.TOTPSecret, code, time.Now())
+	if err != nil {
+		return nil, errutil.Wrap(err, "failed to validate totp code")
+	}
+	if !ok {
+		return nil, errutil.NewFieldError("code", "invalid code")
+	}
+
+	err = s.userCredentialDao.EnableTOTP(tx, id, step)
+	if err != nil {
+		return nil, errutil.Wrap(err, "failed to enable totp")
+	}
+	return s.replaceRecoveryCodesTx(tx, id)
+}
+
+// DisableTOTP turns two-factor authentication off. It requires a current TOTP or recovery code.
+func (s *Service) DisableTOTP(ctx context.Context, code string) error {
+	return s.withSecondFactor(ctx, code, func(tx *db.Tx, id int64) error {
+		err := s.userCredentialDao.DisableTOTP(tx, id)
+		if err != nil {
+			return errutil.Wrap(err, "failed to disable totp")
+		}
+		return s.recoveryCodeDao.DeleteAll(tx, id)
+	})
+}
+
+// RegenerateRecoveryCodes invalidates all recovery codes and returns new ones.
+// It requires a current TOTP or recovery code.
+func (s *Service) RegenerateRecoveryCodes(ctx context.Context, code string) (codes []string, err error) {
+	err = s.withSecondFactor(ctx, code, func(tx *db.Tx, id int64) error {
+		codes, err = s.replaceRecoveryCodesTx(tx, id)
+		return err
+	})
+	return codes, err
+}
+
+func (s *Service) withSecondFactor(ctx context.Context, code string, fn func(tx *db.Tx, id int64) error) error {
+	id, err := auth.UserIDFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	var fnErr error
+	err = s.db.RunInTx(ctx, func(tx *db.Tx) error {
+		fnErr = s.withSecondFactorTx(tx, id, code, fn)
+		if errutil.IsClientError(fnErr) {
+			// commit the invalid attempt counter
+			return nil
+		}
+		return fnErr
+	})
+	if err != nil {
+		return err
+	}
+	return fnErr
+}
+
+func (s *Service) withSecondFactorTx(tx *db.Tx, id int64, code string, fn func(tx *db.Tx, id int64) error) error {
+	uc, err := s.userCredentialDao.Get(tx, id)
+	if err != nil {
+		return errutil.Wrap(err, "failed to get credentials from db")
+	}
+	if !uc.TOTPEnabled {
+		return errutil.NewBadRequest("two-factor authentication is not enabled")
+	}
+	err = s.verifySecondFactorTx(tx, uc, code)
+	if err != nil {
+		return err
+	}
+	return fn(tx, id)
+}
+
+func (s *Service) GetMFAStatus(ctx context.Context) (status MFAStatus, err error) {
+	id, err := auth.UserIDFromContext(ctx)
+	if err != nil {
+		return status, err
+	}
+
+	err = s.db.RunInTx(ctx, func(tx *db.Tx) error {
+		uc, err := s.userCredentialDao.Get(tx, id)
+		if err != nil {
+			return errutil.Wrap(err, "failed to get credentials from db")
+		}
+		status.TOTPEnabled = uc.TOTPEnabled
+		status.RecoveryCodesRemaining, err = s.recoveryCodeDao.CountUnused(tx, id)
+		return err
+	})
+	return status, err
+}
+
+func (s *Service) replaceRecoveryCodesTx(tx *db.Tx, id int64) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		hash, err := hashRecoveryCode(code)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		hashes[i] = hash
+	}
+
+	err := s.recoveryCodeDao.ReplaceAll(tx, id, hashes)
+	if err != nil {
+		return nil, errutil.Wrap(err, "failed to store recovery codes")
+	}
+	return codes, nil
+}
+
+// generateRecoveryCode returns a code like "k7tqe-3mzvr".
+func generateRecoveryCode() (string, error) {
+	data, err := crypto.GenerateRandomBytes(10)
+	if err != nil {
+		return "", errutil.Wrap(err, "failed to generate recovery code")
+	}
+	code := make([]byte, 0, 11)
+	for i, b := range data {
+		if i == 5 {
+			code = append(code, '-')
+		}
+		code = append(code, recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)])
+	}
+	return string(code), nil
+}
+
+// hashRecoveryCode ignores case, spaces and dashes, which users tend to get wrong when typing.
+func hashRecoveryCode(code string) (string, error) {
+	normalized := strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+	hash, err := crypto.SHA256([]byte(normalized))
+	if err != nil {
+		return "", errutil.Wrap(err, "failed to hash recovery code")
+	}
+	return hash, nil
+}
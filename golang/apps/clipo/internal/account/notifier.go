@@ -1,8 +1,11 @@
 package account
 
 import (
+	"context"
 	"fmt"
 	"html/template"
+	"sync"
+	"time"
 
 	"github.com/mmrath/gobase/golang/apps/clipo/internal/templateutil"
 	"github.com/mmrath/gobase/golang/pkg/errutil"
@@ -12,49 +15,70 @@ import (
 )
 
 type Notifier interface {
-	NotifyActivation(user model.User, token string) error
-	NotifyPasswordChange(user model.User) error
-	NotifyPasswordResetInit(user model.User, token string) error
+	NotifyActivation(ctx context.Context, user model.User, token string) error
+	NotifyPasswordChange(ctx context.Context, user model.User) error
+	NotifyPasswordResetInit(ctx context.Context, user model.User, token string) error
+	NotifyLoginLink(ctx context.Context, user model.User, token string, code string, validFor time.Duration) error
+	// SetFrom changes the sender of emails sent from now on.
+	SetFrom(from email.Address)
 }
 
-func NewNotifier(appDomainName string, mailer email.Mailer, registry *templateutil.Registry) Notifier {
-	return &notifier{appDomainName: appDomainName, mailer: mailer, templateRegistry: registry}
+func NewNotifier(appDomainName string, from email.Address, mailer email.Mailer, registry *templateutil.Registry) Notifier {
+	return &notifier{appDomainName: appDomainName, from: from, mailer: mailer, templateRegistry: registry}
 }
 
 type notifier struct {
 	mailer           email.Mailer
 	appDomainName    string
 	templateRegistry *templateutil.Registry
+
+	mu   sync.RWMutex
+	from email.Address
 }
 
-func (n *notifier) NotifyPasswordChange(user model.User) error {
+func (n *notifier) SetFrom(from email.Address) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.from = from
+}
+
+// sender returns the configured sender, or info@ the app domain if there is none.
+func (n *notifier) sender() email.Address {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.from.Address == "" {
+		return email.NewAddress("info", "info@"+n.appDomainName)
+	}
+	return n.from
+}
+
+func (n *notifier) NotifyPasswordChange(ctx context.Context, user model.User) error {
 
 	data := make(map[string]interface{})
 	data["user"] = user
 
-	from := email.NewAddress("", "")
 	to := []email.Address{email.NewAddress(user.GetName(), user.GetEmail())}
 	subject := "Account password changed"
 	pcTmpl := "templates/email/auth/password_changed.gohtml"
 
-	htmlBody, err := n.templateRegistry.RenderToString(pcTmpl, data)
+	htmlBody, err := n.templateRegistry.RenderToString(ctx, pcTmpl, data)
 
 	if err != nil {
 		return errutil.Wrapf(err, "failed to render email")
 	}
 
-	msg, err := email.NewHTMLMessage(from, to, subject, htmlBody)
+	msg, err := email.NewHTMLMessage(n.sender(), to, subject, htmlBody)
 	if err != nil {
 		return errutil.Wrap(err, "failed to build email message")
 	}
-	err = n.mailer.Send(msg)
+	err = n.mailer.Send(ctx, msg)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (n *notifier) NotifyActivation(user model.User, token string) error {
+func (n *notifier) NotifyActivation(ctx context.Context, user model.User, token string) error {
 
 	url := fmt.Sprintf("%s/clipo/account/activate?key=%s", n.appDomainName, token)
 	data := struct {
@@ -65,30 +89,29 @@ func (n *notifier) NotifyActivation(user model.User, token string) error {
 		User: user,
 	}
 
-	from := email.NewAddress("info", "info@"+n.appDomainName)
 	to := []email.Address{email.NewAddress(user.GetName(), user.GetEmail())}
 	subject := "Activate your account"
 
-	htmlBody, err := n.templateRegistry.RenderToString("templates/email/auth/account_activation.gohtml", data)
+	htmlBody, err := n.templateRegistry.RenderToString(ctx, "templates/email/auth/account_activation.gohtml", data)
 
 	if err != nil {
 		return errutil.Wrapf(err, "failed to render email")
 	}
 
-	msg, err := email.NewHTMLMessage(from, to, subject, htmlBody)
+	msg, err := email.NewHTMLMessage(n.sender(), to, subject, htmlBody)
 
 	if err != nil {
 		return errutil.Wrapf(err, "failed to create email message")
 	}
 
-	err = n.mailer.Send(msg)
+	err = n.mailer.Send(ctx, msg)
 	if err != nil {
 		return errutil.Wrapf(err, "failed to send email")
 	}
 	return nil
 }
 
-func (n *notifier) NotifyPasswordResetInit(user model.User, token string) error {
+func (n *notifier) NotifyPasswordResetInit(ctx context.Context, user model.User, token string) error {
 	url := fmt.Sprintf("%s/account/reset-password?key=%s", n.appDomainName, token)
 	data := struct {
 		URL  template.URL
@@ -98,26 +121,61 @@ func (n *notifier) NotifyPasswordResetInit(user model.User, token string) error
 		User: user,
 	}
 
-	from := email.NewAddress("test", "test@localhost")
 	to := []email.Address{email.NewAddress(user.GetName(), user.GetEmail())}
 	subject := "Reset password"
 	passwordResetTmpl := "templates/email/auth/init_password_reset.gohtml"
 
-	htmlBody, err := n.templateRegistry.RenderToString(passwordResetTmpl, data)
+	htmlBody, err := n.templateRegistry.RenderToString(ctx, passwordResetTmpl, data)
 
 	if err != nil {
 		return errutil.Wrapf(err, "failed to render email")
 	}
 
-	msg, err := email.NewHTMLMessage(from, to, subject, htmlBody)
+	msg, err := email.NewHTMLMessage(n.sender(), to, subject, htmlBody)
 
 	if err != nil {
 		return err
 	}
 
-	err = n.mailer.Send(msg)
+	err = n.mailer.Send(ctx, msg)
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+func (n *notifier) NotifyLoginLink(ctx context.Context, user model.User, token string, code string, validFor time.Duration) error {
+	url := fmt.Sprintf("%s/clipo/account/login/magic?key=%s", n.appDomainName, token)
+	data := struct {
+		URL          template.URL
+		Code         string
+		ValidMinutes int
+		User         model.User
+	}{
+		URL:          template.URL(url),
+		Code:         code,
+		ValidMinutes: int(validFor.Minutes()),
+		User:         user,
+	}
+
+	to := []email.Address{email.NewAddress(user.GetName(), user.GetEmail())}
+	subject := "Your login link"
+
+	htmlBody, err := n.templateRegistry.RenderToString(ctx, "templates/email/auth/login_link.gohtml", data)
+
+	if err != nil {
+		return errutil.Wrapf(err, "failed to render email")
+	}
+
+	msg, err := email.NewHTMLMessage(n.sender(), to, subject, htmlBody)
+
+	if err != nil {
+		return errutil.Wrapf(err, "failed to create email message")
+	}
+
+	err = n.mailer.Send(ctx, msg)
+	if err != nil {
+		return errutil.Wrapf(err, "failed to send email")
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+package account
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/mmrath/gobase/golang/pkg/email"
+)
+
+func TestNotifierSender(t *testing.T) {
+	n := NewNotifier("example.com", email.Address{}, nil, nil).(*notifier)
+	require.Equal(t, email.NewAddress("info", "info@example.com"), n.sender(),
+		"without a configured sender mails are sent from the app domain")
+
+	from := email.NewAddress("Clipo", "noreply@example.com")
+	n.SetFrom(from)
+	require.Equal(t, from, n.sender())
+}
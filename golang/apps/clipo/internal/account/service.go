@@ -14,6 +14,7 @@ import (
 	"github.com/rs/zerolog/log"
 
 	"github.com/mmrath/gobase/golang/pkg/auth"
+	"github.com/mmrath/gobase/golang/pkg/credential"
 	"github.com/mmrath/gobase/golang/pkg/crypto"
 	"github.com/mmrath/gobase/golang/pkg/model"
 
@@ -21,22 +22,36 @@ import (
 )
 
 type Service struct {
-	notifier          Notifier
-	db                *db.DB
-	userCredentialDao model.UserCredentialDao
-	userDao           model.UserDao
+	notifier           Notifier
+	db                 *db.DB
+	jwtService         auth.JWTService
+	userCredentialDao  model.UserCredentialDao
+	userDao            model.UserDao
+	authTokenDao       model.AuthTokenDao
+	roleDao            model.RoleDao
+	permissionDao      model.PermissionDao
+	credentialVerifier *credential.Verifier
+	recoveryCodeDao    model.UserRecoveryCodeDao
+	mfaIssuer          string
 }
 
-func NewService(notifier Notifier, d *db.DB) *Service {
+func NewService(notifier Notifier, d *db.DB, jwtService auth.JWTService, mfaIssuer string) *Service {
 	return &Service{
-		notifier:          notifier,
-		db:                d,
-		userCredentialDao: model.NewUserCredentialDao(),
-		userDao:           model.NewUserDao(),
+		notifier:           notifier,
+		db:                 d,
+		jwtService:         jwtService,
+		userCredentialDao:  model.NewUserCredentialDao(),
+		userDao:            model.NewUserDao(),
+		authTokenDao:       model.NewAuthTokenDao(),
+		roleDao:            model.NewRoleDao(),
+		permissionDao:      model.NewPermissionDao(),
+		credentialVerifier: credential.NewVerifier().OnLockout(countLockout),
+		recoveryCodeDao:    model.NewUserRecoveryCodeDao(),
+		mfaIssuer:          mfaIssuer,
 	}
 }
 
-func (s *Service) Activate(token string) error {
+func (s *Service) Activate(ctx context.Context, token string) error {
 	err := validate.Field(token, "required,min=4,max=128")
 	if err != nil {
 		return err
@@ -44,7 +59,7 @@ func (s *Service) Activate(token string) error {
 
 	tokenHash := fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
 
-	err = s.db.RunInTx(context.Background(), func(tx *db.Tx) error {
+	err = s.db.RunInTx(ctx, func(tx *db.Tx) error {
 		return activateTx(tx, s.userCredentialDao, tokenHash)
 	})
 
@@ -76,75 +91,24 @@ func (s *Service) Login(ctx context.Context, login model.LoginRequest) (user mod
 	if err != nil {
 		return user, errutil.Wrap(err, "failed validation")
 	}
+	defer func() { countLogin(loginPassword, err) }()
+	var loginErr error
 	err = s.db.RunInTx(ctx, func(tx *db.Tx) error {
-		user, err = s.loginTx(tx, login)
-		return err
-	})
-	return user, err
-}
-
-func (s *Service) loginTx(tx *db.Tx, login model.LoginRequest) (model.User, error) {
-	invalidCredentialMsg := "invalid email or password"
-
-	user, err := s.userDao.FindByEmail(tx, login.Email)
-
-	if err != nil {
-		if db.IsNoDataFound(err) {
-			return user, errutil.NewUnauthorized(invalidCredentialMsg)
-		}
-		return user, errutil.Wrap(err, "failed to find user by email")
-	}
-
-	if !user.Active {
-		return user, errutil.NewUnauthorized("user is not active")
-	}
-	var uc model.UserCredential
-	uc, err = s.userCredentialDao.Get(tx, user.ID)
-	if err != nil {
-		if db.IsNoDataFound(err) {
-			return user, errutil.NewUnauthorized(invalidCredentialMsg)
+		user, loginErr = s.loginTx(tx, login)
+		if errutil.IsClientError(loginErr) {
+			// commit the invalid attempt counter
+			return nil
 		}
-		return user, errutil.Wrap(err, "failed to get credentials from db")
-	}
-
-	if !uc.Activated {
-		return user, errutil.NewUnauthorized("user is not activated")
-	} else if !uc.ExpiresAt.IsZero() && uc.ExpiresAt.Before(time.Now()) {
-		return user, errutil.NewUnauthorized("password expired")
-	} else if uc.Locked {
-		return user, errutil.NewUnauthorized("account is locked")
-	}
-
-	var matched bool
-	matched, err = crypto.CheckPassword(login.Password, uc.PasswordHash)
-
+		return loginErr
+	})
 	if err != nil {
-		return user, errutil.Wrap(err, "failed to check password")
-	}
-
-	if !matched {
-		if uc.InvalidAttempts >= 3 {
-			err = s.userCredentialDao.IncrementInvalidAttempts(tx, user.ID, true)
-			if err != nil {
-				return user, errutil.Wrapf(err, "failed to lock and increment invalid attempts")
-			}
-		} else {
-			err = s.userCredentialDao.IncrementInvalidAttempts(tx, user.ID, false)
-			if err != nil {
-				return user, errutil.Wrapf(err, "failed to increment invalid attempts")
-			}
-		}
-		return user, errutil.NewUnauthorized(invalidCredentialMsg)
+		return user, err
 	}
+	return user, loginErr
+}
 
-	if uc.InvalidAttempts > 0 {
-		err = s.userCredentialDao.ResetInvalidAttempts(tx, user.ID)
-		if err != nil {
-			// allow user to login, don't report error here
-			log.Error().Err(err).Msg("failed resetting invalid attempts")
-		}
-	}
-	return user, nil
+func (s *Service) loginTx(tx *db.Tx, login model.LoginRequest) (model.User, error) {
+	return s.credentialVerifier.VerifyTx(tx, login)
 }
 
 func (s *Service) ChangePassword(ctx context.Context, data model.ChangePasswordRequest) error {
@@ -152,10 +116,19 @@ func (s *Service) ChangePassword(ctx context.Context, data model.ChangePasswordR
 	if err != nil {
 		return err
 	}
-	err = s.db.RunInTx(context.Background(), func(tx *db.Tx) error {
-		return s.changePasswordTx(tx, id, data)
+	var changeErr error
+	err = s.db.RunInTx(ctx, func(tx *db.Tx) error {
+		changeErr = s.changePasswordTx(tx, id, data)
+		if errutil.IsClientError(changeErr) {
+			// commit the invalid attempt counter
+			return nil
+		}
+		return changeErr
 	})
-	return err
+	if err != nil {
+		return err
+	}
+	return changeErr
 }
 
 func (s *Service) changePasswordTx(tx *db.Tx, id int64, data model.ChangePasswordRequest) error {
@@ -179,6 +152,7 @@ func (s *Service) changePasswordTx(tx *db.Tx, id int64, data model.ChangePasswor
 			if err != nil {
 				return errutil.Wrap(err, "failed to lock user")
 			}
+			countLockout()
 		} else {
 			err = s.userCredentialDao.IncrementInvalidAttempts(tx, id, false)
 			if err != nil {
@@ -198,7 +172,7 @@ func (s *Service) changePasswordTx(tx *db.Tx, id int64, data model.ChangePasswor
 	return err
 }
 
-func (s *Service) InitiatePasswordReset(email string) error {
+func (s *Service) InitiatePasswordReset(ctx context.Context, email string) error {
 
 	var user model.User
 	var err error
@@ -206,7 +180,7 @@ func (s *Service) InitiatePasswordReset(email string) error {
 	resetTokenSha := fmt.Sprintf("%x", sha256.Sum256([]byte(resetToken)))
 	expiresAt := time.Now().Add(20 * time.Minute)
 
-	err = s.db.RunInTx(context.Background(), func(tx *db.Tx) error {
+	err = s.db.RunInTx(ctx, func(tx *db.Tx) error {
 		user, err = s.userDao.FindByEmail(tx, email)
 		if err != nil {
 			if db.IsNoDataFound(err) {
@@ -235,7 +209,7 @@ func (s *Service) InitiatePasswordReset(email string) error {
 	if err != nil {
 		return err
 	}
-	err = s.notifier.NotifyPasswordResetInit(user, resetToken)
+	err = s.notifier.NotifyPasswordResetInit(ctx, user, resetToken)
 
 	if err != nil {
 		log.Error().Err(err).Int64("id", user.ID).Msg("failed to send password reset email")
@@ -246,10 +220,10 @@ func (s *Service) InitiatePasswordReset(email string) error {
 	return nil
 }
 
-func (s *Service) ResetPassword(passwordResetRequest model.ResetPasswordRequest) error {
+func (s *Service) ResetPassword(ctx context.Context, passwordResetRequest model.ResetPasswordRequest) error {
 	resetTokenSha := fmt.Sprintf("%x", sha256.Sum256([]byte(passwordResetRequest.ResetToken)))
 
-	err := s.db.RunInTx(context.Background(), func(tx *db.Tx) error {
+	err := s.db.RunInTx(ctx, func(tx *db.Tx) error {
 		uc, err := s.userCredentialDao.FindByResetKey(tx, resetTokenSha)
 
 		if err != nil {
@@ -275,7 +249,7 @@ func (s *Service) ResetPassword(passwordResetRequest model.ResetPasswordRequest)
 	return err
 }
 
-func (s *Service) Register(request model.RegisterAccountRequest) (*model.User, error) {
+func (s *Service) Register(ctx context.Context, request model.RegisterAccountRequest) (*model.User, error) {
 
 	log.Debug().Interface("email", request.Email).Msg("registering user account")
 	err := validate.Struct(request)
@@ -284,14 +258,7 @@ func (s *Service) Register(request model.RegisterAccountRequest) (*model.User, e
 		return nil, err
 	}
 
-	newUser := model.User{
-		AuditDetails: model.AuditDetails{UpdatedBy: "Register"},
-		FirstName:    request.FirstName,
-		LastName:     request.LastName,
-		Email:        strings.ToLower(request.Email),
-		Active:       true,
-	}
-
+	var newUser model.User
 	passwordHash, err := crypto.HashPassword(request.Password)
 	if err != nil {
 		return nil, errutil.Wrap(err, "failed to hash password")
@@ -299,12 +266,19 @@ func (s *Service) Register(request model.RegisterAccountRequest) (*model.User, e
 
 	activationToken := uuid.New().String()
 	activationTokenHash := fmt.Sprintf("%x", sha256.Sum256([]byte(activationToken)))
-	err = s.db.RunInTx(context.Background(), func(tx *db.Tx) error {
-		err = s.checkForDuplicate(tx, request.Email, "email", s.userDao.ExistsByEmail)
+	err = s.db.RunInTx(ctx, func(tx *db.Tx) error {
+		err := s.checkForDuplicate(tx, request.Email, "email", s.userDao.ExistsByEmail)
 		if err != nil {
 			return err
 		}
 
+		newUser = model.User{
+			AuditDetails: model.AuditDetails{UpdatedBy: "Register"},
+			FirstName:    request.FirstName,
+			LastName:     request.LastName,
+			Email:        strings.ToLower(request.Email),
+			Active:       true,
+		}
 		err = s.userDao.Insert(tx, &newUser)
 		if err != nil {
 			return errutil.Wrap(err, "failed to insert user")
@@ -328,12 +302,13 @@ func (s *Service) Register(request model.RegisterAccountRequest) (*model.User, e
 		return nil, errutil.Wrap(err, "failed to complete sign-up transaction")
 	}
 
-	err = s.notifier.NotifyActivation(newUser, activationToken)
+	err = s.notifier.NotifyActivation(ctx, newUser, activationToken)
 
 	if err != nil {
 		return nil, errutil.Wrap(err, "failed to send account activation email")
 	}
 
+	registrationsTotal.Inc()
 	log.Debug().Interface("user", newUser).Msg("successfully signed up user")
 	return &newUser, nil
 }
@@ -345,7 +320,7 @@ func (s *Service) GetProfile(ctx context.Context) (model.UserProfile, error) {
 	if err != nil {
 		return userProfile, err
 	}
-	err = s.db.RunInTx(context.Background(), func(tx *db.Tx) error {
+	err = s.db.RunInTx(ctx, func(tx *db.Tx) error {
 		user, err := s.userDao.Find(tx, id)
 		if err != nil {
 			return err
@@ -365,7 +340,7 @@ func (s *Service) UpdateProfile(ctx context.Context, profile model.UserProfile)
 		return err
 	}
 
-	err = s.db.RunInTx(context.Background(), func(tx *db.Tx) error {
+	err = s.db.RunInTx(ctx, func(tx *db.Tx) error {
 		user, err := s.userDao.Find(tx, id)
 		if err != nil {
 			return err
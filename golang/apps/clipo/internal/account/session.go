@@ -0,0 +1,203 @@
+package account
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/mmrath/gobase/golang/pkg/auth"
+	"github.com/mmrath/gobase/golang/pkg/db"
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+	"github.com/mmrath/gobase/golang/pkg/model"
+)
+
+// Session holds the tokens handed to a client after login or refresh.
+type Session struct {
+	AccessToken  auth.Token
+	RefreshToken auth.RefreshToken
+}
+
+// NewSession issues an access token and starts a new refresh token family for the user.
+func (s *Service) NewSession(ctx context.Context, user model.User) (session Session, err error) {
+	err = s.db.RunInTx(ctx, func(tx *db.Tx) error {
+		session, err = s.issueSessionTx(tx, user, uuid.New())
+		return err
+	})
+	return session, err
+}
+
+// RefreshSession exchanges a refresh token for a new access and refresh token.
+// A refresh token can be used only once; presenting it again revokes every
+// token of its family, as that means it has been stolen.
+func (s *Service) RefreshSession(ctx context.Context, refreshToken string) (Session, error) {
+	var session Session
+	var refreshErr error
+
+	tokenHash, err := auth.HashRefreshToken(refreshToken)
+	if err != nil {
+		return session, err
+	}
+
+	err = s.db.RunInTx(ctx, func(tx *db.Tx) error {
+		session, refreshErr = s.refreshSessionTx(tx, tokenHash)
+		if errutil.IsClientError(refreshErr) {
+			// commit revocations made while rejecting the token
+			return nil
+		}
+		return refreshErr
+	})
+	if err != nil {
+		return session, errutil.Wrap(err, "failed to refresh session")
+	}
+	return session, refreshErr
+}
+
+func (s *Service) refreshSessionTx(tx *db.Tx, tokenHash string) (Session, error) {
+	invalidTokenMsg := "invalid refresh token"
+
+	current, err := s.authTokenDao.FindByToken(tx, tokenHash)
+	if err != nil {
+		if db.IsNoDataFound(err) {
+			return Session{}, errutil.NewUnauthorized(invalidTokenMsg)
+		}
+		return Session{}, errutil.Wrap(err, "failed to find refresh token")
+	}
+
+	if current.RevokedAt != nil {
+		return Session{}, errutil.NewUnauthorized(invalidTokenMsg)
+	}
+
+	if current.UsedAt != nil {
+		log.Warn().
+			Int64("userId", current.UserID).
+			Str("familyId", current.FamilyID.String()).
+			Msg("refresh token reused, revoking token family")
+		err = s.authTokenDao.RevokeFamily(tx, current.FamilyID)
+		if err != nil {
+			return Session{}, errutil.Wrap(err, "failed to revoke token family")
+		}
+		return Session{}, errutil.NewUnauthorized(invalidTokenMsg)
+	}
+
+	if current.ExpiresAt.Before(time.Now()) {
+		return Session{}, errutil.NewUnauthorized("refresh token expired")
+	}
+
+	user, err := s.userDao.Find(tx, current.UserID)
+	if err != nil {
+		return Session{}, errutil.Wrap(err, "failed to find user of refresh token")
+	}
+
+	if !user.Active {
+		err = s.authTokenDao.RevokeFamily(tx, current.FamilyID)
+		if err != nil {
+			return Session{}, errutil.Wrap(err, "failed to revoke token family")
+		}
+		return Session{}, errutil.NewUnauthorized("user is not active")
+	}
+
+	err = s.authTokenDao.MarkUsed(tx, current.ID)
+	if err != nil {
+		return Session{}, errutil.Wrap(err, "failed to mark refresh token as used")
+	}
+
+	return s.issueSessionTx(tx, user, current.FamilyID)
+}
+
+func (s *Service) issueSessionTx(tx *db.Tx, user model.User, familyID uuid.UUID) (Session, error) {
+	authorities, err := s.authoritiesTx(tx, user.ID)
+	if err != nil {
+		return Session{}, err
+	}
+
+	accessToken, err := s.jwtService.NewToken(&user, authorities)
+	if err != nil {
+		return Session{}, err
+	}
+
+	refreshToken, err := s.jwtService.NewRefreshToken()
+	if err != nil {
+		return Session{}, err
+	}
+
+	err = s.authTokenDao.Insert(tx, &model.AuthToken{
+		UserID:    user.ID,
+		Token:     refreshToken.Hash,
+		TokenID:   accessToken.ID,
+		FamilyID:  familyID,
+		ExpiresAt: refreshToken.ExpiresAt,
+	})
+	if err != nil {
+		return Session{}, errutil.Wrap(err, "failed to insert refresh token")
+	}
+
+	return Session{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+// authoritiesTx resolves the roles and permissions of the user, including those granted through groups.
+func (s *Service) authoritiesTx(tx *db.Tx, userID int64) (auth.Authorities, error) {
+	roles, err := s.roleDao.FindNamesByUserID(tx, userID)
+	if err != nil {
+		return auth.Authorities{}, errutil.Wrap(err, "failed to find roles of user")
+	}
+	permissions, err := s.permissionDao.FindNamesByUserID(tx, userID)
+	if err != nil {
+		return auth.Authorities{}, errutil.Wrap(err, "failed to find permissions of user")
+	}
+	return auth.Authorities{Roles: roles, Permissions: permissions}, nil
+}
+
+// RevokeSession revokes the token family of the given refresh token.
+// Unknown tokens are ignored.
+func (s *Service) RevokeSession(ctx context.Context, refreshToken string) error {
+	tokenHash, err := auth.HashRefreshToken(refreshToken)
+	if err != nil {
+		return err
+	}
+
+	return s.db.RunInTx(ctx, func(tx *db.Tx) error {
+		token, err := s.authTokenDao.FindByToken(tx, tokenHash)
+		if err != nil {
+			if db.IsNoDataFound(err) {
+				return nil
+			}
+			return errutil.Wrap(err, "failed to find refresh token")
+		}
+		return s.authTokenDao.RevokeFamily(tx, token.FamilyID)
+	})
+}
+
+// RevokeSessionByTokenID revokes the token family of the access token with the given jti.
+// Unknown tokens are ignored.
+func (s *Service) RevokeSessionByTokenID(ctx context.Context, tokenID string) error {
+	return s.db.RunInTx(ctx, func(tx *db.Tx) error {
+		token, err := s.authTokenDao.FindByTokenID(tx, tokenID)
+		if err != nil {
+			if db.IsNoDataFound(err) {
+				return nil
+			}
+			return errutil.Wrap(err, "failed to find refresh token")
+		}
+		return s.authTokenDao.RevokeFamily(tx, token.FamilyID)
+	})
+}
+
+type revocationChecker struct {
+	db           *db.DB
+	authTokenDao model.AuthTokenDao
+}
+
+// NewRevocationChecker returns an auth.RevocationChecker backed by the auth_token table.
+func NewRevocationChecker(d *db.DB) auth.RevocationChecker {
+	return &revocationChecker{db: d, authTokenDao: model.NewAuthTokenDao()}
+}
+
+func (c *revocationChecker) IsRevoked(ctx context.Context, tokenID string) (revoked bool, err error) {
+	err = c.db.RunInTx(ctx, func(tx *db.Tx) error {
+		revoked, err = c.authTokenDao.IsTokenIDRevoked(tx, tokenID)
+		return err
+	})
+	return revoked, err
+}
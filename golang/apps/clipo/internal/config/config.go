@@ -1,29 +1,48 @@
 package config
 
 import (
-	"github.com/kelseyhightower/envconfig"
-
 	"github.com/mmrath/gobase/golang/pkg/auth"
+	pkgconfig "github.com/mmrath/gobase/golang/pkg/config"
 	"github.com/mmrath/gobase/golang/pkg/db"
 	"github.com/mmrath/gobase/golang/pkg/email"
 	"github.com/mmrath/gobase/golang/pkg/errutil"
+	"github.com/mmrath/gobase/golang/pkg/health"
+	"github.com/mmrath/gobase/golang/pkg/logutil"
+	"github.com/mmrath/gobase/golang/pkg/metrics"
+	"github.com/mmrath/gobase/golang/pkg/server"
+	"github.com/mmrath/gobase/golang/pkg/tracing"
 )
 
 type Config struct {
 	DevMode       bool             `yaml:"devMode" split_words:"true"`
-	AppDomainName string           `required:"true" split_words:"true"`
+	LogLevel      logutil.Level    `default:"info" split_words:"true" yaml:"logLevel" reload:"true"`
+	AppDomainName string           `required:"true" split_words:"true" yaml:"appDomainName"`
 	Web           WebConfig        `yaml:"web"`
 	DB            db.Config        `yaml:"db"`
 	SMTP          email.SMTPConfig `yaml:"smtp"`
 	JWT           auth.JWTConfig   `yaml:"jwt"`
+	MFA           MFAConfig        `yaml:"mfa"`
+	Health        health.Config    `yaml:"health"`
+	Metrics       metrics.Config   `yaml:"metrics"`
+	Tracing       tracing.Config   `yaml:"tracing"`
+}
+
+type MFAConfig struct {
+	// Issuer is the name authenticator apps show next to the account.
+	Issuer string `default:"Gobase" yaml:"issuer"`
 }
 
 type WebConfig struct {
 	Port        string `default:"9010" yaml:"port"`
 	CorsEnabled bool   `default:"false" split_words:"true" yaml:"corsEnabled"`
+	// CorsOrigins are the origins allowed to call the API, by default the AppDomainName.
+	CorsOrigins []string      `split_words:"true" yaml:"corsOrigins" reload:"true"`
+	Server      server.Config `yaml:"server"`
 }
 
-func LoadConfig(cfg *Config) error {
-	err := envconfig.Process("", cfg)
+// LoadConfig fills cfg from the defaults, the YAML files selected by opts and the
+// environment, in that order.
+func LoadConfig(cfg *Config, opts pkgconfig.Options) error {
+	err := pkgconfig.Load(cfg, opts)
 	return errutil.Wrap(err, "failed to load config")
 }
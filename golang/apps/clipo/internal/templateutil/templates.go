@@ -2,11 +2,15 @@ package templateutil
 
 import (
 	"bytes"
+	"context"
 	"html/template"
 	"io"
 
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/mmrath/gobase/golang/apps/clipo/internal/generated"
 	"github.com/mmrath/gobase/golang/pkg/errutil"
+	"github.com/mmrath/gobase/golang/pkg/tracing"
 )
 
 type Registry struct {
@@ -31,6 +35,7 @@ func NewRegistry() (*Registry, error) {
 	files := []string{
 		"templates/email/auth/account_activation.gohtml",
 		"templates/email/auth/init_password_reset.gohtml",
+		"templates/email/auth/login_link.gohtml",
 	}
 
 	for _, file := range files {
@@ -54,14 +59,17 @@ func NewRegistry() (*Registry, error) {
 	return &Registry{templateMap: templateMap}, nil
 }
 
-func (t *Registry) Render(w io.Writer, name string, data interface{}) error {
+func (t *Registry) Render(ctx context.Context, w io.Writer, name string, data interface{}) (err error) {
+	_, span := tracing.Start(ctx, "template.render", trace.WithAttributes(tracing.TemplateKey.String(name)))
+	defer func() { tracing.End(span, err) }()
+
 	tmpl := t.templateMap[name]
 
 	if tmpl == nil {
 		return errutil.Errorf("failed to render template %s", name)
 	}
 
-	err := tmpl.Execute(w, data)
+	err = tmpl.Execute(w, data)
 
 	if err != nil {
 		return errutil.Wrapf(err, "failed to render template %s", name)
@@ -69,10 +77,10 @@ func (t *Registry) Render(w io.Writer, name string, data interface{}) error {
 	return nil
 }
 
-func (t *Registry) RenderToString(name string, data interface{}) (string, error) {
+func (t *Registry) RenderToString(ctx context.Context, name string, data interface{}) (string, error) {
 	buf := new(bytes.Buffer)
 
-	err := t.Render(buf, name, data)
+	err := t.Render(ctx, buf, name, data)
 
 	if err != nil {
 		return "", errutil.Wrapf(err, "failed to render template to string %s", name)
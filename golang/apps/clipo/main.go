@@ -4,6 +4,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 
@@ -12,16 +13,26 @@ import (
 )
 
 func main() {
-	version.PrintVersion()
+	cmd.ConfigOptions.RegisterFlags(flag.CommandLine)
+	flag.Parse()
 
-	for _, pair := range os.Environ() {
-		fmt.Println(pair)
+	if flag.NArg() > 0 {
+		if err := cmd.Run(flag.Args()); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
 	}
 
+	version.PrintVersion()
+
 	app, err := cmd.BuildApp()
 	if err != nil {
 		fmt.Printf("Exiting  %v", err)
 		os.Exit(1)
 	}
-	app.Start()
+	if err := app.Run(); err != nil {
+		fmt.Printf("Exiting  %v", err)
+		os.Exit(1)
+	}
 }
@@ -104,6 +104,8 @@ func cleanDB(db *sql.DB) {
 		"TRUNCATE TABLE user_role CASCADE",
 		"TRUNCATE TABLE role CASCADE",
 		"TRUNCATE TABLE user_credential CASCADE",
+		"TRUNCATE TABLE auth_token CASCADE",
+		"TRUNCATE TABLE user_session CASCADE",
 		"TRUNCATE TABLE permission CASCADE",
 		"TRUNCATE TABLE user_account CASCADE",
 		"TRUNCATE TABLE notification CASCADE",
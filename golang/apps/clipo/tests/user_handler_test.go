@@ -16,6 +16,7 @@ import (
 
 	"github.com/mmrath/gobase/golang/apps/clipo/cmd"
 	"github.com/mmrath/gobase/golang/pkg/crypto"
+	"github.com/mmrath/gobase/golang/pkg/otp"
 	"github.com/mmrath/gobase/golang/pkg/testutil"
 
 	"github.com/mmrath/gobase/golang/pkg/model"
@@ -374,6 +375,264 @@ func (s *AccountTestSuite) TestUpdateProfileForLoggedInUser() {
 
 }
 
+func (s *AccountTestSuite) TestRefreshTokenRotation() {
+	testEmail := gofakeit.Email()
+	password := gofakeit.Password(true, true, true, true, true, 8)
+	s.createUser(testEmail, password)
+	defer s.deleteUser(testEmail)
+
+	he := httpexpect.New(s.T(), s.AppURL)
+
+	resp := he.POST(apiPath("/account/login")).
+		WithJSON(model.LoginRequest{Email: testEmail, Password: password}).
+		Expect()
+	resp.Status(http.StatusOK)
+	refreshToken := resp.JSON().Path("$.refreshToken").String().NotEmpty().Raw()
+
+	resp = he.POST(apiPath("/account/token/refresh")).
+		WithJSON(map[string]string{"refreshToken": refreshToken}).
+		Expect()
+	resp.Status(http.StatusOK)
+	rotatedToken := resp.JSON().Path("$.refreshToken").String().NotEqual(refreshToken).Raw()
+	jwtCookie := resp.Cookie("jwt").Value().Raw()
+
+	he.GET(apiPath("/account/profile")).
+		WithCookie("jwt", jwtCookie).
+		Expect().
+		Status(http.StatusOK)
+
+	// Reusing a rotated token revokes the whole family
+	resp = he.POST(apiPath("/account/token/refresh")).
+		WithJSON(map[string]string{"refreshToken": refreshToken}).
+		Expect()
+	resp.Status(http.StatusUnauthorized)
+	resp.JSON().Path("$.errors[0]").Equal("invalid refresh token")
+
+	he.POST(apiPath("/account/token/refresh")).
+		WithJSON(map[string]string{"refreshToken": rotatedToken}).
+		Expect().
+		Status(http.StatusUnauthorized)
+
+	he.GET(apiPath("/account/profile")).
+		WithCookie("jwt", jwtCookie).
+		Expect().
+		Status(http.StatusUnauthorized)
+}
+
+func (s *AccountTestSuite) TestLogoutRevokesSession() {
+	testEmail := gofakeit.Email()
+	password := gofakeit.Password(true, true, true, true, true, 8)
+	s.createUser(testEmail, password)
+	defer s.deleteUser(testEmail)
+
+	he := httpexpect.New(s.T(), s.AppURL)
+
+	resp := he.POST(apiPath("/account/login")).
+		WithJSON(model.LoginRequest{Email: testEmail, Password: password}).
+		Expect()
+	resp.Status(http.StatusOK)
+	jwtCookie := resp.Cookie("jwt").Value().Raw()
+	refreshCookie := resp.Cookie("refresh_token").Value().Raw()
+
+	he.POST(apiPath("/account/logout")).
+		WithCookie("refresh_token", refreshCookie).
+		Expect().
+		Status(http.StatusOK)
+
+	he.GET(apiPath("/account/profile")).
+		WithCookie("jwt", jwtCookie).
+		Expect().
+		Status(http.StatusUnauthorized)
+
+	he.POST(apiPath("/account/token/refresh")).
+		WithCookie("refresh_token", refreshCookie).
+		Expect().
+		Status(http.StatusUnauthorized)
+}
+
+func (s *AccountTestSuite) TestLogoutWithBearerToken() {
+	testEmail := gofakeit.Email()
+	password := gofakeit.Password(true, true, true, true, true, 8)
+	s.createUser(testEmail, password)
+	defer s.deleteUser(testEmail)
+
+	he := httpexpect.New(s.T(), s.AppURL)
+
+	resp := he.POST(apiPath("/account/login")).
+		WithJSON(model.LoginRequest{Email: testEmail, Password: password}).
+		Expect()
+	resp.Status(http.StatusOK)
+	jwtCookie := resp.Cookie("jwt").Value().Raw()
+	refreshCookie := resp.Cookie("refresh_token").Value().Raw()
+
+	// clients keeping the access token themselves send neither cookie
+	he.POST(apiPath("/account/logout")).
+		WithHeader("Authorization", "Bearer "+jwtCookie).
+		Expect().
+		Status(http.StatusOK)
+
+	he.POST(apiPath("/account/token/refresh")).
+		WithCookie("refresh_token", refreshCookie).
+		Expect().
+		Status(http.StatusUnauthorized)
+}
+
+func (s *AccountTestSuite) TestTOTPLogin() {
+	testEmail := gofakeit.Email()
+	password := gofakeit.Password(true, true, true, true, true, 8)
+	s.createUser(testEmail, password)
+	defer s.deleteUser(testEmail)
+
+	he := httpexpect.New(s.T(), s.AppURL)
+
+	resp := he.POST(apiPath("/account/login")).
+		WithJSON(model.LoginRequest{Email: testEmail, Password: password}).
+		Expect()
+	resp.Status(http.StatusOK)
+	jwtCookie := resp.Cookie("jwt").Value().Raw()
+
+	resp = he.POST(apiPath("/account/mfa/totp/enroll")).
+		WithCookie("jwt", jwtCookie).
+		Expect()
+	resp.Status(http.StatusOK)
+	secret := resp.JSON().Path("$.secret").String().NotEmpty().Raw()
+	resp.JSON().Path("$.uri").String().Contains("otpauth://totp/")
+
+	code, err := otp.Code(secret, otp.TimeStep(time.Now()))
+	require.NoError(s.T(), err)
+
+	resp = he.POST(apiPath("/account/mfa/totp/confirm")).
+		WithCookie("jwt", jwtCookie).
+		WithJSON(map[string]string{"code": code}).
+		Expect()
+	resp.Status(http.StatusOK)
+	recoveryCodes := resp.JSON().Path("$.recoveryCodes").Array()
+	recoveryCodes.Length().Equal(10)
+	recoveryCode := recoveryCodes.First().String().Raw()
+
+	// the password alone no longer logs in
+	resp = he.POST(apiPath("/account/login")).
+		WithJSON(model.LoginRequest{Email: testEmail, Password: password}).
+		Expect()
+	resp.Status(http.StatusOK)
+	resp.Cookies().Empty()
+	resp.JSON().Path("$.mfaRequired").Equal(true)
+	mfaToken := resp.JSON().Path("$.mfaToken").String().NotEmpty().Raw()
+
+	he.GET(apiPath("/account/profile")).
+		WithHeader("Authorization", "Bearer "+mfaToken).
+		Expect().
+		Status(http.StatusUnauthorized)
+
+	// the code used for confirmation cannot be replayed
+	he.POST(apiPath("/account/login/mfa")).
+		WithJSON(map[string]string{"mfaToken": mfaToken, "code": code}).
+		Expect().
+		Status(http.StatusUnauthorized)
+
+	resp = he.POST(apiPath("/account/login/mfa")).
+		WithJSON(map[string]string{"mfaToken": mfaToken, "code": recoveryCode}).
+		Expect()
+	resp.Status(http.StatusOK)
+	resp.JSON().Path("$.accessToken").String().NotEmpty()
+
+	// recovery codes are single use
+	he.POST(apiPath("/account/login/mfa")).
+		WithJSON(map[string]string{"mfaToken": mfaToken, "code": recoveryCode}).
+		Expect().
+		Status(http.StatusUnauthorized)
+}
+
+func (s *AccountTestSuite) TestMagicLogin() {
+	testEmail := gofakeit.Email()
+	s.createUser(testEmail, gofakeit.Password(true, true, true, true, true, 8))
+	defer s.deleteUser(testEmail)
+
+	he := httpexpect.New(s.T(), s.AppURL)
+
+	// unknown addresses are not reported
+	he.POST(apiPath("/account/login/magic")).
+		WithJSON(map[string]string{"email": gofakeit.Email()}).
+		Expect().
+		Status(http.StatusOK)
+
+	he.POST(apiPath("/account/login/magic")).
+		WithJSON(map[string]string{"email": testEmail}).
+		Expect().
+		Status(http.StatusOK)
+
+	msg := s.EmailClient.GetLatestEmail(testEmail)
+	require.NotNil(s.T(), msg)
+	require.Equal(s.T(), "Your login link", msg.Subject)
+	key := regexp.MustCompile(`/account/login/magic\?key=([A-Za-z0-9_\-]+)`).FindStringSubmatch(msg.HTML)[1]
+	code := regexp.MustCompile(`<strong>([0-9]{6})</strong>`).FindStringSubmatch(msg.HTML)[1]
+
+	resp := he.POST(apiPath("/account/login/magic/verify")).
+		WithJSON(map[string]string{"key": key}).
+		Expect()
+	resp.Status(http.StatusOK)
+	resp.JSON().Path("$.accessToken").String().NotEmpty()
+
+	// the link and the code are single use
+	he.POST(apiPath("/account/login/magic/verify")).
+		WithJSON(map[string]string{"key": key}).
+		Expect().
+		Status(http.StatusUnauthorized)
+	he.POST(apiPath("/account/login/magic/verify")).
+		WithJSON(map[string]string{"email": testEmail, "code": code}).
+		Expect().
+		Status(http.StatusUnauthorized)
+}
+
+func (s *AccountTestSuite) TestMagicLoginCodeAttemptsSurviveReissue() {
+	testEmail := gofakeit.Email()
+	s.createUser(testEmail, gofakeit.Password(true, true, true, true, true, 8))
+	defer s.deleteUser(testEmail)
+
+	he := httpexpect.New(s.T(), s.AppURL)
+	codeRegexp := regexp.MustCompile(`<strong>([0-9]{6})</strong>`)
+	requestCode := func() (key string, code string) {
+		he.POST(apiPath("/account/login/magic")).
+			WithJSON(map[string]string{"email": testEmail}).
+			Expect().
+			Status(http.StatusOK)
+		msg := s.EmailClient.GetLatestEmail(testEmail)
+		require.NotNil(s.T(), msg)
+		key = regexp.MustCompile(`/account/login/magic\?key=([A-Za-z0-9_\-]+)`).FindStringSubmatch(msg.HTML)[1]
+		return key, codeRegexp.FindStringSubmatch(msg.HTML)[1]
+	}
+
+	_, code := requestCode()
+	wrongCode := "000000"
+	if code == wrongCode {
+		wrongCode = "111111"
+	}
+	for i := 0; i < 5; i++ {
+		he.POST(apiPath("/account/login/magic/verify")).
+			WithJSON(map[string]string{"email": testEmail, "code": wrongCode}).
+			Expect().
+			Status(http.StatusUnauthorized)
+	}
+
+	// a new code does not allow more guesses
+	key, code := requestCode()
+	he.POST(apiPath("/account/login/magic/verify")).
+		WithJSON(map[string]string{"email": testEmail, "code": code}).
+		Expect().
+		Status(http.StatusUnauthorized)
+
+	// the link still works and resets the attempts
+	he.POST(apiPath("/account/login/magic/verify")).
+		WithJSON(map[string]string{"key": key}).
+		Expect().
+		Status(http.StatusOK)
+	_, code = requestCode()
+	he.POST(apiPath("/account/login/magic/verify")).
+		WithJSON(map[string]string{"email": testEmail, "code": code}).
+		Expect().
+		Status(http.StatusOK)
+}
+
 func (s *AccountTestSuite) createUser(email string, password string) {
 	stmts := []string{
 		`INSERT INTO public.user_account(
@@ -398,11 +657,13 @@ user_account where email = $3`,
 
 func (s *AccountTestSuite) deleteUser(email string) {
 	stmts := []string{
+		`DELETE FROM auth_token WHERE user_id = (SELECT id FROM user_account where email = $1)`,
+		`DELETE FROM user_recovery_code WHERE user_id = (SELECT id FROM user_account where email = $1)`,
 		`DELETE FROM user_credential WHERE id = (SELECT id FROM user_account where email = $1)`,
 		`DELETE FROM user_account WHERE email = $1`,
 	}
 
-	mustExecStmt(s.DB, stmts[0], email)
-	mustExecStmt(s.DB, stmts[1], email)
-
+	for _, stmt := range stmts {
+		mustExecStmt(s.DB, stmt, email)
+	}
 }
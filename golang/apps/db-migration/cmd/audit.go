@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mmrath/gobase/golang/apps/db-migration/pkg"
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Manage the partitions of the audit log",
+	Long: `audit.logged_actions is partitioned by month. Partitions are created ahead of
+time, by default for 3 months (AUDIT_PREMAKE_MONTHS), and kept for the current
+and 12 previous months (AUDIT_RETENTION_MONTHS). Older partitions are exported
+to AUDIT_ARCHIVE_DIR as gzip compressed NDJSON files and dropped.
+
+"audit archive" creates the partitions before archiving, so scheduling it daily,
+e.g. with cron or a Kubernetes CronJob (see k8s/db-migration-audit.yml), keeps the
+partitions ahead of time. Events logged when no partition of their month existed
+are kept in the default partition and moved to their month's partition once it
+is created.`,
+}
+
+var auditPartitionCmd = &cobra.Command{
+	Use:   "partition",
+	Short: "Create the audit partitions for the coming months",
+	Long:  `Create the audit partitions for the current and the coming months. This also runs after every upgrade.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := pkg.CreateAuditPartitions()
+		if err != nil {
+			fmt.Printf("Error in creating audit partitions: %s", err)
+			// lets schedulers notice the failure
+			os.Exit(1)
+		}
+	},
+}
+
+var auditArchiveCmd = &cobra.Command{
+	Use:   "archive",
+	Short: "Archive and drop audit partitions past the retention period",
+	Long: `Create the audit partitions for the current and the coming months, then export
+audit partitions past the retention period to the archive directory and drop them`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := pkg.ArchiveAuditPartitions()
+		if err != nil {
+			fmt.Printf("Error in archiving audit partitions: %s", err)
+			// lets schedulers notice the failure
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	auditCmd.AddCommand(auditPartitionCmd)
+	auditCmd.AddCommand(auditArchiveCmd)
+	rootCmd.AddCommand(auditCmd)
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mmrath/gobase/golang/apps/db-migration/pkg"
+	"github.com/mmrath/gobase/golang/pkg/config"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the configuration",
+}
+
+var configPrintCmd = &cobra.Command{
+	Use:   "print",
+	Short: "Print the effective configuration",
+	Long: `Print every configuration value with its environment variable, YAML key and
+source, i.e. the default, a config file or an environment variable. Secrets are masked.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := config.Print(os.Stdout, &pkg.Config{}, pkg.ConfigOptions)
+		if err != nil {
+			fmt.Printf("Error in loading config: %s", err)
+		}
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configPrintCmd)
+	rootCmd.AddCommand(configCmd)
+}
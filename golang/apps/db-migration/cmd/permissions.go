@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mmrath/gobase/golang/apps/db-migration/pkg"
+)
+
+var prunePermissions bool
+
+var permissionsCmd = &cobra.Command{
+	Use:   "permissions",
+	Short: "Manage the permission table",
+	Long: `The permissions checked by the applications are declared in their code, e.g. in
+apps/oppo/permissions. The permission table is synced with the declarations, after
+every upgrade if PERMISSIONS_SYNC_ON_UPGRADE is set.`,
+}
+
+var permissionsSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Sync the permission table with the declared permissions",
+	Long: `Create the declared permissions which do not exist and update their descriptions.
+Permissions which are no longer declared are reported. With --prune they are deleted,
+unless they are still granted to a role.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := pkg.SyncPermissions(prunePermissions)
+		if err != nil {
+			fmt.Printf("Error in syncing permissions: %s", err)
+		}
+	},
+}
+
+func init() {
+	permissionsSyncCmd.Flags().BoolVar(&prunePermissions, "prune", false,
+		"delete permissions which are no longer declared and not granted to any role")
+	permissionsCmd.AddCommand(permissionsSyncCmd)
+	rootCmd.AddCommand(permissionsCmd)
+}
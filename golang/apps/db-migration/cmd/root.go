@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"flag"
 	"fmt"
 	"os"
 
@@ -19,15 +20,31 @@ var rootCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		err := pkg.Upgrade()
 		if err != nil {
-			if err == migrate.ErrNoChange {
-				fmt.Print("no changes detected")
+			if err != migrate.ErrNoChange {
+				fmt.Printf("Error in upgrade step: %s", err)
 				return
 			}
-			fmt.Printf("Error in upgrade step: %s", err)
+			fmt.Print("no changes detected")
+		}
+		err = pkg.CreateAuditPartitions()
+		if err != nil {
+			fmt.Printf("Error in creating audit partitions: %s", err)
+		}
+		if pkg.LoadConfig().Permissions.SyncOnUpgrade {
+			err = pkg.SyncPermissions(false)
+			if err != nil {
+				fmt.Printf("Error in syncing permissions: %s", err)
+			}
 		}
 	},
 }
 
+func init() {
+	configFlags := flag.NewFlagSet("config", flag.ContinueOnError)
+	pkg.ConfigOptions.RegisterFlags(configFlags)
+	rootCmd.PersistentFlags().AddGoFlagSet(configFlags)
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mmrath/gobase/golang/apps/db-migration/pkg"
+)
+
+var staffRequest pkg.StaffRequest
+
+var staffCmd = &cobra.Command{
+	Use:   "staff",
+	Short: "Manage staff accounts",
+}
+
+var staffCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create an administrator",
+	Long: `Create an active staff account with the Administrator role, to log in to oppo
+and invite the other staff. The password is read from the first line of stdin.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Print("Password: ")
+		password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && password == "" {
+			fmt.Printf("Error in reading password: %s", err)
+			return
+		}
+		staffRequest.Password = strings.TrimRight(password, "\r\n")
+
+		err = pkg.CreateAdministrator(staffRequest)
+		if err != nil {
+			fmt.Printf("Error in creating administrator: %s", err)
+		}
+	},
+}
+
+func init() {
+	staffCreateCmd.Flags().StringVar(&staffRequest.Email, "email", "", "email to log in with")
+	staffCreateCmd.Flags().StringVar(&staffRequest.FirstName, "first-name", "", "first name")
+	staffCreateCmd.Flags().StringVar(&staffRequest.LastName, "last-name", "", "last name")
+	staffCmd.AddCommand(staffCreateCmd)
+	rootCmd.AddCommand(staffCmd)
+}
@@ -0,0 +1,339 @@
+package pkg
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+
+	"github.com/mmrath/gobase/golang/pkg/db"
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+	"github.com/mmrath/gobase/golang/pkg/model"
+)
+
+// AuditConfig configures the monthly partitions of audit.logged_actions.
+type AuditConfig struct {
+	// RetentionMonths is the number of full months kept in addition to the current one.
+	RetentionMonths int `default:"12" split_words:"true" yaml:"retentionMonths"`
+	// PremakeMonths is the number of months after the current one to create partitions for.
+	PremakeMonths int `default:"3" split_words:"true" yaml:"premakeMonths"`
+	// ArchiveDir is where expired partitions are exported to before they are dropped.
+	ArchiveDir string `default:"audit-archive" split_words:"true" yaml:"archiveDir"`
+}
+
+var partitionNamePattern = regexp.MustCompile(`^logged_actions_y(\d{4})m(\d{2})$`)
+
+type auditPartition struct {
+	Name string
+	From time.Time
+	To   time.Time
+}
+
+func partitionOf(t time.Time) auditPartition {
+	from := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return auditPartition{
+		Name: fmt.Sprintf("logged_actions_y%04dm%02d", from.Year(), from.Month()),
+		From: from,
+		To:   from.AddDate(0, 1, 0),
+	}
+}
+
+func parsePartitionName(name string) (auditPartition, bool) {
+	match := partitionNamePattern.FindStringSubmatch(name)
+	if match == nil {
+		return auditPartition{}, false
+	}
+	year, _ := strconv.Atoi(match[1])
+	month, _ := strconv.Atoi(match[2])
+	if month < 1 || month > 12 {
+		return auditPartition{}, false
+	}
+	return partitionOf(time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)), true
+}
+
+// expiredPartitions returns the partitions which only hold events from before the
+// retention period, oldest first.
+func expiredPartitions(partitions []auditPartition, now time.Time, retentionMonths int) []auditPartition {
+	cutoff := partitionOf(now).From.AddDate(0, -retentionMonths, 0)
+	var expired []auditPartition
+	for _, p := range partitions {
+		if !p.To.After(cutoff) {
+			expired = append(expired, p)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool { return expired[i].From.Before(expired[j].From) })
+	return expired
+}
+
+// CreateAuditPartitions creates the partitions of audit.logged_actions for the current
+// month and the configured number of months ahead.
+func CreateAuditPartitions() error {
+	cfg := LoadConfig()
+	database, err := db.Open(cfg.DB)
+	if err != nil {
+		return err
+	}
+	return createAuditPartitions(database, cfg.Audit, time.Now().UTC())
+}
+
+// createAuditPartitions creates the partitions for the month of now and PremakeMonths
+// months ahead, and for every month with events in the default partition, which
+// are logged there when the partitions were not made in time.
+func createAuditPartitions(database *db.DB, cfg AuditConfig, now time.Time) error {
+	return database.RunInTx(context.Background(), func(tx *db.Tx) error {
+		partitions, err := defaultPartitionMonths(tx)
+		if err != nil {
+			return errutil.Wrap(err, "failed to find the months of the default audit partition")
+		}
+		for i := 0; i <= cfg.PremakeMonths; i++ {
+			partitions = append(partitions, partitionOf(now.AddDate(0, i, 0)))
+		}
+		for _, p := range partitions {
+			if err := createAuditPartitionTx(tx, p); err != nil {
+				return errutil.Wrapf(err, "failed to create audit partition %s", p.Name)
+			}
+		}
+		return nil
+	})
+}
+
+func defaultPartitionMonths(tx *db.Tx) ([]auditPartition, error) {
+	rows, err := tx.Raw(`SELECT DISTINCT date_trunc('month', action_tstamp_tx AT TIME ZONE 'UTC')
+		FROM audit.logged_actions_default`).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var partitions []auditPartition
+	for rows.Next() {
+		var month time.Time
+		if err := rows.Scan(&month); err != nil {
+			return nil, err
+		}
+		partitions = append(partitions, partitionOf(month))
+	}
+	return partitions, rows.Err()
+}
+
+// createAuditPartitionTx creates partition p unless it exists. A partition cannot be
+// created while the default partition holds events of its month, so in that case
+// the default partition is detached, the events are moved and it is attached again.
+func createAuditPartitionTx(tx *db.Tx, p auditPartition) error {
+	table := "audit." + pq.QuoteIdentifier(p.Name)
+	var exists bool
+	err := tx.Raw("SELECT to_regclass(?) IS NOT NULL", table).Row().Scan(&exists)
+	if err != nil || exists {
+		return err
+	}
+
+	// keeps events from being logged into the default partition until the partition exists
+	err = tx.Exec("LOCK TABLE audit.logged_actions_default IN ACCESS EXCLUSIVE MODE").Error
+	if err != nil {
+		return err
+	}
+	var misplaced int
+	err = tx.Raw(`SELECT count(*) FROM audit.logged_actions_default
+		WHERE action_tstamp_tx >= ? AND action_tstamp_tx < ?`, p.From, p.To).Row().Scan(&misplaced)
+	if err != nil {
+		return err
+	}
+
+	create := fmt.Sprintf("CREATE TABLE %s PARTITION OF audit.logged_actions FOR VALUES FROM ('%s') TO ('%s')",
+		table, p.From.Format(time.RFC3339), p.To.Format(time.RFC3339))
+	if misplaced == 0 {
+		return tx.Exec(create).Error
+	}
+
+	stmts := []struct {
+		sql  string
+		args []interface{}
+	}{
+		{sql: "ALTER TABLE audit.logged_actions DETACH PARTITION audit.logged_actions_default"},
+		{sql: create},
+		{sql: `INSERT INTO audit.logged_actions SELECT * FROM audit.logged_actions_default
+			WHERE action_tstamp_tx >= ? AND action_tstamp_tx < ?`, args: []interface{}{p.From, p.To}},
+		{sql: `DELETE FROM audit.logged_actions_default
+			WHERE action_tstamp_tx >= ? AND action_tstamp_tx < ?`, args: []interface{}{p.From, p.To}},
+		{sql: "ALTER TABLE audit.logged_actions ATTACH PARTITION audit.logged_actions_default DEFAULT"},
+	}
+	for _, stmt := range stmts {
+		if err := tx.Exec(stmt.sql, stmt.args...).Error; err != nil {
+			return err
+		}
+	}
+	log.Info().Str("partition", p.Name).Int("events", misplaced).Msg("moved audit events out of the default partition")
+	return nil
+}
+
+// ArchiveAuditPartitions exports the partitions past the retention period to gzip
+// compressed NDJSON files in the archive directory and drops them. A partition is
+// only dropped once its file is completely written.
+func ArchiveAuditPartitions() error {
+	cfg := LoadConfig()
+	database, err := db.Open(cfg.DB)
+	if err != nil {
+		return err
+	}
+
+	// events logged into the default partition are moved to the partition of their
+	// month first, so that they expire with it
+	if err = createAuditPartitions(database, cfg.Audit, time.Now().UTC()); err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(cfg.Audit.ArchiveDir, 0750); err != nil {
+		return errutil.Wrap(err, "failed to create audit archive directory")
+	}
+
+	partitions, err := listAuditPartitions(database)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range expiredPartitions(partitions, time.Now().UTC(), cfg.Audit.RetentionMonths) {
+		file := filepath.Join(cfg.Audit.ArchiveDir, "audit."+p.Name+".ndjson.gz")
+		count, err := exportAuditPartition(database, p, file)
+		if err != nil {
+			return err
+		}
+
+		err = database.RunInTx(context.Background(), func(tx *db.Tx) error {
+			err := tx.Exec("ALTER TABLE audit.logged_actions DETACH PARTITION audit." + pq.QuoteIdentifier(p.Name)).Error
+			if err != nil {
+				return err
+			}
+			return tx.Exec("DROP TABLE audit." + pq.QuoteIdentifier(p.Name)).Error
+		})
+		if err != nil {
+			return errutil.Wrapf(err, "failed to drop audit partition %s", p.Name)
+		}
+		log.Info().Str("partition", p.Name).Str("file", file).Int("events", count).Msg("archived audit partition")
+	}
+	return nil
+}
+
+func listAuditPartitions(database *db.DB) ([]auditPartition, error) {
+	var partitions []auditPartition
+	err := database.RunInTxWithOptions(context.Background(), &sql.TxOptions{ReadOnly: true}, func(tx *db.Tx) error {
+		rows, err := tx.Raw(`SELECT c.relname
+			FROM pg_inherits i
+			JOIN pg_class c ON c.oid = i.inhrelid
+			WHERE i.inhparent = 'audit.logged_actions'::regclass`).Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				return err
+			}
+			// the default partition and partitions not made by us are never archived
+			if p, ok := parsePartitionName(name); ok {
+				partitions = append(partitions, p)
+			}
+		}
+		return rows.Err()
+	})
+	return partitions, errutil.Wrap(err, "failed to list audit partitions")
+}
+
+// exportAuditPartition writes the events of p to file, one JSON object per line,
+// with the hstore columns converted to JSON objects and secrets redacted.
+func exportAuditPartition(database *db.DB, p auditPartition, file string) (count int, err error) {
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return 0, errutil.Wrap(err, "failed to create audit archive file")
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	gz := gzip.NewWriter(tmp)
+	err = database.RunInTxWithOptions(context.Background(), &sql.TxOptions{ReadOnly: true}, func(tx *db.Tx) error {
+		rows, err := tx.Raw(`SELECT to_jsonb(a) || jsonb_build_object(
+				'row_data', hstore_to_jsonb(a.row_data),
+				'changed_fields', hstore_to_jsonb(a.changed_fields))
+			FROM audit.` + pq.QuoteIdentifier(p.Name) + ` a
+			ORDER BY a.event_id`).Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var line []byte
+			if err := rows.Scan(&line); err != nil {
+				return err
+			}
+			line, err = redactArchivedEvent(line)
+			if err != nil {
+				return err
+			}
+			if _, err := gz.Write(append(line, '\n')); err != nil {
+				return err
+			}
+			count++
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return 0, errutil.Wrapf(err, "failed to export audit partition %s", p.Name)
+	}
+
+	if err = gz.Close(); err != nil {
+		return 0, errutil.Wrap(err, "failed to compress audit archive")
+	}
+	if err = tmp.Sync(); err != nil {
+		return 0, errutil.Wrap(err, "failed to write audit archive")
+	}
+	if err = tmp.Close(); err != nil {
+		return 0, errutil.Wrap(err, "failed to write audit archive")
+	}
+	if err = os.Rename(tmp.Name(), file); err != nil {
+		return 0, errutil.Wrap(err, "failed to move audit archive into place")
+	}
+	return count, nil
+}
+
+// redactArchivedEvent redacts the secret columns in the row data and changed fields
+// of an exported event, like they are redacted when the audit trail is viewed.
+func redactArchivedEvent(line []byte) ([]byte, error) {
+	var event map[string]json.RawMessage
+	if err := json.Unmarshal(line, &event); err != nil {
+		return nil, errutil.Wrap(err, "failed to parse audit event")
+	}
+	var table string
+	if err := json.Unmarshal(event["table_name"], &table); err != nil {
+		return nil, errutil.Wrap(err, "failed to parse table of audit event")
+	}
+	for _, key := range []string{"row_data", "changed_fields"} {
+		var data map[string]*string
+		if err := json.Unmarshal(event[key], &data); err != nil {
+			return nil, errutil.Wrapf(err, "failed to parse %s of audit event", key)
+		}
+		if data == nil {
+			continue
+		}
+		model.RedactAuditData(table, data)
+		redacted, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		event[key] = redacted
+	}
+	return json.Marshal(event)
+}
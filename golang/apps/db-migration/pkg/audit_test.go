@@ -0,0 +1,110 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mmrath/gobase/golang/pkg/db"
+	"github.com/mmrath/gobase/golang/pkg/testutil"
+)
+
+func TestPartitionOf(t *testing.T) {
+	p := partitionOf(time.Date(2020, time.December, 31, 23, 0, 0, 0, time.UTC))
+	require.Equal(t, "logged_actions_y2020m12", p.Name)
+	require.Equal(t, time.Date(2020, time.December, 1, 0, 0, 0, 0, time.UTC), p.From)
+	require.Equal(t, time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC), p.To)
+
+	parsed, ok := parsePartitionName(p.Name)
+	require.True(t, ok)
+	require.Equal(t, p, parsed)
+
+	_, ok = parsePartitionName("logged_actions_default")
+	require.False(t, ok)
+}
+
+func TestExpiredPartitions(t *testing.T) {
+	var partitions []auditPartition
+	for _, name := range []string{"logged_actions_y2020m03", "logged_actions_y2019m01", "logged_actions_y2020m02"} {
+		p, ok := parsePartitionName(name)
+		require.True(t, ok)
+		partitions = append(partitions, p)
+	}
+
+	now := time.Date(2020, time.April, 15, 0, 0, 0, 0, time.UTC)
+	expired := expiredPartitions(partitions, now, 1)
+	require.Len(t, expired, 2)
+	require.Equal(t, "logged_actions_y2019m01", expired[0].Name)
+	require.Equal(t, "logged_actions_y2020m02", expired[1].Name)
+}
+
+func TestRedactArchivedEvent(t *testing.T) {
+	line := []byte(`{"event_id": 7, "table_name": "user_credential", "action": "U", ` +
+		`"row_data": {"id": "1", "password_hash": "old", "reset_key": null}, ` +
+		`"changed_fields": {"password_hash": "new"}}`)
+
+	redacted, err := redactArchivedEvent(line)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"event_id": 7, "table_name": "user_credential", "action": "U", `+
+		`"row_data": {"id": "1", "password_hash": "[redacted]", "reset_key": null}, `+
+		`"changed_fields": {"password_hash": "[redacted]"}}`, string(redacted))
+
+	statement := []byte(`{"event_id": 8, "table_name": "user_credential", "action": "T", "row_data": null, "changed_fields": null}`)
+	redacted, err = redactArchivedEvent(statement)
+	require.NoError(t, err)
+	require.JSONEq(t, string(statement), string(redacted))
+}
+
+func TestCreatePartitionOfEventsInDefaultPartition(t *testing.T) {
+	database, err := testutil.OpenDB()
+	if err != nil {
+		t.Skip("database is not available")
+	}
+	defer database.Close()
+
+	// a month no other test or partition job creates
+	p := partitionOf(time.Date(2099, 1, 1, 0, 0, 0, 0, time.UTC))
+	table := "audit." + pq.QuoteIdentifier(p.Name)
+	dropPartition := func() {
+		err := database.RunInTx(context.Background(), func(tx *db.Tx) error {
+			if err := tx.Exec("DROP TABLE IF EXISTS " + table).Error; err != nil {
+				return err
+			}
+			return tx.Exec(`DELETE FROM audit.logged_actions_default
+				WHERE action_tstamp_tx >= ? AND action_tstamp_tx < ?`, p.From, p.To).Error
+		})
+		require.NoError(t, err)
+	}
+	dropPartition()
+	defer dropPartition()
+
+	// events of months without a partition are logged into the default partition
+	err = database.RunInTx(context.Background(), func(tx *db.Tx) error {
+		at := p.From.Add(24 * time.Hour)
+		return tx.Exec(`INSERT INTO audit.logged_actions (schema_name, table_name, relid, session_user_name,
+				action_tstamp_tx, action_tstamp_stm, action_tstamp_clk, action, statement_only)
+			VALUES ('public', 'partition_test', 0, 'test', ?, ?, ?, 'I', false)`, at, at, at).Error
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, createAuditPartitions(database, AuditConfig{}, p.From))
+	// creating existing partitions does nothing
+	require.NoError(t, createAuditPartitions(database, AuditConfig{}, p.From))
+
+	err = database.RunInTx(context.Background(), func(tx *db.Tx) error {
+		var moved, left, attached int
+		require.NoError(t, tx.Raw("SELECT count(*) FROM "+table).Row().Scan(&moved))
+		require.NoError(t, tx.Raw(`SELECT count(*) FROM audit.logged_actions_default
+			WHERE action_tstamp_tx >= ? AND action_tstamp_tx < ?`, p.From, p.To).Row().Scan(&left))
+		require.NoError(t, tx.Raw(`SELECT count(*) FROM pg_inherits
+			WHERE inhrelid = 'audit.logged_actions_default'::regclass`).Row().Scan(&attached))
+		require.Equal(t, 1, moved)
+		require.Equal(t, 0, left)
+		require.Equal(t, 1, attached, "the default partition is attached again")
+		return nil
+	})
+	require.NoError(t, err)
+}
@@ -3,23 +3,28 @@ package pkg
 import (
 	"os"
 
-	"github.com/kelseyhightower/envconfig"
 	"github.com/rs/zerolog/log"
 
+	pkgconfig "github.com/mmrath/gobase/golang/pkg/config"
 	"github.com/mmrath/gobase/golang/pkg/db"
 )
 
 type Config struct {
-	DB           db.Config
-	MigrationDir string `split_words:"true" required:"true"`
+	DB           db.Config         `yaml:"db"`
+	MigrationDir string            `split_words:"true" required:"true" yaml:"migrationDir"`
+	Audit        AuditConfig       `yaml:"audit"`
+	Permissions  PermissionsConfig `yaml:"permissions"`
 }
 
+// ConfigOptions select the configuration files loaded by LoadConfig.
+var ConfigOptions = pkgconfig.OptionsFromEnv("./apps/db-migration/resources/config")
+
 func LoadConfig() Config {
 	cfg := Config{}
-	err := envconfig.Process("", &cfg)
+	err := pkgconfig.Load(&cfg, ConfigOptions)
 
 	if err != nil {
-		log.Error().Err(err).Msg("failed to load env config")
+		log.Error().Err(err).Msg("failed to load config")
 		os.Exit(1)
 	}
 
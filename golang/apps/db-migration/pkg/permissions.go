@@ -0,0 +1,151 @@
+package pkg
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	oppo "github.com/mmrath/gobase/golang/apps/oppo/permissions"
+	"github.com/mmrath/gobase/golang/pkg/auth"
+	"github.com/mmrath/gobase/golang/pkg/db"
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+	"github.com/mmrath/gobase/golang/pkg/model"
+)
+
+// PermissionsConfig configures the sync of the permission table with the
+// permissions declared by the applications.
+type PermissionsConfig struct {
+	// SyncOnUpgrade syncs the permissions after every upgrade.
+	SyncOnUpgrade bool `default:"false" split_words:"true" yaml:"syncOnUpgrade"`
+	// Prune deletes permissions which are no longer declared and not granted to any role.
+	Prune bool `default:"false" yaml:"prune"`
+}
+
+// declaredPermissions are the permissions declared by the applications.
+var declaredPermissions = [][]auth.Permission{
+	oppo.All,
+}
+
+type permissionSyncPlan struct {
+	// upserts are the declared permissions which are new or have a new description.
+	upserts []model.Permission
+	// orphans are the permissions which are no longer declared but still granted to roles.
+	orphans []model.Permission
+	// deletes are the permissions which are no longer declared nor granted, if pruning.
+	deletes []model.Permission
+}
+
+func permissionKey(resource, authority string) string {
+	return strings.ToLower(auth.PermissionName(resource, authority))
+}
+
+// planPermissionSync compares the declared with the existing permissions. Permissions
+// are matched ignoring case, like the unique index of the permission table.
+func planPermissionSync(declared []auth.Permission, existing []model.Permission, granted map[int32]bool, prune bool) (permissionSyncPlan, error) {
+	var plan permissionSyncPlan
+
+	byKey := make(map[string]auth.Permission, len(declared))
+	for _, p := range declared {
+		key := permissionKey(p.Resource, p.Authority)
+		if other, ok := byKey[key]; ok {
+			if other.Description != p.Description {
+				return plan, errutil.Errorf("permission %s is declared twice with different descriptions", p.Name())
+			}
+			continue
+		}
+		byKey[key] = p
+	}
+
+	found := make(map[string]bool, len(existing))
+	for _, e := range existing {
+		key := permissionKey(e.Resource, e.Authority)
+		found[key] = true
+
+		p, ok := byKey[key]
+		switch {
+		case ok && p.Description != e.Description:
+			plan.upserts = append(plan.upserts, model.Permission{
+				ID: e.ID, Resource: p.Resource, Authority: p.Authority, Description: p.Description,
+			})
+		case ok:
+		case granted[e.ID] || !prune:
+			plan.orphans = append(plan.orphans, e)
+		default:
+			plan.deletes = append(plan.deletes, e)
+		}
+	}
+
+	for key, p := range byKey {
+		if !found[key] {
+			plan.upserts = append(plan.upserts, model.Permission{
+				Resource: p.Resource, Authority: p.Authority, Description: p.Description,
+			})
+		}
+	}
+	sort.Slice(plan.upserts, func(i, j int) bool {
+		return permissionKey(plan.upserts[i].Resource, plan.upserts[i].Authority) <
+			permissionKey(plan.upserts[j].Resource, plan.upserts[j].Authority)
+	})
+	return plan, nil
+}
+
+// SyncPermissions creates and updates the permissions declared by the applications.
+// Permissions which are no longer declared are reported, and if prune or
+// PERMISSIONS_PRUNE is set, deleted unless they are still granted to a role.
+func SyncPermissions(prune bool) error {
+	cfg := LoadConfig()
+	prune = prune || cfg.Permissions.Prune
+	database, err := db.Open(cfg.DB)
+	if err != nil {
+		return err
+	}
+
+	var declared []auth.Permission
+	for _, perms := range declaredPermissions {
+		declared = append(declared, perms...)
+	}
+
+	dao := model.NewPermissionDao()
+	return database.RunInTx(context.Background(), func(tx *db.Tx) error {
+		existing, err := dao.FindAll(tx)
+		if err != nil {
+			return errutil.Wrap(err, "failed to find permissions")
+		}
+		grantedIDs, err := dao.FindGrantedIDs(tx)
+		if err != nil {
+			return errutil.Wrap(err, "failed to find granted permissions")
+		}
+		granted := make(map[int32]bool, len(grantedIDs))
+		for _, id := range grantedIDs {
+			granted[id] = true
+		}
+
+		plan, err := planPermissionSync(declared, existing, granted, prune)
+		if err != nil {
+			return err
+		}
+
+		for i := range plan.upserts {
+			p := &plan.upserts[i]
+			if err := dao.Upsert(tx, p); err != nil {
+				return errutil.Wrapf(err, "failed to sync permission %s", auth.PermissionName(p.Resource, p.Authority))
+			}
+			log.Info().Str("permission", auth.PermissionName(p.Resource, p.Authority)).Msg("synced permission")
+		}
+		for _, p := range plan.deletes {
+			if err := dao.Delete(tx, p.ID); err != nil {
+				return errutil.Wrapf(err, "failed to delete permission %s", auth.PermissionName(p.Resource, p.Authority))
+			}
+			log.Info().Str("permission", auth.PermissionName(p.Resource, p.Authority)).Msg("deleted orphaned permission")
+		}
+		for _, p := range plan.orphans {
+			log.Warn().
+				Str("permission", auth.PermissionName(p.Resource, p.Authority)).
+				Bool("granted", granted[p.ID]).
+				Msg("permission is not declared by any application")
+		}
+		return nil
+	})
+}
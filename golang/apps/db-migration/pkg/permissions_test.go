@@ -0,0 +1,48 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/mmrath/gobase/golang/pkg/auth"
+	"github.com/mmrath/gobase/golang/pkg/model"
+)
+
+func TestPlanPermissionSync(t *testing.T) {
+	declared := []auth.Permission{
+		{Resource: "role", Authority: "read", Description: "View roles"},
+		{Resource: "role", Authority: "write", Description: "Create, update and delete roles"},
+		{Resource: "group", Authority: "read", Description: "View user groups"},
+	}
+	existing := []model.Permission{
+		{ID: 1, Resource: "Role", Authority: "read", Description: "View roles"},
+		{ID: 2, Resource: "role", Authority: "write", Description: "Create and update roles"},
+		{ID: 3, Resource: "report", Authority: "read", Description: "View reports"},
+		{ID: 4, Resource: "report", Authority: "write", Description: "Create reports"},
+	}
+	granted := map[int32]bool{1: true, 3: true}
+
+	plan, err := planPermissionSync(declared, existing, granted, false)
+	require.NoError(t, err)
+	require.Equal(t, []model.Permission{
+		{Resource: "group", Authority: "read", Description: "View user groups"},
+		{ID: 2, Resource: "role", Authority: "write", Description: "Create, update and delete roles"},
+	}, plan.upserts)
+	require.Equal(t, []model.Permission{existing[2], existing[3]}, plan.orphans)
+	require.Empty(t, plan.deletes)
+
+	plan, err = planPermissionSync(declared, existing, granted, true)
+	require.NoError(t, err)
+	require.Equal(t, []model.Permission{existing[2]}, plan.orphans)
+	require.Equal(t, []model.Permission{existing[3]}, plan.deletes)
+}
+
+func TestPlanPermissionSyncRejectsConflictingDeclarations(t *testing.T) {
+	declared := []auth.Permission{
+		{Resource: "role", Authority: "read", Description: "View roles"},
+		{Resource: "ROLE", Authority: "read", Description: "Read roles"},
+	}
+	_, err := planPermissionSync(declared, nil, nil, false)
+	require.Error(t, err)
+}
@@ -0,0 +1,29 @@
+package pkg
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/mmrath/gobase/golang/pkg/model"
+)
+
+// The applications check that the database is migrated to model.SchemaVersion,
+// so it has to be raised with every migration.
+func TestSchemaVersionIsLatestMigration(t *testing.T) {
+	dirs, err := ioutil.ReadDir("../resources/migrations")
+	require.NoError(t, err)
+
+	var latest int64
+	for _, dir := range dirs {
+		version, err := strconv.ParseInt(strings.SplitN(dir.Name(), "_", 2)[0], 10, 64)
+		require.NoError(t, err, dir.Name())
+		if version > latest {
+			latest = version
+		}
+	}
+	require.Equal(t, latest, int64(model.SchemaVersion))
+}
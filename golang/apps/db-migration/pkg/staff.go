@@ -0,0 +1,95 @@
+package pkg
+
+import (
+	"context"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/mmrath/gobase/golang/pkg/crypto"
+	"github.com/mmrath/gobase/golang/pkg/db"
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+	"github.com/mmrath/gobase/golang/pkg/model"
+	"github.com/mmrath/gobase/golang/pkg/validate"
+)
+
+// StaffRequest describes an administrator created from the command line.
+type StaffRequest struct {
+	Email     string `validate:"required,email"`
+	FirstName string `validate:"required"`
+	LastName  string `validate:"required"`
+	// Password follows the rules of the oppo login.
+	Password string `validate:"required,min=6,max=20"`
+}
+
+// CreateAdministrator creates an active staff account with the Administrator role.
+// It bootstraps a new installation, where no one can create users in oppo yet.
+func CreateAdministrator(request StaffRequest) error {
+	if err := validate.Struct(request); err != nil {
+		return err
+	}
+
+	cfg := LoadConfig()
+	database, err := db.Open(cfg.DB)
+	if err != nil {
+		return err
+	}
+
+	var user model.User
+	err = database.RunInTx(context.Background(), func(tx *db.Tx) error {
+		user, err = createAdministratorTx(tx, request)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	log.Info().Int64("id", user.ID).Str("email", user.Email).Msg("created administrator")
+	return nil
+}
+
+func createAdministratorTx(tx *db.Tx, request StaffRequest) (model.User, error) {
+	userDao := model.NewUserDao()
+	roleDao := model.NewRoleDao()
+
+	user := model.User{
+		FirstName:   request.FirstName,
+		LastName:    request.LastName,
+		Email:       strings.ToLower(request.Email),
+		AccountType: model.AccountTypeStaff,
+		Active:      true,
+	}
+	exists, err := userDao.ExistsByEmail(tx, user.Email)
+	if err != nil {
+		return user, errutil.Wrap(err, "failed to check if email is already used")
+	}
+	if exists {
+		return user, errutil.Errorf("user with email %s already exists", user.Email)
+	}
+
+	role, err := roleDao.FindByName(tx, model.AdministratorRole)
+	if err != nil {
+		return user, errutil.Wrap(err, "failed to find the administrator role")
+	}
+
+	passwordHash, err := crypto.HashPassword(request.Password)
+	if err != nil {
+		return user, errutil.Wrap(err, "failed to hash password")
+	}
+
+	if err = userDao.Insert(tx, &user); err != nil {
+		return user, errutil.Wrap(err, "failed to create user")
+	}
+	err = model.NewUserCredentialDao().Insert(tx, &model.UserCredential{
+		ID:           user.ID,
+		PasswordHash: passwordHash,
+		Activated:    true,
+	})
+	if err != nil {
+		return user, errutil.Wrap(err, "failed to create user credential")
+	}
+	err = tx.Exec("INSERT INTO user_role(user_id, role_id) VALUES (?, ?)", user.ID, role.ID).Error
+	if err != nil {
+		return user, errutil.Wrap(err, "failed to assign the administrator role")
+	}
+	return user, nil
+}
@@ -0,0 +1,48 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/mmrath/gobase/golang/pkg/credential"
+	"github.com/mmrath/gobase/golang/pkg/db"
+	"github.com/mmrath/gobase/golang/pkg/model"
+	"github.com/mmrath/gobase/golang/pkg/testutil"
+)
+
+func TestCreateAdministrator(t *testing.T) {
+	database, err := testutil.OpenDB()
+	if err != nil {
+		t.Skip("database is not available")
+	}
+	defer database.Close()
+
+	request := StaffRequest{
+		Email:     fmt.Sprintf("Admin-%d@example.com", time.Now().UnixNano()),
+		FirstName: "First",
+		LastName:  "Admin",
+		Password:  "s3cr3t_pw",
+	}
+	err = database.RunInTx(context.Background(), func(tx *db.Tx) error {
+		user, err := createAdministratorTx(tx, request)
+		require.NoError(t, err)
+		require.Equal(t, model.AccountTypeStaff, user.AccountType)
+
+		// the administrator can log in right away
+		_, err = credential.NewVerifier().VerifyTx(tx, model.LoginRequest{Email: user.Email, Password: request.Password})
+		require.NoError(t, err)
+
+		roles, err := model.NewRoleDao().FindNamesByUserID(tx, user.ID)
+		require.NoError(t, err)
+		require.Equal(t, []string{model.AdministratorRole}, roles)
+
+		_, err = createAdministratorTx(tx, request)
+		require.Error(t, err, "emails are unique")
+		return nil
+	})
+	require.NoError(t, err)
+}
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS auth_token_idx_user_id;
+DROP INDEX IF EXISTS auth_token_idx_token_id;
+DROP INDEX IF EXISTS auth_token_idx_family_id;
+
+ALTER TABLE auth_token
+    DROP COLUMN IF EXISTS revoked_at,
+    DROP COLUMN IF EXISTS used_at,
+    DROP COLUMN IF EXISTS token_id,
+    DROP COLUMN IF EXISTS family_id;
@@ -0,0 +1,16 @@
+-- auth_token stores refresh tokens. Every login starts a new family and every
+-- refresh rotates the token within that family, which lets us detect reuse of
+-- an already rotated token and revoke the whole family.
+ALTER TABLE auth_token
+    ADD COLUMN family_id  UUID                     NOT NULL,
+    ADD COLUMN token_id   TEXT                     NOT NULL,
+    ADD COLUMN used_at    TIMESTAMP WITH TIME ZONE NULL,
+    ADD COLUMN revoked_at TIMESTAMP WITH TIME ZONE NULL;
+
+COMMENT ON COLUMN auth_token.token IS 'SHA-256 hash of the opaque refresh token';
+COMMENT ON COLUMN auth_token.family_id IS 'Identifies all tokens rotated from the same login';
+COMMENT ON COLUMN auth_token.token_id IS 'jti of the access token issued together with this refresh token';
+
+CREATE INDEX auth_token_idx_family_id ON auth_token (family_id);
+CREATE INDEX auth_token_idx_token_id ON auth_token (token_id);
+CREATE INDEX auth_token_idx_user_id ON auth_token (user_id);
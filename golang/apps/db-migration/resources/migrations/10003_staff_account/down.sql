@@ -0,0 +1,19 @@
+DELETE
+FROM role_permission
+WHERE role_id IN (SELECT id FROM role WHERE name = 'Administrator');
+
+DELETE
+FROM user_role
+WHERE role_id IN (SELECT id FROM role WHERE name = 'Administrator');
+
+DELETE
+FROM role
+WHERE name = 'Administrator';
+
+DELETE
+FROM permission
+WHERE (resource, authority) IN (('role', 'read'), ('role', 'write'), ('user', 'read'), ('user', 'write'));
+
+ALTER TABLE user_account
+    ALTER COLUMN account_type DROP NOT NULL,
+    ALTER COLUMN account_type DROP DEFAULT;
@@ -0,0 +1,29 @@
+-- account_type separates customers (0), who sign up through clipo, from staff (1),
+-- who log in to oppo.
+UPDATE user_account
+SET account_type = 0,
+    updated_by   = 'migration'
+WHERE account_type IS NULL;
+
+ALTER TABLE user_account
+    ALTER COLUMN account_type SET DEFAULT 0,
+    ALTER COLUMN account_type SET NOT NULL;
+
+COMMENT ON COLUMN user_account.account_type IS '0 = customer, 1 = staff';
+
+-- permissions checked by oppo
+INSERT INTO permission (resource, authority, description)
+VALUES ('role', 'read', 'View roles'),
+       ('role', 'write', 'Create and update roles'),
+       ('user', 'read', 'View user accounts'),
+       ('user', 'write', 'Create and update user accounts');
+
+INSERT INTO role (updated_by, name, description)
+VALUES ('migration', 'Administrator', 'Full access to oppo');
+
+INSERT INTO role_permission (role_id, permission_id)
+SELECT r.id, p.id
+FROM role r,
+     permission p
+WHERE r.name = 'Administrator'
+  AND (p.resource, p.authority) IN (('role', 'read'), ('role', 'write'), ('user', 'read'), ('user', 'write'));
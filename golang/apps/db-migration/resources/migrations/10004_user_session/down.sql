@@ -0,0 +1,9 @@
+DELETE
+FROM role_permission
+WHERE permission_id IN (SELECT id FROM permission WHERE resource = 'session');
+
+DELETE
+FROM permission
+WHERE resource = 'session';
+
+DROP TABLE IF EXISTS user_session;
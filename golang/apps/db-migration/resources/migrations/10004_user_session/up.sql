@@ -0,0 +1,34 @@
+-- user_session backs the server side sessions of oppo. The cookie only carries
+-- the session token, of which just the hash is stored here.
+CREATE TABLE user_session
+(
+    id               BIGINT GENERATED ALWAYS AS IDENTITY,
+    token            TEXT                     NOT NULL,
+    user_id          BIGINT                   NULL,
+    data             BYTEA                    NOT NULL,
+    created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_accessed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at       TIMESTAMP WITH TIME ZONE NOT NULL,
+    ip_address       TEXT                     NULL,
+    user_agent       TEXT                     NULL,
+    CONSTRAINT user_session_pk PRIMARY KEY (id),
+    CONSTRAINT user_session_uk_token UNIQUE (token),
+    CONSTRAINT user_session_fk_01 FOREIGN KEY (user_id) REFERENCES user_account (id)
+);
+
+COMMENT ON COLUMN user_session.token IS 'SHA-256 hash of the session token';
+COMMENT ON COLUMN user_session.expires_at IS 'Absolute expiry, independent of activity';
+
+CREATE INDEX user_session_idx_user_id ON user_session (user_id);
+CREATE INDEX user_session_idx_expires_at ON user_session (expires_at);
+
+INSERT INTO permission (resource, authority, description)
+VALUES ('session', 'read', 'View active sessions'),
+       ('session', 'write', 'Terminate sessions');
+
+INSERT INTO role_permission (role_id, permission_id)
+SELECT r.id, p.id
+FROM role r,
+     permission p
+WHERE r.name = 'Administrator'
+  AND p.resource = 'session';
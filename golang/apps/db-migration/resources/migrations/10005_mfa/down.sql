@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS user_recovery_code;
+
+SELECT audit.audit_table('user_credential');
+
+ALTER TABLE user_credential
+    DROP COLUMN IF EXISTS totp_last_used_step,
+    DROP COLUMN IF EXISTS totp_enabled,
+    DROP COLUMN IF EXISTS totp_secret;
@@ -0,0 +1,30 @@
+-- TOTP second factor. The secret is stored once enrollment starts, but only
+-- enforced at login after the user confirmed it with a valid code.
+ALTER TABLE user_credential
+    ADD COLUMN totp_secret         TEXT    NULL,
+    ADD COLUMN totp_enabled        BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN totp_last_used_step BIGINT  NULL;
+
+COMMENT ON COLUMN user_credential.totp_last_used_step IS 'Time step of the last accepted code, to reject replays';
+
+-- the secret must not be copied into the audit log, where it would be kept in
+-- plain text for the retention period. Starting an enrollment is therefore not
+-- audited, only confirming it, which sets totp_enabled.
+SELECT audit.audit_table('user_credential', true, true, ARRAY ['totp_secret']);
+
+-- one-time recovery codes for users who lost their authenticator
+CREATE TABLE user_recovery_code
+(
+    id         BIGINT GENERATED ALWAYS AS IDENTITY,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    user_id    BIGINT                   NOT NULL,
+    code_hash  TEXT                     NOT NULL,
+    used_at    TIMESTAMP WITH TIME ZONE NULL,
+    CONSTRAINT user_recovery_code_pk PRIMARY KEY (id),
+    CONSTRAINT user_recovery_code_fk_01 FOREIGN KEY (user_id) REFERENCES user_account (id)
+);
+
+COMMENT ON COLUMN user_recovery_code.code_hash IS 'SHA-256 hash of the recovery code';
+
+CREATE INDEX user_recovery_code_idx_user_id ON user_recovery_code (user_id);
+SELECT audit.audit_table('user_recovery_code');
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS user_credential_uk_login_key;
+
+ALTER TABLE user_credential
+    DROP COLUMN IF EXISTS login_code_attempts,
+    DROP COLUMN IF EXISTS login_key_expires_at,
+    DROP COLUMN IF EXISTS login_code,
+    DROP COLUMN IF EXISTS login_key;
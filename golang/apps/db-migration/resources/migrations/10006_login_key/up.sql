@@ -0,0 +1,12 @@
+-- passwordless login: a single email carries a link with login_key and a short
+-- code, either of which logs the user in once before login_key_expires_at.
+ALTER TABLE user_credential
+    ADD COLUMN login_key            TEXT                     NULL,
+    ADD COLUMN login_code           TEXT                     NULL,
+    ADD COLUMN login_key_expires_at TIMESTAMP WITH TIME ZONE NULL,
+    ADD COLUMN login_code_attempts  INT                      NOT NULL DEFAULT 0;
+
+COMMENT ON COLUMN user_credential.login_key IS 'SHA-256 hash of the magic link token';
+COMMENT ON COLUMN user_credential.login_code IS 'SHA-256 hash of the email login code';
+
+CREATE UNIQUE INDEX user_credential_uk_login_key ON user_credential (login_key) WHERE login_key IS NOT NULL;
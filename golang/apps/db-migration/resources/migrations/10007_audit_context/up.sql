@@ -0,0 +1,114 @@
+-- updated_by is filled from the application user of the transaction, set by the
+-- applications with set_config('app.user_id', ..., true). Without one, the value
+-- given by the statement is kept.
+CREATE OR REPLACE FUNCTION auto_set_audit_columns()
+    RETURNS trigger AS
+$$
+DECLARE
+    app_user_id TEXT := nullif(current_setting('app.user_id', true), '');
+BEGIN
+    IF (TG_OP = 'INSERT')
+    THEN
+        NEW.updated_by := coalesce(app_user_id, nullif(NEW.updated_by, ''), session_user);
+    ELSIF (NEW IS DISTINCT FROM OLD)
+    THEN
+        NEW.updated_at := current_timestamp;
+        NEW.version := OLD.version + 1;
+        NEW.updated_by := coalesce(app_user_id, nullif(NEW.updated_by, ''), session_user);
+    END IF;
+    RETURN NEW;
+END;
+$$
+    LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION auto_manage_updated_at_and_version(_tbl regclass)
+    RETURNS VOID AS
+$$
+BEGIN
+    EXECUTE format('DROP TRIGGER IF EXISTS set_updated_at ON %s', _tbl);
+    EXECUTE format('CREATE TRIGGER set_updated_at BEFORE INSERT OR UPDATE ON %s
+                      FOR EACH ROW EXECUTE PROCEDURE auto_set_audit_columns()', _tbl);
+END;
+$$
+    LANGUAGE plpgsql;
+
+SELECT auto_manage_updated_at_and_version('user_account');
+SELECT auto_manage_updated_at_and_version('user_credential');
+SELECT auto_manage_updated_at_and_version('role');
+
+-- the audit log records the application user and request of each change, taken
+-- from the app.user_id and app.request_id settings of the transaction
+ALTER TABLE audit.logged_actions
+    ADD COLUMN IF NOT EXISTS app_user_id TEXT,
+    ADD COLUMN IF NOT EXISTS request_id  TEXT;
+
+COMMENT ON COLUMN audit.logged_actions.app_user_id IS 'Id of the application user who made the change, from the app.user_id setting of the transaction';
+COMMENT ON COLUMN audit.logged_actions.request_id IS 'Id of the HTTP request which made the change, from the app.request_id setting of the transaction';
+
+CREATE OR REPLACE FUNCTION audit.if_modified_func() RETURNS TRIGGER AS $body$
+DECLARE
+    audit_row audit.logged_actions;
+    include_values boolean;
+    log_diffs boolean;
+    h_old hstore;
+    h_new hstore;
+    excluded_cols text[] = ARRAY[]::text[];
+BEGIN
+    IF TG_WHEN <> 'AFTER' THEN
+        RAISE EXCEPTION 'audit.if_modified_func() may only run as an AFTER trigger';
+    END IF;
+
+    audit_row = ROW(
+        nextval('audit.logged_actions_event_id_seq'), -- event_id
+        TG_TABLE_SCHEMA::text,                        -- schema_name
+        TG_TABLE_NAME::text,                          -- table_name
+        TG_RELID,                                     -- relation OID for much quicker searches
+                session_user::text,                           -- session_user_name
+                current_timestamp,                            -- action_tstamp_tx
+        statement_timestamp(),                        -- action_tstamp_stm
+        clock_timestamp(),                            -- action_tstamp_clk
+        txid_current(),                               -- transaction ID
+        current_setting('application_name'),          -- client application
+        inet_client_addr(),                           -- client_addr
+        inet_client_port(),                           -- client_port
+        current_query(),                              -- top-level query or queries (if multistatement) from client
+        substring(TG_OP,1,1),                         -- action
+        NULL, NULL,                                   -- row_data, changed_fields
+        'f',                                          -- statement_only
+        nullif(current_setting('app.user_id', true), ''),    -- application user
+        nullif(current_setting('app.request_id', true), '')  -- request id
+        );
+
+    IF NOT TG_ARGV[0]::boolean IS DISTINCT FROM 'f'::boolean THEN
+        audit_row.client_query = NULL;
+    END IF;
+
+    IF TG_ARGV[1] IS NOT NULL THEN
+        excluded_cols = TG_ARGV[1]::text[];
+    END IF;
+
+    IF (TG_OP = 'UPDATE' AND TG_LEVEL = 'ROW') THEN
+        audit_row.row_data = hstore(OLD.*) - excluded_cols;
+        audit_row.changed_fields =  (hstore(NEW.*) - audit_row.row_data) - excluded_cols;
+        IF audit_row.changed_fields = hstore('') THEN
+            -- All changed fields are ignored. Skip this update.
+            RETURN NULL;
+        END IF;
+    ELSIF (TG_OP = 'DELETE' AND TG_LEVEL = 'ROW') THEN
+        audit_row.row_data = hstore(OLD.*) - excluded_cols;
+    ELSIF (TG_OP = 'INSERT' AND TG_LEVEL = 'ROW') THEN
+        audit_row.row_data = hstore(NEW.*) - excluded_cols;
+    ELSIF (TG_LEVEL = 'STATEMENT' AND TG_OP IN ('INSERT','UPDATE','DELETE','TRUNCATE')) THEN
+        audit_row.statement_only = 't';
+    ELSE
+        RAISE EXCEPTION '[audit.if_modified_func] - Trigger func added as trigger for unhandled case: %, %',TG_OP, TG_LEVEL;
+        RETURN NULL;
+    END IF;
+    INSERT INTO audit.logged_actions VALUES (audit_row.*);
+    RETURN NULL;
+END;
+$body$
+    LANGUAGE plpgsql
+    SECURITY DEFINER
+    SET search_path = pg_catalog, public;
+
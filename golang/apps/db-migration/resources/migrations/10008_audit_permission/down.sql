@@ -0,0 +1,13 @@
+REVOKE SELECT ON audit.logged_actions FROM oppo;
+REVOKE USAGE ON SCHEMA audit FROM oppo;
+
+DROP INDEX IF EXISTS audit.logged_actions_app_user_id_idx;
+DROP INDEX IF EXISTS audit.logged_actions_table_name_row_id_idx;
+
+DELETE
+FROM role_permission
+WHERE permission_id IN (SELECT id FROM permission WHERE resource = 'audit');
+
+DELETE
+FROM permission
+WHERE resource = 'audit';
@@ -0,0 +1,17 @@
+INSERT INTO permission (resource, authority, description)
+VALUES ('audit', 'read', 'View the audit trail');
+
+INSERT INTO role_permission (role_id, permission_id)
+SELECT r.id, p.id
+FROM role r,
+     permission p
+WHERE r.name = 'Administrator'
+  AND p.resource = 'audit';
+
+-- for looking up the history of a row, and the changes made by a user
+CREATE INDEX IF NOT EXISTS logged_actions_table_name_row_id_idx ON audit.logged_actions (table_name, (row_data -> 'id'));
+CREATE INDEX IF NOT EXISTS logged_actions_app_user_id_idx ON audit.logged_actions (app_user_id);
+
+-- oppo shows the audit trail to support staff
+GRANT USAGE ON SCHEMA audit TO oppo;
+GRANT SELECT ON audit.logged_actions TO oppo;
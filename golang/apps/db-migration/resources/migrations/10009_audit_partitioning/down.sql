@@ -0,0 +1,27 @@
+ALTER TABLE audit.logged_actions RENAME TO logged_actions_partitioned;
+ALTER INDEX audit.logged_actions_pkey RENAME TO logged_actions_partitioned_pkey;
+
+CREATE TABLE audit.logged_actions
+(
+    LIKE audit.logged_actions_partitioned INCLUDING DEFAULTS INCLUDING CONSTRAINTS INCLUDING COMMENTS,
+    PRIMARY KEY (event_id)
+);
+
+COMMENT ON TABLE audit.logged_actions IS 'History of auditable actions on audited tables, from audit.if_modified_func()';
+REVOKE ALL ON audit.logged_actions FROM public;
+GRANT SELECT ON audit.logged_actions TO oppo;
+
+ALTER SEQUENCE audit.logged_actions_event_id_seq OWNED BY audit.logged_actions.event_id;
+
+INSERT INTO audit.logged_actions
+SELECT *
+FROM audit.logged_actions_partitioned;
+
+-- drops all partitions
+DROP TABLE audit.logged_actions_partitioned;
+
+CREATE INDEX logged_actions_relid_idx ON audit.logged_actions (relid);
+CREATE INDEX logged_actions_action_tstamp_tx_stm_idx ON audit.logged_actions (action_tstamp_stm);
+CREATE INDEX logged_actions_action_idx ON audit.logged_actions (action);
+CREATE INDEX logged_actions_table_name_row_id_idx ON audit.logged_actions (table_name, (row_data -> 'id'));
+CREATE INDEX logged_actions_app_user_id_idx ON audit.logged_actions (app_user_id);
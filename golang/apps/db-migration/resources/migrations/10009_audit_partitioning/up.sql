@@ -0,0 +1,50 @@
+-- Partitions audit.logged_actions by month of action_tstamp_tx, so that old events
+-- can be archived and dropped a month at a time, see "db-migration audit --help".
+-- The events logged so far are copied into a partition of their month.
+ALTER TABLE audit.logged_actions RENAME TO logged_actions_unpartitioned;
+ALTER INDEX audit.logged_actions_pkey RENAME TO logged_actions_unpartitioned_pkey;
+
+CREATE TABLE audit.logged_actions
+(
+    LIKE audit.logged_actions_unpartitioned INCLUDING DEFAULTS INCLUDING CONSTRAINTS INCLUDING COMMENTS,
+    PRIMARY KEY (event_id, action_tstamp_tx)
+) PARTITION BY RANGE (action_tstamp_tx);
+
+COMMENT ON TABLE audit.logged_actions IS 'History of auditable actions on audited tables, from audit.if_modified_func()';
+REVOKE ALL ON audit.logged_actions FROM public;
+GRANT SELECT ON audit.logged_actions TO oppo;
+
+-- the event ids continue from the same sequence
+ALTER SEQUENCE audit.logged_actions_event_id_seq OWNED BY audit.logged_actions.event_id;
+
+-- catches events for which no monthly partition exists yet
+CREATE TABLE audit.logged_actions_default PARTITION OF audit.logged_actions DEFAULT;
+
+-- partitions are named and bounded like those made by db-migration
+DO
+$$
+    DECLARE
+        month DATE;
+    BEGIN
+        FOR month IN SELECT DISTINCT date_trunc('month', action_tstamp_tx AT TIME ZONE 'UTC')::DATE
+                     FROM audit.logged_actions_unpartitioned
+            LOOP
+                EXECUTE format('CREATE TABLE audit.%I PARTITION OF audit.logged_actions FOR VALUES FROM (%L) TO (%L)',
+                               to_char(month, '"logged_actions_y"YYYY"m"MM'),
+                               month::TIMESTAMP AT TIME ZONE 'UTC',
+                               (month + INTERVAL '1 month')::TIMESTAMP AT TIME ZONE 'UTC');
+            END LOOP;
+    END
+$$;
+
+INSERT INTO audit.logged_actions
+SELECT *
+FROM audit.logged_actions_unpartitioned;
+
+DROP TABLE audit.logged_actions_unpartitioned;
+
+CREATE INDEX logged_actions_relid_idx ON audit.logged_actions (relid);
+CREATE INDEX logged_actions_action_tstamp_tx_stm_idx ON audit.logged_actions (action_tstamp_stm);
+CREATE INDEX logged_actions_action_idx ON audit.logged_actions (action);
+CREATE INDEX logged_actions_table_name_row_id_idx ON audit.logged_actions (table_name, (row_data -> 'id'));
+CREATE INDEX logged_actions_app_user_id_idx ON audit.logged_actions (app_user_id);
@@ -0,0 +1,9 @@
+DELETE
+FROM role_permission
+WHERE permission_id IN (SELECT id FROM permission WHERE resource = 'group');
+
+DELETE
+FROM permission
+WHERE resource = 'group';
+
+DROP TRIGGER IF EXISTS set_updated_at ON user_group;
@@ -0,0 +1,12 @@
+SELECT auto_manage_updated_at_and_version('user_group');
+
+INSERT INTO permission (resource, authority, description)
+VALUES ('group', 'read', 'View user groups'),
+       ('group', 'write', 'Create and change user groups and their members');
+
+INSERT INTO role_permission (role_id, permission_id)
+SELECT r.id, p.id
+FROM role r,
+     permission p
+WHERE r.name = 'Administrator'
+  AND p.resource = 'group';
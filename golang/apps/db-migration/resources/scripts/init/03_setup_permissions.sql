@@ -2,6 +2,13 @@ GRANT EXECUTE ON ALL FUNCTIONS IN SCHEMA audit TO db_migration;
 GRANT SELECT ON ALL TABLES IN SCHEMA audit TO db_migration;
 GRANT USAGE ON SCHEMA audit TO db_migration;
 
+/* db_migration owns the audit schema and log, so that migrations can change them
+   and grant access to them. Databases initialised before have to run this once
+   as a superuser before upgrading. */
+ALTER SCHEMA audit OWNER TO db_migration;
+ALTER TABLE audit.logged_actions OWNER TO db_migration;
+ALTER FUNCTION audit.if_modified_func() OWNER TO db_migration;
+
 
 /* PUBLIC should not be allowed to execute functions created by db_migration */
 ALTER DEFAULT PRIVILEGES FOR ROLE db_migration REVOKE EXECUTE ON FUNCTIONS FROM PUBLIC;
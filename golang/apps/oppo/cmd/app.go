@@ -2,64 +2,115 @@ package cmd
 
 import (
 	"context"
-	"net/http"
-	"os"
-	"os/signal"
-
-	"github.com/rs/zerolog/log"
 
 	"github.com/mmrath/gobase/golang/apps/oppo/internal/account"
+	"github.com/mmrath/gobase/golang/apps/oppo/internal/audit"
 	"github.com/mmrath/gobase/golang/apps/oppo/internal/config"
+	pkgconfig "github.com/mmrath/gobase/golang/pkg/config"
 	"github.com/mmrath/gobase/golang/pkg/db"
+	"github.com/mmrath/gobase/golang/pkg/email"
+	"github.com/mmrath/gobase/golang/pkg/health"
+	"github.com/mmrath/gobase/golang/pkg/logutil"
+	"github.com/mmrath/gobase/golang/pkg/metrics"
+	"github.com/mmrath/gobase/golang/pkg/model"
+	"github.com/mmrath/gobase/golang/pkg/server"
+	"github.com/mmrath/gobase/golang/pkg/session"
+	"github.com/mmrath/gobase/golang/pkg/templateutil"
+	"github.com/mmrath/gobase/golang/pkg/tracing"
 )
 
+// ConfigOptions select the configuration files loaded by BuildApp. Paths are
+// relative to the golang directory, which the app is run from.
+var ConfigOptions = pkgconfig.OptionsFromEnv("./apps/oppo/resources/config")
+
 type App struct {
-	httpServer *http.Server
+	server *server.Server
 }
 
 func BuildApp() (*App, error) {
 	cfg := config.Config{}
-	err := config.LoadConfig(&cfg)
+	err := config.LoadConfig(&cfg, ConfigOptions)
+	if err != nil {
+		return nil, err
+	}
+	logutil.SetGlobalLevel(cfg.LogLevel)
+
+	shutdownTracing, err := tracing.Setup("oppo", cfg.Tracing)
 	if err != nil {
 		return nil, err
 	}
 
 	database, err := db.Open(cfg.DB)
 
+	if err != nil {
+		return nil, err
+	}
+	metrics.MustReplace(database.StatsCollector())
+
+	sessionStore, err := session.NewStore(database, cfg.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	mailer, err := email.NewMailer(cfg.SMTP)
 	if err != nil {
 		return nil, err
 	}
 
+	templateRegistry, err := templateutil.BuildRegistry(cfg.Web.TemplateDir)
+	if err != nil {
+		return nil, err
+	}
+	notifier := account.NewNotifier(cfg.Web.URL, cfg.SMTP.From, mailer, templateRegistry)
+
+	authHandler := account.NewAuthHandler(account.NewAuthService(database), sessionStore)
 	roleHandler := account.NewRoleHandler(database)
-	userHandler := account.NewUserHandler(database)
+	userHandler := account.NewUserHandler(database, notifier)
+	groupHandler := account.NewGroupHandler(database)
+	sessionHandler := account.NewSessionHandler(sessionStore)
+	auditHandler := audit.NewHandler(database)
+
+	healthService := health.NewService(cfg.Health,
+		health.NewDBChecker(database),
+		health.NewMigrationChecker(database, model.SchemaVersion),
+		health.NewSMTPChecker(cfg.SMTP),
+	)
 
-	httpHandler, err := NewHTTPRouter(cfg.Web, roleHandler, userHandler)
+	corsOrigins := NewCorsOrigins(cfg.Web)
+	httpHandler, err := NewHTTPRouter(cfg.Web, authHandler, roleHandler, userHandler, groupHandler, sessionHandler, auditHandler, healthService, corsOrigins)
 
 	if err != nil {
 		return nil, err
 	}
 
-	httpServer := NewHTTPServer(&cfg, httpHandler)
-	return &App{httpServer: httpServer}, nil
+	srv := server.New(cfg.Web.Port, httpHandler, cfg.Web.Server)
+	// hooks run in reverse order, so spans of the other hooks are flushed too
+	srv.OnShutdown("tracing", shutdownTracing)
+	healthService.SetReadiness(srv.Ready)
+	srv.Go(sessionStore.RunSweeper)
+	srv.Go(NewConfigWatcher(&cfg, notifier, corsOrigins).Run)
+	srv.Go(func(ctx context.Context) {
+		metrics.Serve(ctx, cfg.Metrics)
+	})
+	srv.OnShutdown("db", func(ctx context.Context) error {
+		return database.Close()
+	})
+	return &App{server: srv}, nil
 }
 
-// Start runs ListenAndServe on the http.Server with graceful shutdown.
-func (srv *App) Start() {
-	log.Info().Msg("server starting")
-	go func() {
-		if err := srv.httpServer.ListenAndServe(); err != http.ErrServerClosed {
-			panic(err)
-		}
-	}()
-	log.Info().Interface("address", srv.httpServer.Addr).Msg("server started")
-
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
-	sig := <-quit
-	log.Info().Interface("reason", sig).Msg("server shutting down")
-
-	if err := srv.httpServer.Shutdown(context.Background()); err != nil {
-		panic(err)
-	}
-	log.Info().Msg("server stopped gracefully")
+// NewConfigWatcher returns a watcher applying reloaded settings to the components.
+func NewConfigWatcher(cfg *config.Config, notifier account.Notifier, origins *CorsOrigins) *pkgconfig.Watcher {
+	watcher := pkgconfig.NewWatcher(cfg, ConfigOptions)
+	watcher.Subscribe(func(c interface{}) {
+		cfg := c.(*config.Config)
+		logutil.SetGlobalLevel(cfg.LogLevel)
+		notifier.SetFrom(cfg.SMTP.From)
+		origins.Set(cfg.Web)
+	})
+	return watcher
+}
+
+// Run serves until the process receives SIGINT or SIGTERM and then shuts down gracefully.
+func (app *App) Run() error {
+	return app.server.Run(context.Background())
 }
@@ -1,18 +1,46 @@
 package cmd
 
 import (
+	"flag"
 	"fmt"
 	"os"
+	"strings"
 
+	"github.com/mmrath/gobase/golang/apps/oppo/internal/config"
+	pkgconfig "github.com/mmrath/gobase/golang/pkg/config"
+	"github.com/mmrath/gobase/golang/pkg/errutil"
 	"github.com/mmrath/gobase/golang/pkg/version"
 )
 
+// Run runs the subcommand in args. The only one is "config print", which prints
+// the effective configuration with the source of every value.
+func Run(args []string) error {
+	if len(args) != 2 || args[0] != "config" || args[1] != "print" {
+		return errutil.Errorf("unknown command %q, expected \"config print\"", strings.Join(args, " "))
+	}
+	return pkgconfig.Print(os.Stdout, &config.Config{}, ConfigOptions)
+}
+
 func Main() {
+	ConfigOptions.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	if flag.NArg() > 0 {
+		if err := Run(flag.Args()); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	version.PrintVersion()
 	app, err := BuildApp()
 	if err != nil {
 		fmt.Printf("Exiting  %v", err)
 		os.Exit(1)
 	}
-	app.Start()
+	if err := app.Run(); err != nil {
+		fmt.Printf("Exiting  %v", err)
+		os.Exit(1)
+	}
 }
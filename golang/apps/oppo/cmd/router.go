@@ -3,7 +3,11 @@ package cmd
 import (
 	"compress/flate"
 	"github.com/mmrath/gobase/golang/pkg/health"
+	"github.com/mmrath/gobase/golang/pkg/metrics"
+	"github.com/mmrath/gobase/golang/pkg/tracing"
 	"net/http"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-chi/chi"
@@ -11,12 +15,27 @@ import (
 	"github.com/go-chi/cors"
 	"github.com/go-chi/render"
 	"github.com/mmrath/gobase/golang/apps/oppo/internal/account"
+	"github.com/mmrath/gobase/golang/apps/oppo/internal/audit"
 	"github.com/mmrath/gobase/golang/apps/oppo/internal/config"
+	"github.com/mmrath/gobase/golang/apps/oppo/permissions"
+	"github.com/mmrath/gobase/golang/pkg/auth"
 )
 
-func NewHTTPRouter(webConfig config.WebConfig, rh *account.RoleHandler, uh *account.UserHandler) (http.Handler, error) {
+func NewHTTPRouter(
+	webConfig config.WebConfig,
+	ah account.AuthHandler,
+	rh *account.RoleHandler,
+	uh *account.UserHandler,
+	gh *account.GroupHandler,
+	sh *account.SessionHandler,
+	adh *audit.Handler,
+	hs health.Service,
+	origins *CorsOrigins,
+) (http.Handler, error) {
 	r := chi.NewRouter()
 
+	r.Use(tracing.Middleware)
+	r.Use(metrics.Middleware)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
@@ -26,24 +45,94 @@ func NewHTTPRouter(webConfig config.WebConfig, rh *account.RoleHandler, uh *acco
 
 	// use CORS middleware if client is not served by this api, e.g. from other domain or CDN
 	if webConfig.CorsEnabled {
-		r.Use(corsConfig().Handler)
+		r.Use(corsConfig(origins).Handler)
 	}
 
+	// liveness and readiness probes
+	hs.RegisterRoutes(r)
+
 	r.Route("/oppo/api", func(r chi.Router) {
+		// Public routes
+		r.Group(func(r chi.Router) {
+			r.Post("/auth/login", ah.Login)
+			r.Post("/auth/logout", ah.Logout)
+			r.Post("/auth/invitation/accept", ah.AcceptInvitation)
+			r.Get("/ping", health.PingHandlerFunc)
+		})
+
 		// Protected routes
 		r.Group(func(r chi.Router) {
+			r.Use(ah.Authenticator)
+
 			r.Route("/role", func(r chi.Router) {
-				r.Get("/:id", rh.FindRole)
-				r.Post("/", rh.CreateRole)
-				r.Put("/:id", rh.UpdateRole)
+				r.With(auth.RequirePermission(permissions.ResourceRole, permissions.AuthorityRead)).
+					Get("/", rh.ListRoles)
+				r.With(auth.RequirePermission(permissions.ResourceRole, permissions.AuthorityRead)).
+					Get("/{id}", rh.FindRole)
+				r.With(auth.RequirePermission(permissions.ResourceRole, permissions.AuthorityWrite)).
+					Post("/", rh.CreateRole)
+				r.With(auth.RequirePermission(permissions.ResourceRole, permissions.AuthorityWrite)).
+					Put("/{id}", rh.UpdateRole)
+				r.With(auth.RequirePermission(permissions.ResourceRole, permissions.AuthorityWrite)).
+					Delete("/{id}", rh.DeleteRole)
+				r.With(auth.RequirePermission(permissions.ResourceRole, permissions.AuthorityWrite)).
+					Post("/{id}/clone", rh.CloneRole)
 			})
 
+			r.With(auth.RequirePermission(permissions.ResourceRole, permissions.AuthorityRead)).
+				Get("/permission", rh.ListPermissions)
+
 			r.Route("/account", func(r chi.Router) {
-				r.Get("/:id", uh.FindUser)
-				r.Post("/", uh.CreateUser)
-				r.Put("/:id", uh.UpdateUser)
+				r.With(auth.RequirePermission(permissions.ResourceUser, permissions.AuthorityRead)).
+					Get("/", uh.ListUsers)
+				r.With(auth.RequirePermission(permissions.ResourceUser, permissions.AuthorityRead)).
+					Get("/{id}", uh.FindUser)
+				r.With(auth.RequirePermission(permissions.ResourceUser, permissions.AuthorityRead)).
+					Get("/{id}/authorities", uh.FindAuthorities)
+				r.With(auth.RequirePermission(permissions.ResourceUser, permissions.AuthorityWrite)).
+					Post("/", uh.CreateUser)
+				r.With(auth.RequirePermission(permissions.ResourceUser, permissions.AuthorityWrite)).
+					Put("/{id}", uh.UpdateUser)
+				r.With(auth.RequirePermission(permissions.ResourceUser, permissions.AuthorityWrite)).
+					Post("/{id}/deactivate", uh.DeactivateUser)
+				r.With(auth.RequirePermission(permissions.ResourceUser, permissions.AuthorityWrite)).
+					Post("/{id}/activate", uh.ReactivateUser)
+				r.With(auth.RequirePermission(permissions.ResourceUser, permissions.AuthorityWrite)).
+					Post("/{id}/invitation", uh.ResendInvitation)
 			})
-			r.Get("/ping", health.PingHandlerFunc)
+
+			r.Route("/group", func(r chi.Router) {
+				r.With(auth.RequirePermission(permissions.ResourceGroup, permissions.AuthorityRead)).
+					Get("/", gh.ListGroups)
+				r.With(auth.RequirePermission(permissions.ResourceGroup, permissions.AuthorityRead)).
+					Get("/{id}", gh.FindGroup)
+				r.With(auth.RequirePermission(permissions.ResourceGroup, permissions.AuthorityWrite)).
+					Post("/", gh.CreateGroup)
+				r.With(auth.RequirePermission(permissions.ResourceGroup, permissions.AuthorityWrite)).
+					Put("/{id}", gh.UpdateGroup)
+				r.With(auth.RequirePermission(permissions.ResourceGroup, permissions.AuthorityWrite)).
+					Delete("/{id}", gh.DeleteGroup)
+				r.With(auth.RequirePermission(permissions.ResourceGroup, permissions.AuthorityRead)).
+					Get("/{id}/member", gh.ListMembers)
+				r.With(auth.RequirePermission(permissions.ResourceGroup, permissions.AuthorityWrite)).
+					Post("/{id}/member", gh.UpdateMembers)
+				r.With(auth.RequirePermission(permissions.ResourceGroup, permissions.AuthorityWrite)).
+					Put("/{id}/member/{userId}", gh.AddMember)
+				r.With(auth.RequirePermission(permissions.ResourceGroup, permissions.AuthorityWrite)).
+					Delete("/{id}/member/{userId}", gh.RemoveMember)
+			})
+
+			r.Route("/session", func(r chi.Router) {
+				r.With(auth.RequirePermission(permissions.ResourceSession, permissions.AuthorityRead)).
+					Get("/", sh.ListSessions)
+				r.With(auth.RequirePermission(permissions.ResourceSession, permissions.AuthorityWrite)).
+					Delete("/", sh.TerminateUserSessions)
+				r.With(auth.RequirePermission(permissions.ResourceSession, permissions.AuthorityWrite)).
+					Delete("/{id}", sh.TerminateSession)
+			})
+
+			r.With(auth.RequirePermission(permissions.ResourceAudit, permissions.AuthorityRead)).
+				Get("/audit/event", adh.ListEvents)
 			r.HandleFunc("/*", http.NotFound)
 		})
 	})
@@ -51,16 +140,41 @@ func NewHTTPRouter(webConfig config.WebConfig, rh *account.RoleHandler, uh *acco
 	return r, nil
 }
 
-func corsConfig() *cors.Cors {
-	// Basic CORS
-	// for more ideas, see: https://developer.github.com/v3/#cross-origin-resource-sharing
+// CorsOrigins are the origins allowed by CORS, which can change while serving.
+type CorsOrigins struct {
+	origins atomic.Value
+}
+
+func NewCorsOrigins(cfg config.WebConfig) *CorsOrigins {
+	o := &CorsOrigins{}
+	o.Set(cfg)
+	return o
+}
+
+// Set allows the origins of cfg, or the origin of the URL oppo is served at if there are none.
+func (o *CorsOrigins) Set(cfg config.WebConfig) {
+	origins := cfg.CorsOrigins
+	if len(origins) == 0 {
+		origins = []string{strings.TrimSuffix(cfg.URL, "/")}
+	}
+	o.origins.Store(origins)
+}
+
+func (o *CorsOrigins) allow(r *http.Request, origin string) bool {
+	for _, allowed := range o.origins.Load().([]string) {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func corsConfig(origins *CorsOrigins) *cors.Cors {
 	return cors.New(cors.Options{
-		// AllowedOrigins: []string{"https://foo.com"}, // Use this to allow specific origin hosts
-		AllowedOrigins: []string{"*"},
-		// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
+		AllowOriginFunc:  origins.allow,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-Match"},
+		ExposedHeaders:   []string{"Link", "ETag"},
 		AllowCredentials: true,
 		MaxAge:           86400, // Maximum value not ignored by any of major browsers
 	})
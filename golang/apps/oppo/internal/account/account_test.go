@@ -0,0 +1,165 @@
+package account
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/mmrath/gobase/golang/pkg/auth"
+	"github.com/mmrath/gobase/golang/pkg/crypto"
+	"github.com/mmrath/gobase/golang/pkg/db"
+	"github.com/mmrath/gobase/golang/pkg/email"
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+	"github.com/mmrath/gobase/golang/pkg/model"
+	"github.com/mmrath/gobase/golang/pkg/testutil"
+)
+
+// testDB is nil if the test database is not running, in which case the tests are skipped.
+var testDB *db.DB
+
+func TestMain(m *testing.M) {
+	var err error
+	testDB, err = testutil.OpenDB()
+	if err != nil {
+		fmt.Printf("skipping account db tests, database is not available: %v\n", err)
+		testDB = nil
+	}
+	os.Exit(m.Run())
+}
+
+func setUp(t *testing.T) {
+	if testDB == nil {
+		t.Skip("database is not available")
+	}
+}
+
+var seq int64
+
+// uniqueName returns a name which is not used by any other test run.
+func uniqueName(prefix string) string {
+	return fmt.Sprintf("%s-%d-%d", prefix, time.Now().UnixNano(), atomic.AddInt64(&seq, 1))
+}
+
+// uniqueEmail returns an email which is not used by any other test run.
+func uniqueEmail(prefix string) string {
+	return uniqueName(prefix) + "@example.com"
+}
+
+// createUser creates an active user which logs in with password, or has not
+// chosen a password yet if it is empty.
+func createUser(t *testing.T, accountType model.AccountType, password string) model.User {
+	user := model.User{
+		FirstName:   "Test",
+		LastName:    "User",
+		Email:       uniqueEmail("user"),
+		AccountType: accountType,
+		Active:      true,
+	}
+	credential := model.UserCredential{Activated: password != ""}
+	if password != "" {
+		hash, err := crypto.HashPassword(password)
+		require.NoError(t, err)
+		credential.PasswordHash = hash
+	}
+
+	err := testDB.RunInTx(context.Background(), func(tx *db.Tx) error {
+		if err := model.NewUserDao().Insert(tx, &user); err != nil {
+			return err
+		}
+		credential.ID = user.ID
+		return model.NewUserCredentialDao().Insert(tx, &credential)
+	})
+	require.NoError(t, err)
+	return user
+}
+
+// permissionIDs returns the ids of the permissions named "resource:authority".
+func permissionIDs(t *testing.T, names ...string) []int32 {
+	var perms []model.Permission
+	err := testDB.RunInTx(context.Background(), func(tx *db.Tx) (err error) {
+		perms, err = model.NewPermissionDao().FindAll(tx)
+		return err
+	})
+	require.NoError(t, err)
+
+	var ids []int32
+	for _, name := range names {
+		for _, perm := range perms {
+			if auth.PermissionName(perm.Resource, perm.Authority) == name {
+				ids = append(ids, perm.ID)
+			}
+		}
+	}
+	require.Len(t, ids, len(names))
+	return ids
+}
+
+// createRole creates a role with the named permissions.
+func createRole(t *testing.T, permissions ...string) model.RoleAndPermission {
+	role := model.RoleAndPermission{
+		Role:        model.Role{Name: uniqueName("role"), Description: "Test role"},
+		Permissions: permissionIDs(t, permissions...),
+	}
+	require.NoError(t, NewRoleService(testDB).CreateRole(context.Background(), &role))
+	return role
+}
+
+// setUserRoles replaces the roles assigned to a user directly.
+func setUserRoles(t *testing.T, userID int64, roles ...int32) {
+	err := testDB.RunInTx(context.Background(), func(tx *db.Tx) error {
+		return model.NewRoleDao().SetUserRoles(tx, userID, roles)
+	})
+	require.NoError(t, err)
+}
+
+// allowAll grants every permission.
+type allowAll struct{}
+
+func (allowAll) Can(ctx context.Context, resource, authority string) (bool, error) {
+	return true, nil
+}
+
+func (allowAll) Require(ctx context.Context, resource, authority string) error {
+	return nil
+}
+
+// staffContext is the context of a request by staff with every permission.
+func staffContext(staffID int64) context.Context {
+	ctx := auth.NewAuthContext(context.Background(), staffID)
+	return model.NewAuthorizerContext(ctx, allowAll{})
+}
+
+// fakeNotifier records the invitation tokens instead of sending emails, and
+// fails with err if it is set.
+type fakeNotifier struct {
+	err    error
+	tokens map[int64]string
+}
+
+func newFakeNotifier() *fakeNotifier {
+	return &fakeNotifier{tokens: make(map[int64]string)}
+}
+
+func (n *fakeNotifier) NotifyInvitation(ctx context.Context, user model.User, token string, validFor time.Duration) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.tokens[user.ID] = token
+	return nil
+}
+
+func (n *fakeNotifier) SetFrom(from email.Address) {}
+
+// statusOf returns the HTTP status err is rendered with.
+func statusOf(err error) int {
+	w := httptest.NewRecorder()
+	errutil.RenderError(w, httptest.NewRequest(http.MethodGet, "/", nil), err)
+	return w.Code
+}
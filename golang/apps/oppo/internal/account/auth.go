@@ -1,100 +1,121 @@
 package account
 
 import (
-	"encoding/gob"
 	"net/http"
 
 	"github.com/go-chi/render"
-	"github.com/gorilla/securecookie"
-	"github.com/gorilla/sessions"
+	"github.com/rs/zerolog/log"
 
+	"github.com/mmrath/gobase/golang/pkg/auth"
 	"github.com/mmrath/gobase/golang/pkg/errutil"
 	"github.com/mmrath/gobase/golang/pkg/model"
+	"github.com/mmrath/gobase/golang/pkg/session"
 )
 
-var store *sessions.CookieStore
 var sessionCookieName = "SESSION_ID"
 
-func init() {
-	authKeyOne := securecookie.GenerateRandomKey(64)
-	encryptionKeyOne := securecookie.GenerateRandomKey(32)
-
-	store = sessions.NewCookieStore(
-		authKeyOne,
-		encryptionKeyOne,
-	)
-
-	store.Options = &sessions.Options{
-		Path:     "/",
-		MaxAge:   60 * 15,
-		HttpOnly: true,
-	}
-
-	gob.Register(model.Staff{})
-}
-
 type authHandler struct {
+	service AuthService
+	store   *session.Store
 }
 
 type AuthHandler interface {
 	Login(w http.ResponseWriter, r *http.Request)
 	Logout(w http.ResponseWriter, r *http.Request)
+	AcceptInvitation(w http.ResponseWriter, r *http.Request)
+	Authenticator(next http.Handler) http.Handler
 }
 
-func NewAuthHandler() AuthHandler {
-	return &authHandler{}
+func NewAuthHandler(service AuthService, store *session.Store) AuthHandler {
+	return &authHandler{service: service, store: store}
 }
 
 func (h *authHandler) Login(w http.ResponseWriter, r *http.Request) {
 	data := model.LoginRequest{}
 	if err := render.DecodeJSON(r.Body, &data); err != nil {
-		render.JSON(w, r, err)
+		errutil.RenderError(w, r, errutil.NewBadRequest("invalid login request"))
 		return
 	}
 
-	session, err := store.Get(r, sessionCookieName)
+	staff, err := h.service.Login(r.Context(), data)
 	if err != nil {
 		errutil.RenderError(w, r, err)
 		return
 	}
 
-	if data.Email == "test@test.com" && data.Password == "password" {
-		staff := model.Staff{
-			ID:        1,
-			Email:     data.Email,
-			FirstName: "John",
-			LastName:  "Doe",
-		}
-
-		session.Values["user"] = staff
+	// a cookie which fails to decode, e.g. after its key was dropped, is replaced by a new session
+	sess, _ := h.store.Get(r, sessionCookieName)
+	if err = h.store.Renew(r, sess); err != nil {
+		errutil.RenderError(w, r, err)
+		return
+	}
+	sess.Values[session.UserIDKey] = staff.ID
 
-		err = session.Save(r, w)
-		if err != nil {
-			errutil.RenderError(w, r, err)
-			return
-		}
-		render.Status(r, http.StatusOK)
-		render.JSON(w, r, staff)
+	err = sess.Save(r, w)
+	if err != nil {
+		errutil.RenderError(w, r, err)
 		return
 	}
-	errutil.RenderError(w, r, errutil.NewUnauthorized("invalid username or password"))
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, staff)
 }
 
 func (h *authHandler) Logout(w http.ResponseWriter, r *http.Request) {
-	session, err := store.Get(r, sessionCookieName)
+	sess, _ := h.store.Get(r, sessionCookieName)
+
+	delete(sess.Values, session.UserIDKey)
+	sess.Options.MaxAge = -1
+
+	err := sess.Save(r, w)
 	if err != nil {
 		errutil.RenderError(w, r, err)
 		return
 	}
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, model.Staff{})
+}
 
-	session.Values["user"] = model.Staff{}
-	session.Options.MaxAge = -1
+func (h *authHandler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	data := model.ResetPasswordRequest{}
+	if err := render.DecodeJSON(r.Body, &data); err != nil {
+		errutil.RenderError(w, r, errutil.NewBadRequest("invalid invitation request"))
+		return
+	}
 
-	err = session.Save(r, w)
+	err := h.service.AcceptInvitation(r.Context(), data)
 	if err != nil {
 		errutil.RenderError(w, r, err)
 		return
 	}
 	render.Status(r, http.StatusOK)
-	render.JSON(w, r, model.Staff{})
+	render.JSON(w, r, struct{}{})
+}
+
+// Authenticator rejects requests without a staff session and populates the
+// auth context with the staff id, authorities and authorizer for the handlers
+// and services behind it.
+func (h *authHandler) Authenticator(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess, err := h.store.Get(r, sessionCookieName)
+		if err != nil {
+			log.Info().Err(err).Msg("invalid session cookie")
+		}
+
+		staffID, ok := sess.Values[session.UserIDKey].(int64)
+		if !ok || staffID == 0 {
+			errutil.RenderError(w, r, errutil.NewUnauthorized("user is not logged"))
+			return
+		}
+
+		authorities, err := h.service.FindAuthorities(r.Context(), staffID)
+		if err != nil {
+			errutil.RenderError(w, r, err)
+			return
+		}
+
+		ctx := auth.NewAuthContext(r.Context(), staffID)
+		ctx = auth.NewAuthoritiesContext(ctx, authorities)
+		ctx = model.NewAuthorizerContext(ctx, model.NewAuthoritiesAuthorizer(authorities))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
 }
@@ -0,0 +1,141 @@
+package account
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	"github.com/mmrath/gobase/golang/pkg/auth"
+	"github.com/mmrath/gobase/golang/pkg/credential"
+	"github.com/mmrath/gobase/golang/pkg/crypto"
+	"github.com/mmrath/gobase/golang/pkg/db"
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+	"github.com/mmrath/gobase/golang/pkg/model"
+	"github.com/mmrath/gobase/golang/pkg/validate"
+)
+
+type AuthService interface {
+	Login(ctx context.Context, login model.LoginRequest) (model.Staff, error)
+	FindAuthorities(ctx context.Context, staffID int64) (auth.Authorities, error)
+	AcceptInvitation(ctx context.Context, request model.ResetPasswordRequest) error
+}
+
+type authService struct {
+	db                 *db.DB
+	userDao            model.UserDao
+	roleDao            model.RoleDao
+	permissionDao      model.PermissionDao
+	userCredentialDao  model.UserCredentialDao
+	credentialVerifier *credential.Verifier
+}
+
+func (s *authService) Login(ctx context.Context, login model.LoginRequest) (staff model.Staff, err error) {
+	err = validate.Struct(login)
+	if err != nil {
+		return staff, errutil.Wrap(err, "failed validation")
+	}
+
+	var loginErr error
+	err = s.db.RunInTx(ctx, func(tx *db.Tx) error {
+		staff, loginErr = s.loginTx(tx, login)
+		if errutil.IsClientError(loginErr) {
+			// commit the invalid attempt counter
+			return nil
+		}
+		return loginErr
+	})
+	if err != nil {
+		return staff, err
+	}
+	return staff, loginErr
+}
+
+func (s *authService) loginTx(tx *db.Tx, login model.LoginRequest) (model.Staff, error) {
+	user, err := s.credentialVerifier.VerifyTx(tx, login)
+	if err != nil {
+		return model.Staff{}, err
+	}
+	return model.NewStaff(user), nil
+}
+
+// FindAuthorities returns the authorities of an active staff member. They are
+// resolved on every request, so deactivating staff or revoking a role takes
+// effect immediately.
+func (s *authService) FindAuthorities(ctx context.Context, staffID int64) (authorities auth.Authorities, err error) {
+	err = s.db.RunInTx(ctx, func(tx *db.Tx) error {
+		authorities, err = s.findAuthoritiesTx(tx, staffID)
+		return err
+	})
+	return authorities, err
+}
+
+func (s *authService) findAuthoritiesTx(tx *db.Tx, staffID int64) (auth.Authorities, error) {
+	user, err := s.userDao.Find(tx, staffID)
+	if err != nil {
+		if db.IsNoDataFound(err) {
+			return auth.Authorities{}, errutil.NewUnauthorized("user is not logged")
+		}
+		return auth.Authorities{}, errutil.Wrap(err, "failed to find staff")
+	}
+	if !user.Active || user.AccountType != model.AccountTypeStaff {
+		return auth.Authorities{}, errutil.NewUnauthorized("user is not active")
+	}
+
+	roles, err := s.roleDao.FindNamesByUserID(tx, staffID)
+	if err != nil {
+		return auth.Authorities{}, errutil.Wrap(err, "failed to find roles of staff")
+	}
+	permissions, err := s.permissionDao.FindNamesByUserID(tx, staffID)
+	if err != nil {
+		return auth.Authorities{}, errutil.Wrap(err, "failed to find permissions of staff")
+	}
+	return auth.Authorities{Roles: roles, Permissions: permissions}, nil
+}
+
+// AcceptInvitation sets the password of a user created by an administrator,
+// using the token of the invitation email.
+func (s *authService) AcceptInvitation(ctx context.Context, request model.ResetPasswordRequest) error {
+	err := validate.Struct(request)
+	if err != nil {
+		return err
+	}
+	tokenHash := fmt.Sprintf("%x", sha256.Sum256([]byte(request.ResetToken)))
+
+	return s.db.RunInTx(ctx, func(tx *db.Tx) error {
+		uc, err := s.userCredentialDao.FindByResetKey(tx, tokenHash)
+		if err != nil {
+			if db.IsNoDataFound(err) {
+				return errutil.NewBadRequest("invitation is invalid")
+			}
+			return err
+		}
+		// password reset tokens of clipo share the column, but only users who have
+		// not chosen a password yet were invited
+		if uc.PasswordHash != "" {
+			return errutil.NewBadRequest("invitation is invalid")
+		}
+		if uc.ResetKeyExpiresAt.Before(time.Now()) {
+			return errutil.NewBadRequest("invitation is expired")
+		}
+
+		passwordHash, err := crypto.HashPassword(request.NewPassword)
+		if err != nil {
+			return errutil.Wrap(err, "failed to hash password")
+		}
+		return s.userCredentialDao.ResetPassword(tx, uc.ID, passwordHash)
+	})
+}
+
+func NewAuthService(database *db.DB) AuthService {
+	return &authService{
+		db:                database,
+		userDao:           model.NewUserDao(),
+		roleDao:           model.NewRoleDao(),
+		permissionDao:     model.NewPermissionDao(),
+		userCredentialDao: model.NewUserCredentialDao(),
+		// customers are rejected before their failed attempts are counted, so the
+		// staff login cannot lock their clipo accounts
+		credentialVerifier: credential.NewVerifier().ForAccountType(model.AccountTypeStaff),
+	}
+}
@@ -0,0 +1,139 @@
+package account
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mmrath/gobase/golang/pkg/credential"
+	"github.com/mmrath/gobase/golang/pkg/db"
+	"github.com/mmrath/gobase/golang/pkg/model"
+)
+
+const testPassword = "s3cr3t_pw"
+
+func TestStaffLogin(t *testing.T) {
+	setUp(t)
+	service := NewAuthService(testDB)
+	user := createUser(t, model.AccountTypeStaff, testPassword)
+
+	staff, err := service.Login(context.Background(), model.LoginRequest{Email: user.Email, Password: testPassword})
+	require.NoError(t, err)
+	require.Equal(t, model.NewStaff(user), staff)
+
+	_, err = service.Login(context.Background(), model.LoginRequest{Email: user.Email, Password: "wrong_pw"})
+	require.Equal(t, http.StatusUnauthorized, statusOf(err))
+}
+
+func TestCustomerCannotLogIn(t *testing.T) {
+	setUp(t)
+	service := NewAuthService(testDB)
+	user := createUser(t, model.AccountTypeCustomer, testPassword)
+
+	_, err := service.Login(context.Background(), model.LoginRequest{Email: user.Email, Password: testPassword})
+	require.Equal(t, http.StatusUnauthorized, statusOf(err))
+	require.Contains(t, err.Error(), "invalid email or password", "customers are reported like unknown emails")
+
+	// failed staff logins must not lock the customer's clipo account
+	for i := 0; i <= credential.MaxInvalidAttempts; i++ {
+		_, err = service.Login(context.Background(), model.LoginRequest{Email: user.Email, Password: "wrong_pw"})
+		require.Equal(t, http.StatusUnauthorized, statusOf(err))
+	}
+	var uc model.UserCredential
+	err = testDB.RunInTx(context.Background(), func(tx *db.Tx) (err error) {
+		uc, err = model.NewUserCredentialDao().Get(tx, user.ID)
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, 0, int(uc.InvalidAttempts))
+	require.False(t, uc.Locked)
+}
+
+func TestStaffLockout(t *testing.T) {
+	setUp(t)
+	service := NewAuthService(testDB)
+	user := createUser(t, model.AccountTypeStaff, testPassword)
+
+	for i := 0; i <= credential.MaxInvalidAttempts; i++ {
+		_, err := service.Login(context.Background(), model.LoginRequest{Email: user.Email, Password: "wrong_pw"})
+		require.Equal(t, http.StatusUnauthorized, statusOf(err))
+	}
+
+	// the failed attempts are committed although the logins failed
+	_, err := service.Login(context.Background(), model.LoginRequest{Email: user.Email, Password: testPassword})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "account is locked")
+}
+
+func TestFindAuthoritiesOfStaffOnly(t *testing.T) {
+	setUp(t)
+	service := NewAuthService(testDB)
+
+	staff := createUser(t, model.AccountTypeStaff, testPassword)
+	var admin model.Role
+	err := testDB.RunInTx(context.Background(), func(tx *db.Tx) error {
+		var err error
+		admin, err = model.NewRoleDao().FindByName(tx, model.AdministratorRole)
+		if err != nil {
+			return err
+		}
+		return tx.Exec("INSERT INTO user_role(user_id, role_id) VALUES (?, ?)", staff.ID, admin.ID).Error
+	})
+	require.NoError(t, err)
+
+	authorities, err := service.FindAuthorities(context.Background(), staff.ID)
+	require.NoError(t, err)
+	require.Equal(t, []string{model.AdministratorRole}, authorities.Roles)
+	require.Contains(t, authorities.Permissions, "user:write")
+
+	customer := createUser(t, model.AccountTypeCustomer, testPassword)
+	_, err = service.FindAuthorities(context.Background(), customer.ID)
+	require.Equal(t, http.StatusUnauthorized, statusOf(err))
+
+	// deactivation takes effect on the next request
+	err = testDB.RunInTx(context.Background(), func(tx *db.Tx) error {
+		return tx.Exec("UPDATE user_account SET active = false WHERE id = ?", staff.ID).Error
+	})
+	require.NoError(t, err)
+	_, err = service.FindAuthorities(context.Background(), staff.ID)
+	require.Equal(t, http.StatusUnauthorized, statusOf(err))
+}
+
+func TestAcceptInvitation(t *testing.T) {
+	setUp(t)
+	notifier := newFakeNotifier()
+	created, err := NewUserService(testDB, notifier).CreateUser(context.Background(), newUserRequest())
+	require.NoError(t, err)
+	token := notifier.tokens[created.User.ID]
+
+	service := NewAuthService(testDB)
+	err = service.AcceptInvitation(context.Background(), model.ResetPasswordRequest{ResetToken: token, NewPassword: testPassword})
+	require.NoError(t, err)
+	_, err = service.Login(context.Background(), model.LoginRequest{Email: created.User.Email, Password: testPassword})
+	require.NoError(t, err)
+
+	err = service.AcceptInvitation(context.Background(), model.ResetPasswordRequest{ResetToken: token, NewPassword: "0th3r_pw"})
+	require.Equal(t, http.StatusBadRequest, statusOf(err), "invitations are used once")
+}
+
+func TestAcceptInvitationRejectsResetTokens(t *testing.T) {
+	setUp(t)
+	user := createUser(t, model.AccountTypeCustomer, testPassword)
+
+	// a password reset requested through clipo
+	token := uuid.New().String()
+	tokenHash := fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
+	err := testDB.RunInTx(context.Background(), func(tx *db.Tx) error {
+		return model.NewUserCredentialDao().UpdateResetKey(tx, user.ID, tokenHash, time.Now().Add(time.Hour))
+	})
+	require.NoError(t, err)
+
+	err = NewAuthService(testDB).AcceptInvitation(context.Background(), model.ResetPasswordRequest{ResetToken: token, NewPassword: "0th3r_pw"})
+	require.Equal(t, http.StatusBadRequest, statusOf(err))
+}
@@ -0,0 +1,33 @@
+package account
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+)
+
+// setETag sets the ETag header to the version of an audited entity.
+func setETag(w http.ResponseWriter, version uint32) {
+	w.Header().Set("ETag", fmt.Sprintf(`"%d"`, version))
+}
+
+// expectedVersion returns the version a PUT request expects the entity to have.
+// The If-Match header takes precedence over the version in the request body.
+func expectedVersion(r *http.Request, bodyVersion uint32) (uint32, error) {
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+	if ifMatch == "" {
+		if bodyVersion == 0 {
+			return 0, errutil.NewBadRequest("version is required, send it in the body or the If-Match header")
+		}
+		return bodyVersion, nil
+	}
+
+	version, err := strconv.ParseUint(strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`), 10, 32)
+	if err != nil {
+		return 0, errutil.NewBadRequest("invalid If-Match header")
+	}
+	return uint32(version), nil
+}
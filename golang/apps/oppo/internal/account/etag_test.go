@@ -0,0 +1,57 @@
+package account
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func requestWithIfMatch(ifMatch string) *http.Request {
+	r := httptest.NewRequest(http.MethodPut, "/", nil)
+	if ifMatch != "" {
+		r.Header.Set("If-Match", ifMatch)
+	}
+	return r
+}
+
+func TestExpectedVersion(t *testing.T) {
+	tests := []struct {
+		ifMatch     string
+		bodyVersion uint32
+		version     uint32
+	}{
+		{ifMatch: `"3"`, version: 3},
+		{ifMatch: `"3"`, bodyVersion: 2, version: 3},
+		{ifMatch: `W/"4"`, version: 4},
+		{ifMatch: ` "5" `, version: 5},
+		{ifMatch: "6", version: 6},
+		{bodyVersion: 7, version: 7},
+	}
+	for _, test := range tests {
+		version, err := expectedVersion(requestWithIfMatch(test.ifMatch), test.bodyVersion)
+		require.NoError(t, err, test.ifMatch)
+		require.Equal(t, test.version, version, test.ifMatch)
+	}
+}
+
+func TestExpectedVersionIsInvalid(t *testing.T) {
+	for _, ifMatch := range []string{`*`, `"abc"`, `"1", "2"`, `"-1"`, `"4294967296"`, `W/`} {
+		_, err := expectedVersion(requestWithIfMatch(ifMatch), 1)
+		require.Equal(t, http.StatusBadRequest, statusOf(err), ifMatch)
+	}
+
+	_, err := expectedVersion(requestWithIfMatch(""), 0)
+	require.Equal(t, http.StatusBadRequest, statusOf(err), "a version is required")
+}
+
+func TestSetETag(t *testing.T) {
+	w := httptest.NewRecorder()
+	setETag(w, 8)
+	require.Equal(t, `"8"`, w.Header().Get("ETag"))
+
+	version, err := expectedVersion(requestWithIfMatch(w.Header().Get("ETag")), 0)
+	require.NoError(t, err)
+	require.Equal(t, uint32(8), version)
+}
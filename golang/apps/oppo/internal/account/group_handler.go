@@ -0,0 +1,150 @@
+package account
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/spf13/cast"
+
+	"github.com/mmrath/gobase/golang/pkg/db"
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+	"github.com/mmrath/gobase/golang/pkg/model"
+)
+
+type GroupHandler struct {
+	groupService GroupService
+}
+
+func NewGroupHandler(database *db.DB) *GroupHandler {
+	return &GroupHandler{groupService: NewGroupService(database)}
+}
+
+func (h *GroupHandler) ListGroups(w http.ResponseWriter, r *http.Request) {
+	groups, err := h.groupService.ListGroups(r.Context())
+
+	if err != nil {
+		errutil.RenderError(w, r, err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, groups)
+}
+
+func (h *GroupHandler) FindGroup(w http.ResponseWriter, r *http.Request) {
+	group, err := h.groupService.FindGroupByID(r.Context(), cast.ToInt32(chi.URLParam(r, "id")))
+
+	if err != nil {
+		errutil.RenderError(w, r, err)
+		return
+	}
+
+	setETag(w, group.Group.Version)
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, group)
+}
+
+func (h *GroupHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	group := model.UserGroupAndRoles{}
+
+	if err := render.DecodeJSON(r.Body, &group); err != nil {
+		render.JSON(w, r, err)
+		return
+	}
+
+	err := h.groupService.CreateGroup(r.Context(), &group)
+
+	if err != nil {
+		errutil.RenderError(w, r, err)
+		return
+	}
+
+	setETag(w, group.Group.Version)
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, group)
+}
+
+func (h *GroupHandler) UpdateGroup(w http.ResponseWriter, r *http.Request) {
+	group := model.UserGroupAndRoles{}
+
+	if err := render.DecodeJSON(r.Body, &group); err != nil {
+		render.JSON(w, r, err)
+		return
+	}
+
+	version, err := expectedVersion(r, group.Group.Version)
+	if err != nil {
+		errutil.RenderError(w, r, err)
+		return
+	}
+	group.Group.ID = cast.ToInt32(chi.URLParam(r, "id"))
+	group.Group.Version = version
+
+	err = h.groupService.UpdateGroup(r.Context(), &group)
+
+	if err != nil {
+		errutil.RenderError(w, r, err)
+		return
+	}
+
+	setETag(w, group.Group.Version)
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, group)
+}
+
+func (h *GroupHandler) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	err := h.groupService.DeleteGroup(r.Context(), cast.ToInt32(chi.URLParam(r, "id")))
+
+	if err != nil {
+		errutil.RenderError(w, r, err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, struct{}{})
+}
+
+func (h *GroupHandler) ListMembers(w http.ResponseWriter, r *http.Request) {
+	users, err := h.groupService.FindMembers(r.Context(), cast.ToInt32(chi.URLParam(r, "id")))
+
+	if err != nil {
+		errutil.RenderError(w, r, err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, users)
+}
+
+// UpdateMembers adds and removes the users in the add and remove lists of the body.
+func (h *GroupHandler) UpdateMembers(w http.ResponseWriter, r *http.Request) {
+	request := model.UpdateMembersRequest{}
+
+	if err := render.DecodeJSON(r.Body, &request); err != nil {
+		render.JSON(w, r, err)
+		return
+	}
+
+	h.updateMembers(w, r, &request)
+}
+
+func (h *GroupHandler) AddMember(w http.ResponseWriter, r *http.Request) {
+	h.updateMembers(w, r, &model.UpdateMembersRequest{Add: []int64{cast.ToInt64(chi.URLParam(r, "userId"))}})
+}
+
+func (h *GroupHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	h.updateMembers(w, r, &model.UpdateMembersRequest{Remove: []int64{cast.ToInt64(chi.URLParam(r, "userId"))}})
+}
+
+func (h *GroupHandler) updateMembers(w http.ResponseWriter, r *http.Request, request *model.UpdateMembersRequest) {
+	users, err := h.groupService.UpdateMembers(r.Context(), cast.ToInt32(chi.URLParam(r, "id")), request)
+
+	if err != nil {
+		errutil.RenderError(w, r, err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, users)
+}
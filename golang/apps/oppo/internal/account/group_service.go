@@ -0,0 +1,206 @@
+package account
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/mmrath/gobase/golang/pkg/db"
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+	"github.com/mmrath/gobase/golang/pkg/model"
+	"github.com/mmrath/gobase/golang/pkg/validate"
+)
+
+// GroupService manages user groups. Members of a group are granted the
+// permissions of the group's roles in addition to their own.
+type GroupService interface {
+	FindGroupByID(ctx context.Context, id int32) (model.UserGroupAndRoles, error)
+	ListGroups(ctx context.Context) ([]model.UserGroupSummary, error)
+	CreateGroup(ctx context.Context, group *model.UserGroupAndRoles) error
+	UpdateGroup(ctx context.Context, group *model.UserGroupAndRoles) error
+	DeleteGroup(ctx context.Context, id int32) error
+	FindMembers(ctx context.Context, id int32) ([]model.User, error)
+	UpdateMembers(ctx context.Context, id int32, request *model.UpdateMembersRequest) ([]model.User, error)
+}
+
+type groupService struct {
+	db       *db.DB
+	groupDao model.UserGroupDao
+	roleDao  model.RoleDao
+	userDao  model.UserDao
+}
+
+func (s *groupService) FindGroupByID(ctx context.Context, id int32) (group model.UserGroupAndRoles, err error) {
+	err = s.db.RunInTxWithOptions(ctx, &sql.TxOptions{ReadOnly: true}, func(tx *db.Tx) error {
+		group, err = s.findGroupTx(tx, id)
+		return err
+	})
+	return group, err
+}
+
+func (s *groupService) findGroupTx(tx *db.Tx, id int32) (group model.UserGroupAndRoles, err error) {
+	group.Group, err = s.groupDao.Find(tx, id)
+	if err != nil {
+		if db.IsNoDataFound(err) {
+			return group, errutil.NewBadRequest("no data found for group")
+		}
+		return group, errutil.Wrap(err, "failed while fetching group")
+	}
+	group.Roles, err = s.groupDao.FindRoleIDs(tx, id)
+	return group, errutil.Wrap(err, "failed while fetching group roles")
+}
+
+func (s *groupService) ListGroups(ctx context.Context) (groups []model.UserGroupSummary, err error) {
+	err = s.db.RunInTxWithOptions(ctx, &sql.TxOptions{ReadOnly: true}, func(tx *db.Tx) error {
+		groups, err = s.groupDao.List(tx)
+		return errutil.Wrap(err, "failed to list groups")
+	})
+	return groups, err
+}
+
+func (s *groupService) CreateGroup(ctx context.Context, group *model.UserGroupAndRoles) error {
+	err := validate.Struct(group.Group)
+	if err != nil {
+		return err
+	}
+
+	canAssign, err := canAssignRoles(ctx)
+	if err != nil {
+		return err
+	}
+	if err = checkRoleChange(canAssign, nil, group.Roles); err != nil {
+		return err
+	}
+
+	return s.db.RunInTx(ctx, func(tx *db.Tx) error {
+		if err := s.checkNameIsFree(tx, group.Group.Name); err != nil {
+			return err
+		}
+		err := s.groupDao.Create(tx, &group.Group)
+		if err != nil {
+			return errutil.Wrap(err, "failed to create group")
+		}
+		group.Roles, err = s.setRolesTx(tx, group.Group.ID, group.Roles)
+		return err
+	})
+}
+
+// UpdateGroup changes a group and replaces its roles, provided the group was not
+// changed since group.Group.Version.
+func (s *groupService) UpdateGroup(ctx context.Context, group *model.UserGroupAndRoles) error {
+	err := validate.Struct(group.Group)
+	if err != nil {
+		return err
+	}
+
+	canAssign, err := canAssignRoles(ctx)
+	if err != nil {
+		return err
+	}
+
+	return s.db.RunInTx(ctx, func(tx *db.Tx) error {
+		existing, err := s.findGroupTx(tx, group.Group.ID)
+		if err != nil {
+			return err
+		}
+		if err = checkRoleChange(canAssign, existing.Roles, group.Roles); err != nil {
+			return err
+		}
+		if !strings.EqualFold(existing.Group.Name, group.Group.Name) {
+			if err := s.checkNameIsFree(tx, group.Group.Name); err != nil {
+				return err
+			}
+		}
+		err = s.groupDao.Update(tx, &group.Group)
+		if err != nil {
+			return err
+		}
+		group.Roles, err = s.setRolesTx(tx, group.Group.ID, group.Roles)
+		return err
+	})
+}
+
+// DeleteGroup deletes a group. Its members lose the roles of the group.
+func (s *groupService) DeleteGroup(ctx context.Context, id int32) error {
+	return s.db.RunInTx(ctx, func(tx *db.Tx) error {
+		if _, err := s.findGroupTx(tx, id); err != nil {
+			return err
+		}
+		return errutil.Wrap(s.groupDao.Delete(tx, id), "failed to delete group")
+	})
+}
+
+func (s *groupService) FindMembers(ctx context.Context, id int32) (users []model.User, err error) {
+	err = s.db.RunInTxWithOptions(ctx, &sql.TxOptions{ReadOnly: true}, func(tx *db.Tx) error {
+		if _, err := s.findGroupTx(tx, id); err != nil {
+			return err
+		}
+		users, err = s.groupDao.FindMembers(tx, id)
+		return errutil.Wrap(err, "failed to find members of group")
+	})
+	return users, err
+}
+
+// UpdateMembers adds and removes members of a group and returns its members
+// afterwards. Users in both lists are removed.
+func (s *groupService) UpdateMembers(ctx context.Context, id int32, request *model.UpdateMembersRequest) (users []model.User, err error) {
+	err = s.db.RunInTx(ctx, func(tx *db.Tx) error {
+		if _, err := s.findGroupTx(tx, id); err != nil {
+			return err
+		}
+
+		exist, err := s.userDao.ExistAll(tx, request.Add)
+		if err != nil {
+			return errutil.Wrap(err, "error while checking users")
+		}
+		if !exist {
+			return errutil.NewFieldError("add", "some of the users do not exist")
+		}
+
+		if err = s.groupDao.AddMembers(tx, id, request.Add); err != nil {
+			return err
+		}
+		if err = s.groupDao.RemoveMembers(tx, id, request.Remove); err != nil {
+			return err
+		}
+		users, err = s.groupDao.FindMembers(tx, id)
+		return errutil.Wrap(err, "failed to find members of group")
+	})
+	return users, err
+}
+
+func (s *groupService) checkNameIsFree(tx *db.Tx, name string) error {
+	exists, err := s.groupDao.ExistsByName(tx, name)
+	if err != nil {
+		return errutil.Wrap(err, "error while checking if group already exists")
+	}
+	if exists {
+		return errutil.NewBadRequest(fmt.Sprintf("group with name %s already exists", name))
+	}
+	return nil
+}
+
+func (s *groupService) setRolesTx(tx *db.Tx, id int32, roles []int32) ([]int32, error) {
+	exist, err := s.roleDao.ExistAll(tx, roles)
+	if err != nil {
+		return nil, errutil.Wrap(err, "error while checking roles")
+	}
+	if !exist {
+		return nil, errutil.NewBadRequest("some of the roles do not exist")
+	}
+	err = s.groupDao.SetRoles(tx, id, roles)
+	if err != nil {
+		return nil, err
+	}
+	return s.groupDao.FindRoleIDs(tx, id)
+}
+
+func NewGroupService(database *db.DB) GroupService {
+	return &groupService{
+		db:       database,
+		groupDao: model.NewUserGroupDao(),
+		roleDao:  model.NewRoleDao(),
+		userDao:  model.NewUserDao(),
+	}
+}
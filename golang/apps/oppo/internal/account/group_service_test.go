@@ -0,0 +1,136 @@
+package account
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/mmrath/gobase/golang/pkg/model"
+)
+
+func memberIDs(users []model.User) []int64 {
+	ids := []int64{}
+	for _, user := range users {
+		ids = append(ids, user.ID)
+	}
+	return ids
+}
+
+func TestCreateGroup(t *testing.T) {
+	setUp(t)
+	service := NewGroupService(testDB)
+	role := createRole(t, "user:read")
+	group := createGroup(t, role.Role.ID)
+	require.Equal(t, []int32{role.Role.ID}, group.Roles)
+
+	duplicate := model.UserGroupAndRoles{
+		Group: model.UserGroup{Name: strings.ToUpper(group.Group.Name), Description: "Test group"},
+	}
+	err := service.CreateGroup(staffContext(0), &duplicate)
+	require.Equal(t, http.StatusBadRequest, statusOf(err), "group names are unique ignoring case")
+
+	withRoles := model.UserGroupAndRoles{
+		Group: model.UserGroup{Name: uniqueName("group"), Description: "Test group"},
+		Roles: []int32{role.Role.ID},
+	}
+	err = service.CreateGroup(context.Background(), &withRoles)
+	require.Equal(t, http.StatusForbidden, statusOf(err), "assigning roles requires the permission to change roles")
+
+	withMissingRole := model.UserGroupAndRoles{
+		Group: model.UserGroup{Name: uniqueName("group"), Description: "Test group"},
+		Roles: []int32{-1},
+	}
+	err = service.CreateGroup(staffContext(0), &withMissingRole)
+	require.Equal(t, http.StatusBadRequest, statusOf(err))
+}
+
+func TestUpdateGroup(t *testing.T) {
+	setUp(t)
+	service := NewGroupService(testDB)
+	group := createGroup(t)
+	stale := group
+
+	group.Group.Name = uniqueName("renamed")
+	require.NoError(t, service.UpdateGroup(context.Background(), &group))
+	require.True(t, group.Group.Version > stale.Group.Version)
+
+	stale.Group.Description = "Overwritten"
+	err := service.UpdateGroup(context.Background(), &stale)
+	require.Equal(t, http.StatusConflict, statusOf(err))
+
+	other := createGroup(t)
+	other.Group.Name = group.Group.Name
+	err = service.UpdateGroup(context.Background(), &other)
+	require.Equal(t, http.StatusBadRequest, statusOf(err), "group names are unique")
+}
+
+func TestUpdateMembers(t *testing.T) {
+	setUp(t)
+	service := NewGroupService(testDB)
+	group := createGroup(t)
+	first := createUser(t, model.AccountTypeStaff, testPassword)
+	second := createUser(t, model.AccountTypeStaff, testPassword)
+	third := createUser(t, model.AccountTypeStaff, testPassword)
+
+	members, err := service.UpdateMembers(context.Background(), group.Group.ID, &model.UpdateMembersRequest{
+		Add: []int64{first.ID, second.ID, first.ID},
+	})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []int64{first.ID, second.ID}, memberIDs(members))
+
+	// users in both lists are removed, users which are not members are ignored
+	members, err = service.UpdateMembers(context.Background(), group.Group.ID, &model.UpdateMembersRequest{
+		Add:    []int64{second.ID, third.ID},
+		Remove: []int64{first.ID, second.ID, -1},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []int64{third.ID}, memberIDs(members))
+
+	_, err = service.UpdateMembers(context.Background(), group.Group.ID, &model.UpdateMembersRequest{
+		Add: []int64{first.ID, -1},
+	})
+	require.Equal(t, http.StatusBadRequest, statusOf(err))
+	members, err = service.FindMembers(context.Background(), group.Group.ID)
+	require.NoError(t, err)
+	require.Equal(t, []int64{third.ID}, memberIDs(members), "no member is added if a user does not exist")
+
+	var summary model.UserGroupSummary
+	groups, err := service.ListGroups(context.Background())
+	require.NoError(t, err)
+	for _, g := range groups {
+		if g.ID == group.Group.ID {
+			summary = g
+		}
+	}
+	require.Equal(t, 1, summary.MemberCount)
+}
+
+func TestGroupRolesGrantPermissions(t *testing.T) {
+	setUp(t)
+	service := NewGroupService(testDB)
+	users := NewUserService(testDB, newFakeNotifier())
+	role := createRole(t, "audit:read")
+	group := createGroup(t, role.Role.ID)
+	user := createUser(t, model.AccountTypeStaff, testPassword)
+
+	authorities, err := users.FindAuthorities(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Empty(t, authorities.Permissions)
+
+	_, err = service.UpdateMembers(context.Background(), group.Group.ID, &model.UpdateMembersRequest{Add: []int64{user.ID}})
+	require.NoError(t, err)
+	authorities, err = NewAuthService(testDB).FindAuthorities(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Equal(t, []string{role.Role.Name}, authorities.Roles)
+	require.Equal(t, []string{"audit:read"}, authorities.Permissions)
+
+	require.NoError(t, service.DeleteGroup(context.Background(), group.Group.ID))
+	authorities, err = users.FindAuthorities(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Empty(t, authorities.Permissions, "members lose the roles of a deleted group")
+	_, err = service.FindGroupByID(context.Background(), group.Group.ID)
+	require.Equal(t, http.StatusBadRequest, statusOf(err))
+}
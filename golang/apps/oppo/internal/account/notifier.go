@@ -0,0 +1,79 @@
+package account
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"sync"
+	"time"
+
+	"github.com/mmrath/gobase/golang/pkg/email"
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+	"github.com/mmrath/gobase/golang/pkg/model"
+	"github.com/mmrath/gobase/golang/pkg/templateutil"
+)
+
+type Notifier interface {
+	NotifyInvitation(ctx context.Context, user model.User, token string, validFor time.Duration) error
+	// SetFrom changes the sender of emails sent from now on.
+	SetFrom(from email.Address)
+}
+
+func NewNotifier(appURL string, from email.Address, mailer email.Mailer, registry *templateutil.Registry) Notifier {
+	return &notifier{appURL: appURL, from: from, mailer: mailer, templateRegistry: registry}
+}
+
+type notifier struct {
+	appURL           string
+	mailer           email.Mailer
+	templateRegistry *templateutil.Registry
+
+	mu   sync.RWMutex
+	from email.Address
+}
+
+func (n *notifier) SetFrom(from email.Address) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.from = from
+}
+
+func (n *notifier) sender() email.Address {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.from
+}
+
+func (n *notifier) NotifyInvitation(ctx context.Context, user model.User, token string, validFor time.Duration) error {
+	url := fmt.Sprintf("%s/oppo/account/invitation?key=%s", n.appURL, token)
+	data := struct {
+		URL       template.URL
+		ValidDays int
+		User      model.User
+	}{
+		URL:       template.URL(url),
+		ValidDays: int(validFor.Hours() / 24),
+		User:      user,
+	}
+
+	to := []email.Address{email.NewAddress(user.GetName(), user.GetEmail())}
+	subject := "You have been invited to Oppo"
+
+	var htmlBody bytes.Buffer
+	err := n.templateRegistry.Render(ctx, &htmlBody, "email/invitation.html", data)
+	if err != nil {
+		return errutil.Wrap(err, "failed to render email")
+	}
+
+	msg, err := email.NewHTMLMessage(n.sender(), to, subject, htmlBody.String())
+	if err != nil {
+		return errutil.Wrap(err, "failed to create email message")
+	}
+
+	err = n.mailer.Send(ctx, msg)
+	if err != nil {
+		return errutil.Wrap(err, "failed to send email")
+	}
+	return nil
+}
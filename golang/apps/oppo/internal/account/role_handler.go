@@ -2,6 +2,7 @@ package account
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/render"
@@ -39,6 +40,7 @@ func (h *RoleHandler) FindRole(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setETag(w, role.Role.Version)
 	render.Status(r, http.StatusOK)
 	render.JSON(w, r, role)
 }
@@ -71,13 +73,93 @@ func (h *RoleHandler) UpdateRole(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.roleService.UpdateRole(r.Context(), role)
+	version, err := expectedVersion(r, role.Role.Version)
+	if err != nil {
+		errutil.RenderError(w, r, err)
+		return
+	}
+	role.Role.ID = cast.ToInt32(chi.URLParam(r, "id"))
+	role.Role.Version = version
+
+	err = h.roleService.UpdateRole(r.Context(), role)
 
 	if err != nil {
-		log.Error().Err(err).Msg("error creating role")
+		log.Error().Err(err).Msg("error updating role")
+		errutil.RenderError(w, r, err)
+		return
+	}
+	setETag(w, role.Role.Version)
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, role)
+}
+
+func (h *RoleHandler) ListRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.roleService.ListRoles(r.Context())
+
+	if err != nil {
+		errutil.RenderError(w, r, err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, roles)
+}
+
+// DeleteRole deletes a role. If it is still assigned to users or groups, the
+// reassignTo query parameter names the role they are given instead.
+func (h *RoleHandler) DeleteRole(w http.ResponseWriter, r *http.Request) {
+	var reassignTo int32
+	if value := r.URL.Query().Get("reassignTo"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			errutil.RenderError(w, r, errutil.NewFieldError("reassignTo", "reassignTo must be a role id"))
+			return
+		}
+		reassignTo = int32(id)
+	}
+
+	err := h.roleService.DeleteRole(r.Context(), cast.ToInt32(chi.URLParam(r, "id")), reassignTo)
+
+	if err != nil {
+		log.Error().Err(err).Msg("error deleting role")
 		errutil.RenderError(w, r, err)
 		return
 	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, struct{}{})
+}
+
+func (h *RoleHandler) CloneRole(w http.ResponseWriter, r *http.Request) {
+	request := model.CloneRoleRequest{}
+
+	if err := render.DecodeJSON(r.Body, &request); err != nil {
+		render.JSON(w, r, err)
+		return
+	}
+
+	role, err := h.roleService.CloneRole(r.Context(), cast.ToInt32(chi.URLParam(r, "id")), &request)
+
+	if err != nil {
+		log.Error().Err(err).Msg("error cloning role")
+		errutil.RenderError(w, r, err)
+		return
+	}
+
+	setETag(w, role.Role.Version)
 	render.Status(r, http.StatusOK)
 	render.JSON(w, r, role)
 }
+
+// ListPermissions returns the permissions which can be granted to roles, grouped by resource.
+func (h *RoleHandler) ListPermissions(w http.ResponseWriter, r *http.Request) {
+	groups, err := h.roleService.FindPermissionCatalog(r.Context())
+
+	if err != nil {
+		errutil.RenderError(w, r, err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, groups)
+}
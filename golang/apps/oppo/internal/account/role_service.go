@@ -2,24 +2,30 @@ package account
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 
-	"github.com/rs/zerolog/log"
-
+	"github.com/mmrath/gobase/golang/apps/oppo/permissions"
 	"github.com/mmrath/gobase/golang/pkg/db"
 	"github.com/mmrath/gobase/golang/pkg/errutil"
 	"github.com/mmrath/gobase/golang/pkg/model"
+	"github.com/mmrath/gobase/golang/pkg/validate"
 )
 
 type RoleService interface {
 	FindRoleByID(ctx context.Context, id int32) (model.RoleAndPermission, error)
 	CreateRole(ctx context.Context, role *model.RoleAndPermission) error
 	UpdateRole(ctx context.Context, role *model.RoleAndPermission) error
+	ListRoles(ctx context.Context) ([]model.RoleSummary, error)
+	DeleteRole(ctx context.Context, id int32, reassignTo int32) error
+	CloneRole(ctx context.Context, id int32, request *model.CloneRoleRequest) (model.RoleAndPermission, error)
+	FindPermissionCatalog(ctx context.Context) ([]model.PermissionGroup, error)
 }
 
 type roleService struct {
-	db      *db.DB
-	roleDao model.RoleDao
+	db            *db.DB
+	roleDao       model.RoleDao
+	permissionDao model.PermissionDao
 }
 
 func (s *roleService) FindRoleByID(ctx context.Context, id int32) (model.RoleAndPermission, error) {
@@ -35,7 +41,7 @@ func (s *roleService) FindRoleByID(ctx context.Context, id int32) (model.RoleAnd
 func (s *roleService) findRoleTx(tx *db.Tx, id int32) (role model.RoleAndPermission, err error) {
 	role.Role, err = s.roleDao.Find(tx, id)
 	if err != nil {
-		if !db.IsNoDataFound(err) {
+		if db.IsNoDataFound(err) {
 			return role, errutil.NewBadRequest("no data found for role")
 		}
 		return role, errutil.Wrap(err, "failed while fetching role")
@@ -67,15 +73,7 @@ func (s *roleService) createRoleTx(tx *db.Tx, roleAndPermission *model.RoleAndPe
 			fmt.Sprintf("role with name %s already exists", roleAndPermission.Role.Name))
 	}
 	err = s.roleDao.Create(tx, &roleAndPermission.Role, roleAndPermission.Permissions)
-	if err != nil {
-		dbErr := tx.Rollback().Error
-		if dbErr != nil {
-			// we return the original error
-			log.Error().Err(dbErr).Msg("error while rolling back transaction")
-		}
-		return errutil.Wrap(err, "failed to create role")
-	}
-	return nil
+	return errutil.Wrap(err, "failed to create role")
 }
 
 func (s *roleService) UpdateRole(ctx context.Context, roleAndPermission *model.RoleAndPermission) error {
@@ -85,10 +83,120 @@ func (s *roleService) UpdateRole(ctx context.Context, roleAndPermission *model.R
 	return err
 }
 
+func (s *roleService) ListRoles(ctx context.Context) (roles []model.RoleSummary, err error) {
+	err = s.db.RunInTxWithOptions(ctx, &sql.TxOptions{ReadOnly: true}, func(tx *db.Tx) error {
+		roles, err = s.roleDao.List(tx)
+		return errutil.Wrap(err, "failed to list roles")
+	})
+	return roles, err
+}
+
+// DeleteRole deletes a role. A role which is still assigned to users or groups
+// is only deleted if reassignTo is the id of another role, which they are given
+// instead.
+func (s *roleService) DeleteRole(ctx context.Context, id int32, reassignTo int32) error {
+	return s.db.RunInTx(ctx, func(tx *db.Tx) error {
+		if _, err := s.findRoleTx(tx, id); err != nil {
+			return err
+		}
+
+		if reassignTo != 0 {
+			if reassignTo == id {
+				return errutil.NewFieldError("reassignTo", "a role cannot be reassigned to itself")
+			}
+			if _, err := s.roleDao.Find(tx, reassignTo); err != nil {
+				if db.IsNoDataFound(err) {
+					return errutil.NewFieldError("reassignTo", "no data found for role")
+				}
+				return errutil.Wrap(err, "failed while fetching role")
+			}
+			if err := s.roleDao.ReassignRole(tx, id, reassignTo); err != nil {
+				return err
+			}
+		}
+
+		users, groups, err := s.roleDao.CountAssignments(tx, id)
+		if err != nil {
+			return errutil.Wrap(err, "failed to count role assignments")
+		}
+		if users != 0 || groups != 0 {
+			return errutil.NewConflict(fmt.Sprintf(
+				"role is assigned to %d users and %d groups, reassign them to another role first", users, groups))
+		}
+		return errutil.Wrap(s.roleDao.Delete(tx, id), "failed to delete role")
+	})
+}
+
+// CloneRole creates a role with the permissions of the role with the given id.
+func (s *roleService) CloneRole(ctx context.Context, id int32, request *model.CloneRoleRequest) (role model.RoleAndPermission, err error) {
+	err = validate.Struct(request)
+	if err != nil {
+		return role, err
+	}
+
+	err = s.db.RunInTx(ctx, func(tx *db.Tx) error {
+		source, err := s.findRoleTx(tx, id)
+		if err != nil {
+			return err
+		}
+		role = model.RoleAndPermission{
+			Role:        model.Role{Name: request.Name, Description: request.Description},
+			Permissions: source.Permissions,
+		}
+		return s.createRoleTx(tx, &role)
+	})
+	return role, err
+}
+
+// FindPermissionCatalog returns all permissions which can be granted to roles,
+// grouped by resource.
+func (s *roleService) FindPermissionCatalog(ctx context.Context) (groups []model.PermissionGroup, err error) {
+	err = s.db.RunInTxWithOptions(ctx, &sql.TxOptions{ReadOnly: true}, func(tx *db.Tx) error {
+		perms, err := s.permissionDao.FindAll(tx)
+		if err != nil {
+			return errutil.Wrap(err, "failed to find permissions")
+		}
+		groups = model.GroupPermissions(perms)
+		return nil
+	})
+	return groups, err
+}
+
+// canAssignRoles reports whether the logged in user may assign roles to users and
+// groups. As that grants permissions, it needs the permission to change roles.
+func canAssignRoles(ctx context.Context) (bool, error) {
+	return model.AuthorizerFromContext(ctx).Can(ctx, permissions.ResourceRole, permissions.AuthorityWrite)
+}
+
+// checkRoleChange returns a forbidden error if roles differ from current and the
+// logged in user may not assign roles.
+func checkRoleChange(canAssign bool, current []int32, roles []int32) error {
+	if canAssign || sameRoles(current, roles) {
+		return nil
+	}
+	return errutil.NewForbidden("changing roles requires the permission to change roles")
+}
+
+func sameRoles(a []int32, b []int32) bool {
+	set := make(map[int32]bool, len(a))
+	for _, id := range a {
+		set[id] = true
+	}
+	other := make(map[int32]bool, len(b))
+	for _, id := range b {
+		if !set[id] {
+			return false
+		}
+		other[id] = true
+	}
+	return len(other) == len(set)
+}
+
 func NewRoleService(
 	database *db.DB) RoleService {
 	return &roleService{
-		db:      database,
-		roleDao: model.NewRoleDao(),
+		db:            database,
+		roleDao:       model.NewRoleDao(),
+		permissionDao: model.NewPermissionDao(),
 	}
 }
@@ -0,0 +1,109 @@
+package account
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/mmrath/gobase/golang/pkg/db"
+	"github.com/mmrath/gobase/golang/pkg/model"
+)
+
+// createGroup creates a group with the given roles.
+func createGroup(t *testing.T, roles ...int32) model.UserGroupAndRoles {
+	group := model.UserGroupAndRoles{
+		Group: model.UserGroup{Name: uniqueName("group"), Description: "Test group"},
+		Roles: roles,
+	}
+	require.NoError(t, NewGroupService(testDB).CreateGroup(staffContext(0), &group))
+	return group
+}
+
+func userRoleIDs(t *testing.T, userID int64) (roles []int32) {
+	err := testDB.RunInTx(context.Background(), func(tx *db.Tx) (err error) {
+		roles, err = model.NewRoleDao().FindIDsByUserID(tx, userID)
+		return err
+	})
+	require.NoError(t, err)
+	return roles
+}
+
+func TestDeleteRole(t *testing.T) {
+	setUp(t)
+	service := NewRoleService(testDB)
+	role := createRole(t, "user:read")
+
+	require.NoError(t, service.DeleteRole(context.Background(), role.Role.ID, 0))
+	_, err := service.FindRoleByID(context.Background(), role.Role.ID)
+	require.Equal(t, http.StatusBadRequest, statusOf(err))
+
+	err = service.DeleteRole(context.Background(), role.Role.ID, 0)
+	require.Equal(t, http.StatusBadRequest, statusOf(err), "the role does not exist anymore")
+}
+
+func TestDeleteAssignedRole(t *testing.T) {
+	setUp(t)
+	service := NewRoleService(testDB)
+	role := createRole(t, "user:read")
+	user := createUser(t, model.AccountTypeStaff, testPassword)
+	setUserRoles(t, user.ID, role.Role.ID)
+	group := createGroup(t, role.Role.ID)
+
+	err := service.DeleteRole(context.Background(), role.Role.ID, 0)
+	require.Equal(t, http.StatusConflict, statusOf(err))
+	_, err = service.FindRoleByID(context.Background(), role.Role.ID)
+	require.NoError(t, err, "an assigned role is not deleted")
+
+	err = service.DeleteRole(context.Background(), role.Role.ID, role.Role.ID)
+	require.Equal(t, http.StatusBadRequest, statusOf(err), "a role cannot be reassigned to itself")
+	err = service.DeleteRole(context.Background(), role.Role.ID, -1)
+	require.Equal(t, http.StatusBadRequest, statusOf(err), "the other role must exist")
+
+	other := createRole(t, "group:read")
+	require.NoError(t, service.DeleteRole(context.Background(), role.Role.ID, other.Role.ID))
+	require.Equal(t, []int32{other.Role.ID}, userRoleIDs(t, user.ID))
+	found, err := NewGroupService(testDB).FindGroupByID(context.Background(), group.Group.ID)
+	require.NoError(t, err)
+	require.Equal(t, []int32{other.Role.ID}, found.Roles)
+}
+
+func TestReassignRoleToAssignedRole(t *testing.T) {
+	setUp(t)
+	role := createRole(t, "user:read")
+	other := createRole(t, "group:read")
+	user := createUser(t, model.AccountTypeStaff, testPassword)
+	// the user has both roles, so reassigning must not assign the other one twice
+	setUserRoles(t, user.ID, role.Role.ID, other.Role.ID)
+	group := createGroup(t, role.Role.ID, other.Role.ID)
+
+	require.NoError(t, NewRoleService(testDB).DeleteRole(context.Background(), role.Role.ID, other.Role.ID))
+	require.Equal(t, []int32{other.Role.ID}, userRoleIDs(t, user.ID))
+	found, err := NewGroupService(testDB).FindGroupByID(context.Background(), group.Group.ID)
+	require.NoError(t, err)
+	require.Equal(t, []int32{other.Role.ID}, found.Roles)
+}
+
+func TestCloneRole(t *testing.T) {
+	setUp(t)
+	service := NewRoleService(testDB)
+	role := createRole(t, "user:read", "user:write")
+
+	request := &model.CloneRoleRequest{Name: uniqueName("clone"), Description: "Cloned role"}
+	clone, err := service.CloneRole(context.Background(), role.Role.ID, request)
+	require.NoError(t, err)
+	require.NotEqual(t, role.Role.ID, clone.Role.ID)
+
+	found, err := service.FindRoleByID(context.Background(), clone.Role.ID)
+	require.NoError(t, err)
+	require.Equal(t, request.Name, found.Role.Name)
+	require.ElementsMatch(t, role.Permissions, found.Permissions)
+
+	_, err = service.CloneRole(context.Background(), role.Role.ID, request)
+	require.Equal(t, http.StatusBadRequest, statusOf(err), "role names are unique")
+	_, err = service.CloneRole(context.Background(), role.Role.ID, &model.CloneRoleRequest{Name: uniqueName("clone")})
+	require.Equal(t, http.StatusBadRequest, statusOf(err), "a description is required")
+	_, err = service.CloneRole(context.Background(), -1, &model.CloneRoleRequest{Name: uniqueName("clone"), Description: "Cloned role"})
+	require.Equal(t, http.StatusBadRequest, statusOf(err))
+}
@@ -0,0 +1,80 @@
+package account
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/spf13/cast"
+	"gopkg.in/go-playground/validator.v9"
+
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+	"github.com/mmrath/gobase/golang/pkg/session"
+)
+
+// SessionHandler lets administrators see and terminate active sessions.
+type SessionHandler struct {
+	store *session.Store
+}
+
+func NewSessionHandler(store *session.Store) *SessionHandler {
+	return &SessionHandler{store: store}
+}
+
+// ListSessions lists active sessions, optionally only those of the user given by the userId query parameter.
+func (h *SessionHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("userId")
+	err := validator.New().Var(userID, "omitempty,numeric")
+	if err != nil {
+		errutil.RenderError(w, r, errutil.NewBadRequest("invalid userId"))
+		return
+	}
+
+	sessions, err := h.store.List(r.Context(), cast.ToInt64(userID))
+	if err != nil {
+		errutil.RenderError(w, r, err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, sessions)
+}
+
+func (h *SessionHandler) TerminateSession(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	err := validator.New().Var(id, "required,numeric")
+	if err != nil {
+		errutil.RenderError(w, r, errutil.NewBadRequest("invalid session id"))
+		return
+	}
+
+	err = h.store.Terminate(r.Context(), cast.ToInt64(id))
+	if err != nil {
+		errutil.RenderError(w, r, err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, struct{}{})
+}
+
+// TerminateUserSessions terminates all sessions of the user given by the userId query parameter.
+func (h *SessionHandler) TerminateUserSessions(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("userId")
+	err := validator.New().Var(userID, "required,numeric")
+	if err != nil {
+		errutil.RenderError(w, r, errutil.NewBadRequest("invalid userId"))
+		return
+	}
+
+	count, err := h.store.TerminateUser(r.Context(), cast.ToInt64(userID))
+	if err != nil {
+		errutil.RenderError(w, r, err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, struct {
+		Terminated int64 `json:"terminated"`
+	}{Terminated: count})
+}
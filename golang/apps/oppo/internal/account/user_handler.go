@@ -2,6 +2,9 @@ package account
 
 import (
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/render"
@@ -13,12 +16,31 @@ import (
 	"github.com/mmrath/gobase/golang/pkg/model"
 )
 
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+var accountTypes = map[string]model.AccountType{
+	"customer": model.AccountTypeCustomer,
+	"staff":    model.AccountTypeStaff,
+}
+
+// UserListResponse is a page of users. Total is the number of users matching the
+// filter on all pages.
+type UserListResponse struct {
+	Users []model.User `json:"users"`
+	Page  int          `json:"page"`
+	Size  int          `json:"size"`
+	Total int          `json:"total"`
+}
+
 type UserHandler struct {
 	userService UserService
 }
 
-func NewUserHandler(database *db.DB) *UserHandler {
-	userService := NewUserService(database)
+func NewUserHandler(database *db.DB, notifier Notifier) *UserHandler {
+	userService := NewUserService(database, notifier)
 	return &UserHandler{userService: userService}
 }
 
@@ -38,10 +60,36 @@ func (h *UserHandler) FindUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setETag(w, user.User.Version)
 	render.Status(r, http.StatusOK)
 	render.JSON(w, r, user)
 }
 
+// ListUsers returns a page of users. They can be filtered with the query parameters
+// q (the start of the email, first or last name), active (true or false) and
+// accountType (customer or staff), and sorted with sort, e.g. sort=-updatedAt for
+// the most recently updated first. Pages are selected with page, starting at 1,
+// and size.
+func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	filter, page, err := parseUserFilter(r.URL.Query())
+	if err != nil {
+		errutil.RenderError(w, r, err)
+		return
+	}
+
+	users, total, err := h.userService.ListUsers(r.Context(), filter)
+	if err != nil {
+		errutil.RenderError(w, r, err)
+		return
+	}
+	if users == nil {
+		users = []model.User{}
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, UserListResponse{Users: users, Page: page, Size: filter.Limit, Total: total})
+}
+
 func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	userCreateReq := model.CreateUserRequest{}
 
@@ -57,25 +105,132 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setETag(w, user.User.Version)
 	render.Status(r, http.StatusOK)
 	render.JSON(w, r, user)
 }
 
 func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
-	user := model.User{}
+	request := model.UpdateUserRequest{}
 
-	if err := render.DecodeJSON(r.Body, &user); err != nil {
+	if err := render.DecodeJSON(r.Body, &request); err != nil {
 		render.JSON(w, r, err)
 		return
 	}
 
-	err := h.userService.UpdateUser(r.Context(), &user)
+	version, err := expectedVersion(r, request.Version)
+	if err != nil {
+		errutil.RenderError(w, r, err)
+		return
+	}
+	request.Version = version
+
+	user, err := h.userService.UpdateUser(r.Context(), cast.ToInt64(chi.URLParam(r, "id")), &request)
 
 	if err != nil {
 		errutil.RenderError(w, r, err)
 		return
 	}
 
+	setETag(w, user.User.Version)
 	render.Status(r, http.StatusOK)
 	render.JSON(w, r, user)
 }
+
+func (h *UserHandler) DeactivateUser(w http.ResponseWriter, r *http.Request) {
+	h.setUserActive(w, r, false)
+}
+
+func (h *UserHandler) ReactivateUser(w http.ResponseWriter, r *http.Request) {
+	h.setUserActive(w, r, true)
+}
+
+func (h *UserHandler) setUserActive(w http.ResponseWriter, r *http.Request, active bool) {
+	user, err := h.userService.SetUserActive(r.Context(), cast.ToInt64(chi.URLParam(r, "id")), active)
+
+	if err != nil {
+		errutil.RenderError(w, r, err)
+		return
+	}
+
+	setETag(w, user.Version)
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, user)
+}
+
+func (h *UserHandler) ResendInvitation(w http.ResponseWriter, r *http.Request) {
+	err := h.userService.ResendInvitation(r.Context(), cast.ToInt64(chi.URLParam(r, "id")))
+
+	if err != nil {
+		errutil.RenderError(w, r, err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, struct{}{})
+}
+
+// FindAuthorities returns the roles and permissions a user has directly or through groups.
+func (h *UserHandler) FindAuthorities(w http.ResponseWriter, r *http.Request) {
+	authorities, err := h.userService.FindAuthorities(r.Context(), cast.ToInt64(chi.URLParam(r, "id")))
+
+	if err != nil {
+		errutil.RenderError(w, r, err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, authorities)
+}
+
+func parseUserFilter(query url.Values) (filter model.UserFilter, page int, err error) {
+	filter.Search = strings.TrimSpace(query.Get("q"))
+
+	if value := query.Get("active"); value != "" {
+		active, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, 0, errutil.NewFieldError("active", "active must be true or false")
+		}
+		filter.Active = &active
+	}
+	if value := query.Get("accountType"); value != "" {
+		accountType, ok := accountTypes[strings.ToLower(value)]
+		if !ok {
+			return filter, 0, errutil.NewFieldError("accountType", "accountType must be customer or staff")
+		}
+		filter.AccountType = &accountType
+	}
+	if sort := query.Get("sort"); sort != "" {
+		filter.Descending = strings.HasPrefix(sort, "-")
+		filter.Sort = strings.TrimPrefix(sort, "-")
+		if _, ok := model.UserSortColumns[filter.Sort]; !ok {
+			return filter, 0, errutil.NewFieldError("sort", "sort must be one of id, email, firstName, lastName or updatedAt")
+		}
+	}
+
+	page, err = parsePositiveInt(query, "page", 1)
+	if err != nil {
+		return filter, 0, err
+	}
+	filter.Limit, err = parsePositiveInt(query, "size", defaultPageSize)
+	if err != nil {
+		return filter, 0, err
+	}
+	if filter.Limit > maxPageSize {
+		return filter, 0, errutil.NewFieldError("size", "size must be between 1 and "+strconv.Itoa(maxPageSize))
+	}
+	filter.Offset = (page - 1) * filter.Limit
+	return filter, page, nil
+}
+
+func parsePositiveInt(query url.Values, name string, defaultValue int) (int, error) {
+	value := query.Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil || i < 1 {
+		return 0, errutil.NewFieldError(name, name+" must be a positive number")
+	}
+	return i, nil
+}
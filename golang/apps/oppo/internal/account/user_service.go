@@ -2,43 +2,295 @@ package account
 
 import (
 	"context"
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/mmrath/gobase/golang/pkg/auth"
 	"github.com/mmrath/gobase/golang/pkg/db"
+	"github.com/mmrath/gobase/golang/pkg/errutil"
 	"github.com/mmrath/gobase/golang/pkg/model"
+	"github.com/mmrath/gobase/golang/pkg/validate"
 )
 
+// invitationValidity is how long users created by an administrator can use the
+// link in their invitation to choose a password.
+const invitationValidity = 7 * 24 * time.Hour
+
 type UserService interface {
-	FindUserByID(ctx context.Context, id int64) (model.User, error)
-	CreateUser(ctx context.Context, role *model.CreateUserRequest) (model.User, error)
-	UpdateUser(ctx context.Context, role *model.User) error
+	FindUserByID(ctx context.Context, id int64) (model.UserAndRoles, error)
+	ListUsers(ctx context.Context, filter model.UserFilter) (users []model.User, total int, err error)
+	CreateUser(ctx context.Context, request *model.CreateUserRequest) (model.CreatedUser, error)
+	UpdateUser(ctx context.Context, id int64, request *model.UpdateUserRequest) (model.UserAndRoles, error)
+	SetUserActive(ctx context.Context, id int64, active bool) (model.User, error)
+	ResendInvitation(ctx context.Context, id int64) error
+	FindAuthorities(ctx context.Context, id int64) (auth.Authorities, error)
 }
 
 type userService struct {
-	db      *db.DB
-	userDao model.UserDao
+	db                *db.DB
+	userDao           model.UserDao
+	userCredentialDao model.UserCredentialDao
+	roleDao           model.RoleDao
+	permissionDao     model.PermissionDao
+	notifier          Notifier
+}
+
+func (s *userService) FindUserByID(ctx context.Context, id int64) (user model.UserAndRoles, err error) {
+	err = s.db.RunInTxWithOptions(ctx, &sql.TxOptions{ReadOnly: true}, func(tx *db.Tx) error {
+		user, err = s.findUserTx(tx, id)
+		return err
+	})
+	return user, err
 }
 
-func (u userService) FindUserByID(ctx context.Context, id int64) (model.User, error) {
+func (s *userService) findUserTx(tx *db.Tx, id int64) (user model.UserAndRoles, err error) {
+	user.User, err = s.userDao.Find(tx, id)
+	if err != nil {
+		if db.IsNoDataFound(err) {
+			return user, errutil.NewBadRequest("no data found for user")
+		}
+		return user, errutil.Wrap(err, "failed while fetching user")
+	}
+	user.Roles, err = s.roleDao.FindIDsByUserID(tx, id)
+	return user, errutil.Wrap(err, "failed while fetching user roles")
+}
+
+func (s *userService) ListUsers(ctx context.Context, filter model.UserFilter) (users []model.User, total int, err error) {
+	err = s.db.RunInTxWithOptions(ctx, &sql.TxOptions{ReadOnly: true}, func(tx *db.Tx) error {
+		users, total, err = s.userDao.List(tx, filter)
+		return errutil.Wrap(err, "failed to list users")
+	})
+	return users, total, err
+}
+
+// CreateUser creates a user with the requested roles and invites it by email to
+// choose a password. The user is created even if the invitation cannot be sent,
+// which is reported in the result so that it can be resent.
+func (s *userService) CreateUser(ctx context.Context, request *model.CreateUserRequest) (created model.CreatedUser, err error) {
+	err = validate.Struct(request)
+	if err != nil {
+		return created, err
+	}
+
+	canAssign, err := canAssignRoles(ctx)
+	if err != nil {
+		return created, err
+	}
+	if err = checkRoleChange(canAssign, nil, request.Roles); err != nil {
+		return created, err
+	}
+
+	token := uuid.New().String()
+	tokenHash := fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
+
+	user := &created.UserAndRoles
+	err = s.db.RunInTx(ctx, func(tx *db.Tx) error {
+		*user = model.UserAndRoles{User: model.User{
+			FirstName:   request.FirstName,
+			LastName:    request.LastName,
+			Email:       strings.ToLower(request.Email),
+			PhoneNumber: request.PhoneNumber,
+			AccountType: request.AccountType,
+			Active:      request.Active,
+		}}
+
+		err := s.checkEmailIsFree(tx, user.User.Email)
+		if err != nil {
+			return err
+		}
+		err = s.userDao.Insert(tx, &user.User)
+		if err != nil {
+			return errutil.Wrap(err, "failed to create user")
+		}
+		err = s.userCredentialDao.Insert(tx, &model.UserCredential{
+			ID:                user.User.ID,
+			ResetKey:          tokenHash,
+			ResetKeyExpiresAt: time.Now().Add(invitationValidity),
+		})
+		if err != nil {
+			return errutil.Wrap(err, "failed to create user credential")
+		}
+		user.Roles, err = s.setRolesTx(tx, user.User.ID, request.Roles)
+		return err
+	})
+	if err != nil {
+		return created, err
+	}
+
+	err = s.notifier.NotifyInvitation(ctx, user.User, token, invitationValidity)
+	if err != nil {
+		log.Error().Err(err).Int64("id", user.User.ID).Msg("failed to send invitation email")
+		return created, nil
+	}
+	created.InvitationSent = true
+	return created, nil
+}
+
+// UpdateUser changes a user and replaces its roles, provided the user was not
+// changed since request.Version.
+func (s *userService) UpdateUser(ctx context.Context, id int64, request *model.UpdateUserRequest) (user model.UserAndRoles, err error) {
+	err = validate.Struct(request)
+	if err != nil {
+		return user, err
+	}
+
+	canAssign, err := canAssignRoles(ctx)
+	if err != nil {
+		return user, err
+	}
+
+	err = s.db.RunInTx(ctx, func(tx *db.Tx) error {
+		user, err = s.findUserTx(tx, id)
+		if err != nil {
+			return err
+		}
+		if err = checkRoleChange(canAssign, user.Roles, request.Roles); err != nil {
+			return err
+		}
+
+		email := strings.ToLower(request.Email)
+		if email != user.User.Email {
+			if err = s.checkEmailIsFree(tx, email); err != nil {
+				return err
+			}
+		}
+
+		user.User.FirstName = request.FirstName
+		user.User.LastName = request.LastName
+		user.User.Email = email
+		user.User.PhoneNumber = request.PhoneNumber
+		user.User.AccountType = request.AccountType
+		user.User.Version = request.Version
+		err = s.userDao.Update(tx, &user.User)
+		if err != nil {
+			return err
+		}
+		user.Roles, err = s.setRolesTx(tx, id, request.Roles)
+		return err
+	})
+	return user, err
+}
+
+// SetUserActive deactivates or reactivates a user. Deactivated users can no longer
+// log in and their sessions are rejected from the next request on.
+func (s *userService) SetUserActive(ctx context.Context, id int64, active bool) (user model.User, err error) {
+	if !active {
+		currentID, err := auth.UserIDFromContext(ctx)
+		if err == nil && currentID == id {
+			return user, errutil.NewBadRequest("you cannot deactivate yourself")
+		}
+	}
+
+	err = s.db.RunInTx(ctx, func(tx *db.Tx) error {
+		user, err = s.userDao.Find(tx, id)
+		if err != nil {
+			if db.IsNoDataFound(err) {
+				return errutil.NewBadRequest("no data found for user")
+			}
+			return errutil.Wrap(err, "failed while fetching user")
+		}
+		if user.Active == active {
+			return nil
+		}
+		err = s.userDao.SetActive(tx, id, active)
+		if err != nil {
+			return errutil.Wrap(err, "failed to update user")
+		}
+		user, err = s.userDao.Find(tx, id)
+		return err
+	})
+	return user, err
+}
+
+// ResendInvitation sends a new invitation to a user which has not chosen a
+// password yet. The link of any earlier invitation stops working.
+func (s *userService) ResendInvitation(ctx context.Context, id int64) error {
+	token := uuid.New().String()
+	tokenHash := fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
+
 	var user model.User
-	err := u.db.RunInTx(ctx, func(tx *db.Tx) error {
+	err := s.db.RunInTx(ctx, func(tx *db.Tx) error {
 		var err error
-		user, err = u.userDao.Find(tx, id)
+		user, err = s.userDao.Find(tx, id)
+		if err != nil {
+			if db.IsNoDataFound(err) {
+				return errutil.NewBadRequest("no data found for user")
+			}
+			return errutil.Wrap(err, "failed while fetching user")
+		}
+		uc, err := s.userCredentialDao.Get(tx, id)
+		if err != nil {
+			return errutil.Wrap(err, "failed while fetching user credential")
+		}
+		if uc.PasswordHash != "" {
+			return errutil.NewBadRequest("user has already accepted the invitation")
+		}
+		return s.userCredentialDao.UpdateResetKey(tx, id, tokenHash, time.Now().Add(invitationValidity))
+	})
+	if err != nil {
 		return err
+	}
+
+	err = s.notifier.NotifyInvitation(ctx, user, token, invitationValidity)
+	return errutil.Wrap(err, "failed to send invitation email")
+}
+
+// FindAuthorities returns the effective roles and permissions of a user, including
+// those granted through the user's groups.
+func (s *userService) FindAuthorities(ctx context.Context, id int64) (authorities auth.Authorities, err error) {
+	err = s.db.RunInTxWithOptions(ctx, &sql.TxOptions{ReadOnly: true}, func(tx *db.Tx) error {
+		if _, err := s.findUserTx(tx, id); err != nil {
+			return err
+		}
+		authorities.Roles, err = s.roleDao.FindNamesByUserID(tx, id)
+		if err != nil {
+			return errutil.Wrap(err, "failed to find roles of user")
+		}
+		authorities.Permissions, err = s.permissionDao.FindNamesByUserID(tx, id)
+		return errutil.Wrap(err, "failed to find permissions of user")
 	})
-	return user, err
+	return authorities, err
 }
 
-func (u userService) CreateUser(ctx context.Context, user *model.CreateUserRequest) (model.User, error) {
-	panic("implement me")
+func (s *userService) checkEmailIsFree(tx *db.Tx, email string) error {
+	exists, err := s.userDao.ExistsByEmail(tx, email)
+	if err != nil {
+		return errutil.Wrap(err, "error while checking if email is already used")
+	}
+	if exists {
+		return errutil.NewBadRequest(fmt.Sprintf("user with email %s already exists", email))
+	}
+	return nil
 }
 
-func (u userService) UpdateUser(ctx context.Context, user *model.User) (err error) {
-	panic("implement me")
+func (s *userService) setRolesTx(tx *db.Tx, userID int64, roles []int32) ([]int32, error) {
+	exist, err := s.roleDao.ExistAll(tx, roles)
+	if err != nil {
+		return nil, errutil.Wrap(err, "error while checking roles")
+	}
+	if !exist {
+		return nil, errutil.NewBadRequest("some of the roles do not exist")
+	}
+	err = s.roleDao.SetUserRoles(tx, userID, roles)
+	if err != nil {
+		return nil, err
+	}
+	return s.roleDao.FindIDsByUserID(tx, userID)
 }
 
-func NewUserService(database *db.DB) UserService {
+func NewUserService(database *db.DB, notifier Notifier) UserService {
 	return &userService{
-		db:      database,
-		userDao: model.NewUserDao(),
+		db:                database,
+		userDao:           model.NewUserDao(),
+		userCredentialDao: model.NewUserCredentialDao(),
+		roleDao:           model.NewRoleDao(),
+		permissionDao:     model.NewPermissionDao(),
+		notifier:          notifier,
 	}
 }
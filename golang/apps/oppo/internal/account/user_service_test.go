@@ -0,0 +1,166 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/mmrath/gobase/golang/pkg/db"
+	"github.com/mmrath/gobase/golang/pkg/model"
+)
+
+func administratorRoleID(t *testing.T) int32 {
+	var role model.Role
+	err := testDB.RunInTx(context.Background(), func(tx *db.Tx) (err error) {
+		role, err = model.NewRoleDao().FindByName(tx, model.AdministratorRole)
+		return err
+	})
+	require.NoError(t, err)
+	return role.ID
+}
+
+func newUserRequest(roles ...int32) *model.CreateUserRequest {
+	return &model.CreateUserRequest{
+		FirstName:   "Invited",
+		LastName:    "Staff",
+		Email:       strings.ToUpper(uniqueEmail("invited")),
+		AccountType: model.AccountTypeStaff,
+		Active:      true,
+		Roles:       roles,
+	}
+}
+
+func TestCreateUser(t *testing.T) {
+	setUp(t)
+	notifier := newFakeNotifier()
+	service := NewUserService(testDB, notifier)
+	admin := createUser(t, model.AccountTypeStaff, testPassword)
+	roleID := administratorRoleID(t)
+
+	request := newUserRequest(roleID)
+	created, err := service.CreateUser(staffContext(admin.ID), request)
+	require.NoError(t, err)
+	require.True(t, created.InvitationSent)
+	require.NotEmpty(t, notifier.tokens[created.User.ID])
+	require.Equal(t, strings.ToLower(request.Email), created.User.Email)
+	require.Equal(t, []int32{roleID}, created.Roles)
+
+	found, err := service.FindUserByID(context.Background(), created.User.ID)
+	require.NoError(t, err)
+	require.Equal(t, created.UserAndRoles.Roles, found.Roles)
+	require.Equal(t, created.User.Email, found.User.Email)
+
+	_, err = service.CreateUser(staffContext(admin.ID), request)
+	require.Equal(t, http.StatusBadRequest, statusOf(err), "emails are unique")
+}
+
+func TestCreateUserWithRolesRequiresPermission(t *testing.T) {
+	setUp(t)
+	service := NewUserService(testDB, newFakeNotifier())
+
+	// without an authorizer every permission is denied
+	_, err := service.CreateUser(context.Background(), newUserRequest(administratorRoleID(t)))
+	require.Equal(t, http.StatusForbidden, statusOf(err))
+
+	_, err = service.CreateUser(context.Background(), newUserRequest())
+	require.NoError(t, err)
+}
+
+func TestCreateUserWhenInvitationFails(t *testing.T) {
+	setUp(t)
+	notifier := newFakeNotifier()
+	notifier.err = errors.New("mail server is down")
+	service := NewUserService(testDB, notifier)
+
+	created, err := service.CreateUser(context.Background(), newUserRequest())
+	require.NoError(t, err)
+	require.False(t, created.InvitationSent)
+	_, err = service.FindUserByID(context.Background(), created.User.ID)
+	require.NoError(t, err, "the user is created anyway")
+
+	require.Error(t, service.ResendInvitation(context.Background(), created.User.ID))
+	notifier.err = nil
+	require.NoError(t, service.ResendInvitation(context.Background(), created.User.ID))
+	require.NotEmpty(t, notifier.tokens[created.User.ID])
+}
+
+func TestResendInvitationAfterAcceptance(t *testing.T) {
+	setUp(t)
+	service := NewUserService(testDB, newFakeNotifier())
+	user := createUser(t, model.AccountTypeStaff, testPassword)
+
+	err := service.ResendInvitation(context.Background(), user.ID)
+	require.Equal(t, http.StatusBadRequest, statusOf(err))
+}
+
+func TestUpdateUser(t *testing.T) {
+	setUp(t)
+	service := NewUserService(testDB, newFakeNotifier())
+	created, err := service.CreateUser(context.Background(), newUserRequest())
+	require.NoError(t, err)
+
+	email := uniqueEmail("updated")
+	updated, err := service.UpdateUser(context.Background(), created.User.ID, &model.UpdateUserRequest{
+		FirstName:   "Renamed",
+		LastName:    "Staff",
+		Email:       strings.ToUpper(email),
+		AccountType: model.AccountTypeStaff,
+		Version:     created.User.Version,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "Renamed", updated.User.FirstName)
+	require.Equal(t, email, updated.User.Email)
+	require.True(t, updated.User.Version > created.User.Version)
+
+	other := createUser(t, model.AccountTypeStaff, testPassword)
+	_, err = service.UpdateUser(context.Background(), created.User.ID, &model.UpdateUserRequest{
+		FirstName:   "Renamed",
+		LastName:    "Staff",
+		Email:       other.Email,
+		AccountType: model.AccountTypeStaff,
+		Version:     updated.User.Version,
+	})
+	require.Equal(t, http.StatusBadRequest, statusOf(err), "emails are unique")
+}
+
+func TestListUsers(t *testing.T) {
+	setUp(t)
+	service := NewUserService(testDB, newFakeNotifier())
+	user := createUser(t, model.AccountTypeStaff, testPassword)
+
+	users, total, err := service.ListUsers(context.Background(), model.UserFilter{Search: strings.ToUpper(user.Email), Limit: 10})
+	require.NoError(t, err)
+	require.Equal(t, 1, total)
+	require.Len(t, users, 1)
+	require.Equal(t, user.ID, users[0].ID)
+
+	customer := model.AccountTypeCustomer
+	_, total, err = service.ListUsers(context.Background(), model.UserFilter{Search: user.Email, AccountType: &customer})
+	require.NoError(t, err)
+	require.Equal(t, 0, total)
+}
+
+func TestSetUserActive(t *testing.T) {
+	setUp(t)
+	service := NewUserService(testDB, newFakeNotifier())
+	admin := createUser(t, model.AccountTypeStaff, testPassword)
+	user := createUser(t, model.AccountTypeStaff, testPassword)
+
+	deactivated, err := service.SetUserActive(staffContext(admin.ID), user.ID, false)
+	require.NoError(t, err)
+	require.False(t, deactivated.Active)
+
+	_, err = NewAuthService(testDB).Login(context.Background(), model.LoginRequest{Email: user.Email, Password: testPassword})
+	require.Equal(t, http.StatusUnauthorized, statusOf(err), "deactivated users cannot log in")
+
+	reactivated, err := service.SetUserActive(staffContext(admin.ID), user.ID, true)
+	require.NoError(t, err)
+	require.True(t, reactivated.Active)
+
+	_, err = service.SetUserActive(staffContext(admin.ID), admin.ID, false)
+	require.Equal(t, http.StatusBadRequest, statusOf(err), "staff cannot deactivate themselves")
+}
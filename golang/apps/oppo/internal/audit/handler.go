@@ -0,0 +1,140 @@
+// Package audit lets support staff read the audit trail of changes to the database.
+package audit
+
+import (
+	"database/sql"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/render"
+
+	"github.com/mmrath/gobase/golang/pkg/db"
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+	"github.com/mmrath/gobase/golang/pkg/model"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+var actions = map[string]string{
+	"insert":   model.AuditActionInsert,
+	"update":   model.AuditActionUpdate,
+	"delete":   model.AuditActionDelete,
+	"truncate": model.AuditActionTruncate,
+}
+
+// EventsResponse is a page of audit events. NextBefore is passed as the before
+// query parameter to get the next page, and is zero on the last page.
+type EventsResponse struct {
+	Events     []model.AuditEvent `json:"events"`
+	NextBefore int64              `json:"nextBefore,omitempty"`
+}
+
+type Handler struct {
+	db       *db.DB
+	eventDao model.AuditEventDao
+}
+
+func NewHandler(database *db.DB) *Handler {
+	return &Handler{db: database, eventDao: model.NewAuditEventDao()}
+}
+
+// ListEvents returns audit events, newest first. They can be filtered with the query
+// parameters table, rowId (matched with the column given by keyColumn, id by default),
+// userId, action (insert, update, delete or truncate), from and to (RFC 3339).
+// Pages are selected with limit and before.
+func (h *Handler) ListEvents(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		errutil.RenderError(w, r, err)
+		return
+	}
+
+	var events []model.AuditEvent
+	err = h.db.RunInTxWithOptions(r.Context(), &sql.TxOptions{ReadOnly: true}, func(tx *db.Tx) error {
+		// fetch one more to know if there is a next page
+		page := filter
+		page.Limit++
+		events, err = h.eventDao.Find(tx, page)
+		return errutil.Wrap(err, "failed to find audit events")
+	})
+	if err != nil {
+		errutil.RenderError(w, r, err)
+		return
+	}
+
+	response := EventsResponse{Events: events}
+	if len(events) > filter.Limit {
+		response.Events = events[:filter.Limit]
+		response.NextBefore = response.Events[filter.Limit-1].ID
+	}
+	if response.Events == nil {
+		response.Events = []model.AuditEvent{}
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, response)
+}
+
+func parseFilter(query url.Values) (filter model.AuditEventFilter, err error) {
+	filter.Table = query.Get("table")
+	filter.KeyColumn = query.Get("keyColumn")
+	filter.RowKey = query.Get("rowId")
+	filter.UserID = query.Get("userId")
+
+	if action := query.Get("action"); action != "" {
+		var ok bool
+		filter.Action, ok = actions[strings.ToLower(action)]
+		if !ok {
+			return filter, errutil.NewFieldError("action", "action must be one of insert, update, delete or truncate")
+		}
+	}
+	if filter.From, err = parseTime(query, "from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = parseTime(query, "to"); err != nil {
+		return filter, err
+	}
+	if filter.Before, err = parseInt(query, "before", 0); err != nil {
+		return filter, err
+	}
+
+	limit, err := parseInt(query, "limit", defaultLimit)
+	if err != nil {
+		return filter, err
+	}
+	if limit < 1 || limit > maxLimit {
+		return filter, errutil.NewFieldError("limit", "limit must be between 1 and "+strconv.Itoa(maxLimit))
+	}
+	filter.Limit = int(limit)
+	return filter, nil
+}
+
+func parseTime(query url.Values, name string) (time.Time, error) {
+	value := query.Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return t, errutil.NewFieldError(name, name+" must be a RFC 3339 timestamp")
+	}
+	return t, nil
+}
+
+func parseInt(query url.Values, name string, defaultValue int64) (int64, error) {
+	value := query.Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	i, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, errutil.NewFieldError(name, name+" must be a number")
+	}
+	return i, nil
+}
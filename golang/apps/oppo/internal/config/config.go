@@ -1,25 +1,42 @@
 package config
 
 import (
-	"github.com/kelseyhightower/envconfig"
-
+	pkgconfig "github.com/mmrath/gobase/golang/pkg/config"
 	"github.com/mmrath/gobase/golang/pkg/db"
+	"github.com/mmrath/gobase/golang/pkg/email"
 	"github.com/mmrath/gobase/golang/pkg/errutil"
+	"github.com/mmrath/gobase/golang/pkg/health"
+	"github.com/mmrath/gobase/golang/pkg/logutil"
+	"github.com/mmrath/gobase/golang/pkg/metrics"
+	"github.com/mmrath/gobase/golang/pkg/server"
+	"github.com/mmrath/gobase/golang/pkg/session"
+	"github.com/mmrath/gobase/golang/pkg/tracing"
 )
 
 type Config struct {
-	DB  db.Config `yaml:"db"`
-	Web WebConfig `yaml:"web"`
+	LogLevel logutil.Level    `default:"info" split_words:"true" yaml:"logLevel" reload:"true"`
+	DB       db.Config        `yaml:"db"`
+	Web      WebConfig        `yaml:"web"`
+	Session  session.Config   `yaml:"session"`
+	SMTP     email.SMTPConfig `yaml:"smtp"`
+	Health   health.Config    `yaml:"health"`
+	Metrics  metrics.Config   `yaml:"metrics"`
+	Tracing  tracing.Config   `yaml:"tracing"`
 }
 
 type WebConfig struct {
 	URL         string `yaml:"url"`
 	Port        string `yaml:"port"`
 	CorsEnabled bool   `yaml:"corsEnabled"`
-	TemplateDir string `yaml:"templateDir"`
+	// CorsOrigins are the origins allowed to call the API, by default the origin of URL.
+	CorsOrigins []string      `split_words:"true" yaml:"corsOrigins" reload:"true"`
+	TemplateDir string        `default:"./apps/oppo/resources/templates" yaml:"templateDir"`
+	Server      server.Config `yaml:"server"`
 }
 
-func LoadConfig(cfg *Config) error {
-	err := envconfig.Process("", cfg)
+// LoadConfig fills cfg from the defaults, the YAML files selected by opts and the
+// environment, in that order.
+func LoadConfig(cfg *Config, opts pkgconfig.Options) error {
+	err := pkgconfig.Load(cfg, opts)
 	return errutil.Wrap(err, "failed to load config")
 }
@@ -0,0 +1,31 @@
+// Package permissions declares the permissions checked by oppo. db-migration
+// syncs them into the permission table, so a new permission only needs to be
+// added here.
+package permissions
+
+import "github.com/mmrath/gobase/golang/pkg/auth"
+
+// Resources and authorities of the permissions checked by oppo.
+const (
+	ResourceRole    = "role"
+	ResourceUser    = "user"
+	ResourceGroup   = "group"
+	ResourceSession = "session"
+	ResourceAudit   = "audit"
+
+	AuthorityRead  = "read"
+	AuthorityWrite = "write"
+)
+
+// All are the permissions checked by oppo.
+var All = []auth.Permission{
+	{Resource: ResourceRole, Authority: AuthorityRead, Description: "View roles"},
+	{Resource: ResourceRole, Authority: AuthorityWrite, Description: "Create and update roles"},
+	{Resource: ResourceUser, Authority: AuthorityRead, Description: "View user accounts"},
+	{Resource: ResourceUser, Authority: AuthorityWrite, Description: "Create and update user accounts"},
+	{Resource: ResourceGroup, Authority: AuthorityRead, Description: "View user groups"},
+	{Resource: ResourceGroup, Authority: AuthorityWrite, Description: "Create and change user groups and their members"},
+	{Resource: ResourceSession, Authority: AuthorityRead, Description: "View active sessions"},
+	{Resource: ResourceSession, Authority: AuthorityWrite, Description: "Terminate sessions"},
+	{Resource: ResourceAudit, Authority: AuthorityRead, Description: "View the audit trail"},
+}
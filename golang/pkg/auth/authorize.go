@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+)
+
+type authoritiesKeyType int
+
+var authoritiesKey authoritiesKeyType
+
+// Authorities are the role names and effective permissions of a principal.
+// Permissions are named "resource:authority", see PermissionName.
+type Authorities struct {
+	Roles       []string
+	Permissions []string
+}
+
+// PermissionName returns the name under which a permission is granted.
+func PermissionName(resource, authority string) string {
+	return resource + ":" + authority
+}
+
+// HasPermission reports whether the permission is granted. Like the unique index
+// on the permission table, the comparison ignores case.
+func (a Authorities) HasPermission(resource, authority string) bool {
+	name := PermissionName(resource, authority)
+	for _, p := range a.Permissions {
+		if strings.EqualFold(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRole reports whether the role with the given name is granted.
+func (a Authorities) HasRole(role string) bool {
+	for _, r := range a.Roles {
+		if strings.EqualFold(r, role) {
+			return true
+		}
+	}
+	return false
+}
+
+func NewAuthoritiesContext(ctx context.Context, authorities Authorities) context.Context {
+	return context.WithValue(ctx, authoritiesKey, authorities)
+}
+
+// AuthoritiesFromContext returns the authorities of the logged in principal,
+// which are empty if nobody is logged in.
+func AuthoritiesFromContext(ctx context.Context) Authorities {
+	authorities, _ := ctx.Value(authoritiesKey).(Authorities)
+	return authorities
+}
+
+// RequirePermission returns a middleware which responds with 401 if nobody is
+// logged in and 403 if the principal lacks the permission. It must run after the
+// middleware which authenticates the request and populates the auth context.
+func RequirePermission(resource, authority string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, err := UserIDFromContext(r.Context())
+			if err != nil {
+				errutil.RenderError(w, r, err)
+				return
+			}
+
+			if !AuthoritiesFromContext(r.Context()).HasPermission(resource, authority) {
+				log.Info().
+					Int64("userId", userID).
+					Str("permission", PermissionName(resource, authority)).
+					Msg("permission denied")
+				errutil.RenderError(w, r, errutil.NewForbidden("permission denied"))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Permission declares a permission an application checks. The declarations of
+// all applications are the source of truth of the permission table.
+type Permission struct {
+	Resource    string
+	Authority   string
+	Description string
+}
+
+// Name returns the name under which the permission is granted.
+func (p Permission) Name() string {
+	return PermissionName(p.Resource, p.Authority)
+}
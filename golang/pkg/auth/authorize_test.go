@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequirePermission(t *testing.T) {
+	handler := RequirePermission("user", "write")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(authorities *Authorities) int {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if authorities != nil {
+			ctx := NewAuthContext(r.Context(), 1)
+			r = r.WithContext(NewAuthoritiesContext(ctx, *authorities))
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusUnauthorized, serve(nil))
+	require.Equal(t, http.StatusForbidden, serve(&Authorities{Permissions: []string{"user:read"}}))
+	require.Equal(t, http.StatusOK, serve(&Authorities{Permissions: []string{"user:read", "USER:Write"}}))
+}
@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-chi/jwtauth"
+	"github.com/go-chi/render"
+	"github.com/rs/zerolog/log"
+
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+)
+
+// JWKSHandler publishes the public keys of the ring, typically at /.well-known/jwks.json.
+func JWKSHandler(ring *KeyRing) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		render.Status(r, http.StatusOK)
+		render.JSON(w, r, ring.JWKS())
+	}
+}
+
+// JWKSClient verifies tokens with keys fetched from a remote JWK set.
+type JWKSClient struct {
+	url             string
+	httpClient      *http.Client
+	refreshInterval time.Duration
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+// NewJWKSClient creates a client for the JWK set at url. Keys are fetched
+// lazily and refetched at most once per refreshInterval, or earlier when a
+// token with an unknown kid shows up after the interval has passed.
+func NewJWKSClient(url string, refreshInterval time.Duration) *JWKSClient {
+	return &JWKSClient{
+		url:             url,
+		httpClient:      &http.Client{Timeout: 10 * time.Second},
+		refreshInterval: refreshInterval,
+		keys:            make(map[string]*rsa.PublicKey),
+	}
+}
+
+// KeyFunc is a jwt.Keyfunc which looks up the verification key by the kid header.
+func (c *JWKSClient) KeyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+		return nil, errutil.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errutil.New("token has no key id")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key, ok := c.keys[kid]
+	if !ok && time.Since(c.fetchedAt) >= c.refreshInterval {
+		if err := c.fetch(); err != nil {
+			return nil, err
+		}
+		key, ok = c.keys[kid]
+	}
+	if !ok {
+		return nil, errutil.Errorf("unknown key id %s", kid)
+	}
+	return key, nil
+}
+
+func (c *JWKSClient) fetch() error {
+	// even a failed fetch counts, so that an unavailable issuer is not hammered
+	c.fetchedAt = time.Now()
+
+	resp, err := c.httpClient.Get(c.url)
+	if err != nil {
+		return errutil.Wrapf(err, "failed to fetch jwks from %s", c.url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errutil.Errorf("failed to fetch jwks from %s, status %d", c.url, resp.StatusCode)
+	}
+
+	set := JSONWebKeySet{}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return errutil.Wrapf(err, "failed to decode jwks from %s", c.url)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		key, err := jwk.PublicKey()
+		if err != nil {
+			log.Warn().Err(err).Str("kid", jwk.Kid).Msg("ignoring invalid key in jwks")
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	c.keys = keys
+	log.Info().Str("url", c.url).Int("keys", len(keys)).Msg("fetched jwks")
+	return nil
+}
+
+// Verifier returns a middleware which verifies the token found in the request
+// with keyFunc and stores the result in the context the same way jwtauth.Verifier
+// does, so it can be combined with Authenticator.
+func Verifier(keyFunc jwt.Keyfunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, err := verifyRequest(r, keyFunc)
+			ctx := jwtauth.NewContext(r.Context(), token, err)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func verifyRequest(r *http.Request, keyFunc jwt.Keyfunc) (*jwt.Token, error) {
+	tokenString := jwtauth.TokenFromHeader(r)
+	if tokenString == "" {
+		tokenString = jwtauth.TokenFromCookie(r)
+	}
+	if tokenString == "" {
+		return nil, jwtauth.ErrNoTokenFound
+	}
+
+	token, err := jwt.Parse(tokenString, keyFunc)
+	if err != nil {
+		if verr, ok := err.(*jwt.ValidationError); ok {
+			if verr.Errors&jwt.ValidationErrorExpired > 0 {
+				return token, jwtauth.ErrExpired
+			} else if verr.Errors&jwt.ValidationErrorIssuedAt > 0 {
+				return token, jwtauth.ErrIATInvalid
+			} else if verr.Errors&jwt.ValidationErrorNotValidYet > 0 {
+				return token, jwtauth.ErrNBFInvalid
+			}
+		}
+		log.Info().Err(err).Msg("failed to verify jwt token")
+		return token, jwtauth.ErrUnauthorized
+	}
+
+	if !token.Valid {
+		return token, jwtauth.ErrUnauthorized
+	}
+	return token, nil
+}
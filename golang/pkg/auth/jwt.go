@@ -2,14 +2,16 @@ package auth
 
 import (
 	"context"
-	"crypto/rand"
-	"crypto/rsa"
-	"io/ioutil"
+	"encoding/base64"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
 
+	"github.com/mmrath/gobase/golang/pkg/crypto"
+	"github.com/mmrath/gobase/golang/pkg/db"
 	"github.com/mmrath/gobase/golang/pkg/errutil"
 
 	"github.com/dgrijalva/jwt-go"
@@ -22,18 +24,57 @@ type userIDKeyType int
 var userIDKey userIDKeyType
 
 type JWTConfig struct {
-	CookieName            string        `default:"jwt" split_words:"true"`
-	CookieDomain          string        `split_words:"true"`
-	TokenValidityDuration time.Duration `default:"240h" split_words:"true"`
-	PrivateKeyPath        string        `split_words:"true"`
-	PublicKeyPath         string        `split_words:"true"`
+	CookieName                   string        `default:"jwt" split_words:"true" yaml:"cookieName"`
+	CookieDomain                 string        `split_words:"true" yaml:"cookieDomain"`
+	TokenValidityDuration        time.Duration `default:"15m" split_words:"true" yaml:"tokenValidityDuration" reload:"true"`
+	RefreshTokenValidityDuration time.Duration `default:"720h" split_words:"true" yaml:"refreshTokenValidityDuration" reload:"true"`
+	MFATokenValidityDuration     time.Duration `default:"5m" split_words:"true" yaml:"mfaTokenValidityDuration" reload:"true"`
+	PrivateKeyPath               string        `split_words:"true" yaml:"privateKeyPath"`
+	PublicKeyPath                string        `split_words:"true" yaml:"publicKeyPath"`
+	// NextPrivateKeyPath is the key which replaces the current one at NextKeyActivatesAt.
+	// It is published in the JWK set right away so verifiers pick it up before it is used.
+	NextPrivateKeyPath string    `split_words:"true" yaml:"nextPrivateKeyPath"`
+	NextKeyActivatesAt time.Time `split_words:"true" yaml:"nextKeyActivatesAt"`
+	// VerificationKeyPaths are retired public keys which are still accepted until
+	// every token signed with them has expired.
+	VerificationKeyPaths []string `split_words:"true" yaml:"verificationKeyPaths"`
+	// AllowRandomKey signs tokens with a random key if no private key is configured.
+	// It is meant for development only, as tokens do not survive a restart and are
+	// not accepted by other replicas.
+	AllowRandomKey bool `split_words:"true" yaml:"allowRandomKey"`
 }
 
 type JWTService interface {
 	Verifier() func(http.Handler) http.Handler
-	NewToken(user Principal) (tokenString string, err error)
+	NewToken(user Principal, authorities Authorities) (Token, error)
+	NewRefreshToken() (RefreshToken, error)
+	NewMFAToken(userID int64) (Token, error)
+	ParseMFAToken(tokenString string) (int64, error)
 	Decode(tokenString string) (t *jwt.Token, err error)
 	Authenticator(http.Handler) http.Handler
+	JWKSHandler() http.HandlerFunc
+	// SetValidity changes the validity durations of tokens issued from now on.
+	SetValidity(config JWTConfig)
+}
+
+// RevocationChecker reports whether an access token, identified by its jti, has been revoked.
+type RevocationChecker interface {
+	IsRevoked(ctx context.Context, tokenID string) (bool, error)
+}
+
+// Token is a signed access token.
+type Token struct {
+	Value     string
+	ID        string
+	ExpiresAt time.Time
+}
+
+// RefreshToken is an opaque token which can be exchanged for a new access token.
+// Only Hash should ever be persisted.
+type RefreshToken struct {
+	Value     string
+	Hash      string
+	ExpiresAt time.Time
 }
 
 type Principal interface {
@@ -43,66 +84,59 @@ type Principal interface {
 }
 
 type jwtService struct {
-	cookieName            string
-	cookieDomain          string
-	tokenValidityDuration time.Duration
-	privateKey            *rsa.PrivateKey
-	publicKey             *rsa.PublicKey
-	jwtAuth               *jwtauth.JWTAuth
-}
-
-func NewJWTService(config JWTConfig) (JWTService, error) {
-
-	var privateKey *rsa.PrivateKey
-	var publicKey *rsa.PublicKey
+	cookieName   string
+	cookieDomain string
+	keyRing      *KeyRing
+	revocations  RevocationChecker
 
-	if config.PublicKeyPath != "" && config.PrivateKeyPath != "" {
-		privateKeyData, err := ioutil.ReadFile(config.PrivateKeyPath)
-		if err != nil {
-			return nil, errutil.Wrap(err, "failed to read jwt private key")
-		}
-		privateKey, err = jwt.ParseRSAPrivateKeyFromPEM(privateKeyData)
-		if err != nil {
-			return nil, errutil.Wrap(err, "jwt rsa private key is invalid")
-		}
+	mu                           sync.RWMutex
+	tokenValidityDuration        time.Duration
+	refreshTokenValidityDuration time.Duration
+	mfaTokenValidityDuration     time.Duration
+}
 
-		publicKeyData, err := ioutil.ReadFile(config.PublicKeyPath)
-		if err != nil {
-			return nil, errutil.Wrap(err, "failed to read jwt public key")
-		}
+// NewJWTService creates a JWTService. revocations may be nil, in which case
+// tokens are valid until they expire.
+func NewJWTService(config JWTConfig, revocations RevocationChecker) (JWTService, error) {
+	keyRing, err := NewKeyRing(config)
+	if err != nil {
+		return nil, err
+	}
 
-		publicKey, err = jwt.ParseRSAPublicKeyFromPEM(publicKeyData)
-		if err != nil {
-			return nil, errutil.Wrap(err, "jwt rsa public  key is invalid")
-		}
-	} else {
-		key, err := rsa.GenerateKey(rand.Reader, 2048)
-		if err != nil {
-			return nil, errutil.Wrap(err, "failed to generate key pair")
-		}
-		privateKey = key
-		publicKey = &key.PublicKey
+	s := &jwtService{
+		cookieName:   config.CookieName,
+		cookieDomain: config.CookieDomain,
+		keyRing:      keyRing,
+		revocations:  revocations,
 	}
+	s.SetValidity(config)
+	return s, nil
+}
 
-	return &jwtService{
-		cookieName:            config.CookieName,
-		cookieDomain:          config.CookieDomain,
-		tokenValidityDuration: config.TokenValidityDuration,
-		privateKey:            privateKey,
-		publicKey:             publicKey,
-		jwtAuth:               jwtauth.New("RS512", privateKey, publicKey)}, nil
+func (s *jwtService) SetValidity(config JWTConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokenValidityDuration = config.TokenValidityDuration
+	s.refreshTokenValidityDuration = config.RefreshTokenValidityDuration
+	s.mfaTokenValidityDuration = config.MFATokenValidityDuration
 }
+
+func (s *jwtService) validity() (token, refreshToken, mfaToken time.Duration) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tokenValidityDuration, s.refreshTokenValidityDuration, s.mfaTokenValidityDuration
+}
+
 func (s *jwtService) Verifier() func(http.Handler) http.Handler {
-	return jwtauth.Verifier(s.jwtAuth)
+	return Verifier(s.keyRing.KeyFunc)
+}
+
+func (s *jwtService) JWKSHandler() http.HandlerFunc {
+	return JWKSHandler(s.keyRing)
 }
 
 func (s *jwtService) Decode(tokenString string) (t *jwt.Token, err error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, errutil.Errorf("Unexpected signing method: %v", token.Header["alg"])
-		}
-		return s.publicKey, nil
-	})
+	token, err := jwt.Parse(tokenString, s.keyRing.KeyFunc)
 
 	if err != nil {
 		return nil, errutil.Wrap(err, "failed to parse jwt token")
@@ -122,37 +156,135 @@ func UserIDFromContext(ctx context.Context) (int64, error) {
 	return id, nil
 }
 
+// NewAuthContext returns a context of the authenticated user. Changes made in
+// transactions run with it are attributed to the user in the audit trail.
 func NewAuthContext(ctx context.Context, userID int64) context.Context {
 	ctx = context.WithValue(ctx, userIDKey, userID)
-	return ctx
+	return db.NewAuditContext(ctx, strconv.FormatInt(userID, 10))
 }
 
 type Claims struct {
-	UserID int64 `json:"userId"`
+	UserID      int64    `json:"userId"`
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
 	jwt.StandardClaims
 }
 
-func (s *jwtService) NewToken(user Principal) (string, error) {
+// NewToken issues an access token for user. The authorities are embedded in the
+// token, so changes to roles and permissions take effect when the token is refreshed.
+func (s *jwtService) NewToken(user Principal, authorities Authorities) (Token, error) {
+	validity, _, _ := s.validity()
 	now := time.Now()
-	iat := now.Unix()
-	exp := now.Add(s.tokenValidityDuration).Unix()
+	expiresAt := now.Add(validity)
+	tokenID := uuid.New().String()
 
 	claims := &Claims{
-		UserID: user.GetID(),
+		UserID:      user.GetID(),
+		Roles:       authorities.Roles,
+		Permissions: authorities.Permissions,
 		StandardClaims: jwt.StandardClaims{
 			// In JWT, the expiry time is expressed as unix milliseconds
-			ExpiresAt: exp,
-			IssuedAt:  iat,
-			Id:        uuid.New().String(),
+			ExpiresAt: expiresAt.Unix(),
+			IssuedAt:  now.Unix(),
+			Id:        tokenID,
 			Subject:   user.GetEmail(),
 		},
 	}
+	keyID, key := s.keyRing.SigningKey()
 	token := jwt.NewWithClaims(jwt.SigningMethodRS512, claims)
-	tokenString, err := token.SignedString(s.privateKey)
+	token.Header["kid"] = keyID
+	tokenString, err := token.SignedString(key)
 	if err != nil {
-		return "", errutil.Wrap(err, "failed to sign jwt token")
+		return Token{}, errutil.Wrap(err, "failed to sign jwt token")
 	}
-	return tokenString, nil
+	return Token{Value: tokenString, ID: tokenID, ExpiresAt: expiresAt}, nil
+}
+
+// mfaTokenType marks tokens which prove the password step of a login, but not the second factor.
+const mfaTokenType = "mfa_pending"
+
+type mfaClaims struct {
+	Type string `json:"typ"`
+	jwt.StandardClaims
+}
+
+// NewMFAToken issues a short lived token for a user who passed the password
+// check and still has to present the second factor. It is not an access token.
+func (s *jwtService) NewMFAToken(userID int64) (Token, error) {
+	_, _, validity := s.validity()
+	now := time.Now()
+	expiresAt := now.Add(validity)
+	tokenID := uuid.New().String()
+
+	claims := &mfaClaims{
+		Type: mfaTokenType,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: expiresAt.Unix(),
+			IssuedAt:  now.Unix(),
+			Id:        tokenID,
+			Subject:   strconv.FormatInt(userID, 10),
+		},
+	}
+	keyID, key := s.keyRing.SigningKey()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS512, claims)
+	token.Header["kid"] = keyID
+	tokenString, err := token.SignedString(key)
+	if err != nil {
+		return Token{}, errutil.Wrap(err, "failed to sign mfa token")
+	}
+	return Token{Value: tokenString, ID: tokenID, ExpiresAt: expiresAt}, nil
+}
+
+// ParseMFAToken verifies a token issued by NewMFAToken and returns the user id.
+func (s *jwtService) ParseMFAToken(tokenString string) (int64, error) {
+	claims := &mfaClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, s.keyRing.KeyFunc)
+	if err != nil || claims.Type != mfaTokenType {
+		return 0, errutil.NewUnauthorized("invalid or expired mfa token")
+	}
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return 0, errutil.NewUnauthorized("invalid or expired mfa token")
+	}
+	return userID, nil
+}
+
+func stringsClaim(claims jwt.MapClaims, name string) []string {
+	values, _ := claims[name].([]interface{})
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if str, ok := v.(string); ok {
+			result = append(result, str)
+		}
+	}
+	return result
+}
+
+func (s *jwtService) NewRefreshToken() (RefreshToken, error) {
+	data, err := crypto.GenerateRandomBytes(32)
+	if err != nil {
+		return RefreshToken{}, errutil.Wrap(err, "failed to generate refresh token")
+	}
+	value := base64.RawURLEncoding.EncodeToString(data)
+	hash, err := HashRefreshToken(value)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	_, validity, _ := s.validity()
+	return RefreshToken{
+		Value:     value,
+		Hash:      hash,
+		ExpiresAt: time.Now().Add(validity),
+	}, nil
+}
+
+// HashRefreshToken returns the value under which a refresh token is stored.
+func HashRefreshToken(value string) (string, error) {
+	hash, err := crypto.SHA256([]byte(value))
+	if err != nil {
+		return "", errutil.Wrap(err, "failed to hash refresh token")
+	}
+	return hash, nil
 }
 
 func (s *jwtService) Authenticator(next http.Handler) http.Handler {
@@ -180,12 +312,33 @@ func (s *jwtService) Authenticator(next http.Handler) http.Handler {
 
 		userID, ok := claims["userId"]
 
-		if !ok {
+		// tokens with a type, like mfa tokens, are never access tokens
+		if _, typed := claims["typ"]; !ok || typed {
 			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 			return
 		}
 
-		req := r.WithContext(NewAuthContext(r.Context(), int64(userID.(float64))))
+		if s.revocations != nil {
+			tokenID, _ := claims["jti"].(string)
+			revoked, err := s.revocations.IsRevoked(r.Context(), tokenID)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to check if jwt token is revoked")
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			if revoked {
+				log.Info().Str("jti", tokenID).Msg("token is revoked")
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+		}
+
+		ctx := NewAuthContext(r.Context(), int64(userID.(float64)))
+		ctx = NewAuthoritiesContext(ctx, Authorities{
+			Roles:       stringsClaim(claims, "roles"),
+			Permissions: stringsClaim(claims, "permissions"),
+		})
+		req := r.WithContext(ctx)
 
 		// Token is authenticated, pass it through
 		next.ServeHTTP(w, req)
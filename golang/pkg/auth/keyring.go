@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/rs/zerolog/log"
+
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+)
+
+// KeyRing holds the RSA keys used to sign and verify tokens.
+//
+// Tokens are signed with the current key until the next key, if any, becomes
+// active. Both keys and any retired verification keys are accepted when
+// verifying tokens and are published in the JWK set, so that verifiers learn
+// about the next key before the first token is signed with it.
+type KeyRing struct {
+	current          signingKey
+	next             *signingKey
+	nextActivatesAt  time.Time
+	verificationKeys map[string]*rsa.PublicKey
+}
+
+type signingKey struct {
+	id  string
+	key *rsa.PrivateKey
+}
+
+// NewKeyRing loads the keys configured in config. A private key is required,
+// unless config allows a random key to be generated for development.
+func NewKeyRing(config JWTConfig) (*KeyRing, error) {
+	ring := &KeyRing{verificationKeys: make(map[string]*rsa.PublicKey)}
+
+	if config.PrivateKeyPath != "" {
+		key, err := loadPrivateKey(config.PrivateKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		ring.current = newSigningKey(key)
+	} else if !config.AllowRandomKey {
+		return nil, errutil.New("no jwt private key configured")
+	} else {
+		log.Warn().Msg("no jwt private key configured, generating a random key")
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, errutil.Wrap(err, "failed to generate key pair")
+		}
+		ring.current = newSigningKey(key)
+	}
+	ring.verificationKeys[ring.current.id] = &ring.current.key.PublicKey
+
+	if config.NextPrivateKeyPath != "" {
+		key, err := loadPrivateKey(config.NextPrivateKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		next := newSigningKey(key)
+		ring.next = &next
+		ring.nextActivatesAt = config.NextKeyActivatesAt
+		ring.verificationKeys[next.id] = &key.PublicKey
+	}
+
+	paths := config.VerificationKeyPaths
+	if config.PublicKeyPath != "" {
+		paths = append(paths, config.PublicKeyPath)
+	}
+	for _, path := range paths {
+		key, err := loadPublicKey(path)
+		if err != nil {
+			return nil, err
+		}
+		ring.verificationKeys[KeyID(key)] = key
+	}
+
+	return ring, nil
+}
+
+func newSigningKey(key *rsa.PrivateKey) signingKey {
+	return signingKey{id: KeyID(&key.PublicKey), key: key}
+}
+
+func loadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errutil.Wrapf(err, "failed to read jwt private key %s", path)
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+	if err != nil {
+		return nil, errutil.Wrapf(err, "jwt rsa private key %s is invalid", path)
+	}
+	return key, nil
+}
+
+func loadPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errutil.Wrapf(err, "failed to read jwt public key %s", path)
+	}
+	key, err := jwt.ParseRSAPublicKeyFromPEM(data)
+	if err != nil {
+		return nil, errutil.Wrapf(err, "jwt rsa public key %s is invalid", path)
+	}
+	return key, nil
+}
+
+// KeyID returns the RFC 7638 thumbprint of key, which is used as the kid of tokens
+// signed with the matching private key. It only depends on the key, so every
+// replica configured with the same key agrees on the kid.
+func KeyID(key *rsa.PublicKey) string {
+	jwk := newJSONWebKey("", key)
+	// members in lexicographic order without whitespace, as required by RFC 7638
+	thumbprintInput, _ := json.Marshal(struct {
+		E   string `json:"e"`
+		Kty string `json:"kty"`
+		N   string `json:"n"`
+	}{E: jwk.E, Kty: jwk.Kty, N: jwk.N})
+	sum := sha256.Sum256(thumbprintInput)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// SigningKey returns the key tokens should be signed with now.
+func (k *KeyRing) SigningKey() (string, *rsa.PrivateKey) {
+	if k.next != nil && !time.Now().Before(k.nextActivatesAt) {
+		return k.next.id, k.next.key
+	}
+	return k.current.id, k.current.key
+}
+
+// VerificationKey returns the public key with the given kid. Tokens issued
+// before key ids were introduced have no kid and are verified with the current key.
+func (k *KeyRing) VerificationKey(kid string) (*rsa.PublicKey, bool) {
+	if kid == "" {
+		return &k.current.key.PublicKey, true
+	}
+	key, ok := k.verificationKeys[kid]
+	return key, ok
+}
+
+// KeyFunc is a jwt.Keyfunc which looks up the verification key by the kid header.
+func (k *KeyRing) KeyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+		return nil, errutil.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	kid, _ := token.Header["kid"].(string)
+	key, ok := k.VerificationKey(kid)
+	if !ok {
+		return nil, errutil.Errorf("unknown key id %s", kid)
+	}
+	return key, nil
+}
+
+// JWKS returns the public keys of the ring as a JWK set.
+func (k *KeyRing) JWKS() JSONWebKeySet {
+	ids := make([]string, 0, len(k.verificationKeys))
+	for id := range k.verificationKeys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	set := JSONWebKeySet{Keys: make([]JSONWebKey, 0, len(ids))}
+	for _, id := range ids {
+		set.Keys = append(set.Keys, newJSONWebKey(id, k.verificationKeys[id]))
+	}
+	return set
+}
+
+// JSONWebKeySet is a JWK set as defined by RFC 7517.
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JSONWebKey is the JWK representation of an RSA public key.
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Kid string `json:"kid,omitempty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func newJSONWebKey(kid string, key *rsa.PublicKey) JSONWebKey {
+	return JSONWebKey{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: jwt.SigningMethodRS512.Alg(),
+		Kid: kid,
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+// PublicKey decodes the RSA public key of the JWK.
+func (k JSONWebKey) PublicKey() (*rsa.PublicKey, error) {
+	if k.Kty != "RSA" {
+		return nil, errutil.Errorf("unsupported key type %s", k.Kty)
+	}
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, errutil.Wrap(err, "invalid modulus")
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, errutil.Wrap(err, "invalid exponent")
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}, nil
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyRotation(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "TestKeyRotation")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	oldKey := mustWriteKey(t, tmpDir, "old.pem")
+	currentKey := mustWriteKey(t, tmpDir, "current.pem")
+	nextKey := mustWriteKey(t, tmpDir, "next.pem")
+
+	oldPublicKeyPath := filepath.Join(tmpDir, "old.pub.pem")
+	publicKeyData, err := x509.MarshalPKIXPublicKey(&oldKey.PublicKey)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(oldPublicKeyPath,
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyData}), 0600))
+
+	config := JWTConfig{
+		TokenValidityDuration: time.Minute,
+		PrivateKeyPath:        filepath.Join(tmpDir, "current.pem"),
+		NextPrivateKeyPath:    filepath.Join(tmpDir, "next.pem"),
+		NextKeyActivatesAt:    time.Now().Add(time.Hour),
+		VerificationKeyPaths:  []string{oldPublicKeyPath},
+	}
+
+	ring, err := NewKeyRing(config)
+	require.NoError(t, err)
+
+	kid, key := ring.SigningKey()
+	require.Equal(t, KeyID(&currentKey.PublicKey), kid)
+	require.Equal(t, currentKey, key)
+	require.Len(t, ring.JWKS().Keys, 3)
+
+	config.NextKeyActivatesAt = time.Now().Add(-time.Second)
+	ring, err = NewKeyRing(config)
+	require.NoError(t, err)
+
+	kid, _ = ring.SigningKey()
+	require.Equal(t, KeyID(&nextKey.PublicKey), kid)
+
+	// tokens signed with retired keys keep verifying, also through the published JWK set
+	oldToken := mustSign(t, KeyID(&oldKey.PublicKey), oldKey)
+	_, err = jwt.Parse(oldToken, ring.KeyFunc)
+	require.NoError(t, err)
+
+	server := httptest.NewServer(JWKSHandler(ring))
+	defer server.Close()
+
+	client := NewJWKSClient(server.URL, time.Minute)
+	_, err = jwt.Parse(oldToken, client.KeyFunc)
+	require.NoError(t, err)
+
+	unknownKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, err = jwt.Parse(mustSign(t, KeyID(&unknownKey.PublicKey), unknownKey), client.KeyFunc)
+	require.Error(t, err)
+}
+
+func TestRandomKeyRequiresOptIn(t *testing.T) {
+	_, err := NewKeyRing(JWTConfig{})
+	require.Error(t, err)
+
+	ring, err := NewKeyRing(JWTConfig{AllowRandomKey: true})
+	require.NoError(t, err)
+	kid, key := ring.SigningKey()
+	require.Equal(t, KeyID(&key.PublicKey), kid)
+}
+
+func mustWriteKey(t *testing.T, dir, name string) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), data, 0600))
+	return key
+}
+
+func mustSign(t *testing.T, kid string, key *rsa.PrivateKey) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS512, jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Minute).Unix()})
+	token.Header["kid"] = kid
+	tokenString, err := token.SignedString(key)
+	require.NoError(t, err)
+	return tokenString
+}
@@ -1,11 +1,10 @@
 package auth
 
 import (
-	"crypto/rsa"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/rs/zerolog/log"
@@ -13,30 +12,46 @@ import (
 	"github.com/mmrath/gobase/golang/pkg/errutil"
 )
 
+// SsoClientConfig configures how tokens issued by the sso server are verified.
+// Either JWKSURL or PubKeyPath must be set; JWKSURL is preferred as it follows
+// key rotations of the issuer.
 type SsoClientConfig struct {
-	CookieName string
-	PubKeyPath string
+	CookieName          string
+	PubKeyPath          string
+	JWKSURL             string
+	JWKSRefreshInterval time.Duration
 }
 
 type ssoMiddleware struct {
-	PubKey     *rsa.PublicKey
+	KeyFunc    jwt.Keyfunc
 	CookieName string
 	URL        string
 }
 
 func NewSsoMiddleware(cfg SsoClientConfig) (func(handler http.Handler) http.Handler, error) {
-	key, err := ioutil.ReadFile(cfg.PubKeyPath)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to load jwt public key")
-		return nil, errutil.Wrap(err, "failed to load jwt public key file")
+	if cfg.JWKSURL != "" {
+		refreshInterval := cfg.JWKSRefreshInterval
+		if refreshInterval == 0 {
+			refreshInterval = time.Minute
+		}
+		return (&ssoMiddleware{
+			KeyFunc:    NewJWKSClient(cfg.JWKSURL, refreshInterval).KeyFunc,
+			CookieName: cfg.CookieName,
+		}).SsoMiddleware, nil
 	}
-	parsedPubKey, err := jwt.ParseRSAPublicKeyFromPEM(key)
 
+	parsedPubKey, err := loadPublicKey(cfg.PubKeyPath)
 	if err != nil {
-		return nil, errutil.Wrap(err, "failed to parse public key from pem")
+		log.Error().Err(err).Msg("Failed to load jwt public key")
+		return nil, err
 	}
 	return (&ssoMiddleware{
-		PubKey:     parsedPubKey,
+		KeyFunc: func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+				return nil, errutil.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+			return parsedPubKey, nil
+		},
 		CookieName: cfg.CookieName,
 	}).SsoMiddleware, nil
 }
@@ -55,23 +70,16 @@ func (s *ssoMiddleware) SsoMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		parts := strings.Split(strings.Split(c.String(), "=")[1], ".")
-		err = jwt.SigningMethodRS512.Verify(strings.Join(parts[0:2], "."), parts[2], s.PubKey)
+		tokenString := strings.Split(c.String(), "=")[1]
+		token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, s.KeyFunc)
 		if err != nil {
 			log.Error().Err(err).Msg("error while verifying key")
 			errutil.RenderError(w, r, err)
 			return
 		}
 
-		tokenString := strings.Split(c.String(), "=")[1]
-		token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-			return s.PubKey, nil
-		})
-
-		claims, ok := token.Claims.(*CustomClaims) // claims.User and claims.Roles are what we are interested in.
+		_, ok := token.Claims.(*CustomClaims)
 		if ok && token.Valid {
-			fmt.Printf("User: %v Roles: %v Tok_Expires: %v \n", claims.Email, claims.Roles, claims.StandardClaims.ExpiresAt)
-
 			next.ServeHTTP(w, r)
 
 		} else {
@@ -1,12 +1,205 @@
 package config
 
 import (
-	"github.com/kelseyhightower/envconfig"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v2"
 
 	"github.com/mmrath/gobase/golang/pkg/errutil"
 )
 
+// Options select the YAML files a configuration is loaded from.
+type Options struct {
+	// Dir holds app.yml and the profile files app-<profile>.yml. Files missing
+	// from Dir are skipped, except the file of the selected profile.
+	Dir string
+	// Profile selects app-<profile>.yml, which overrides app.yml.
+	Profile string
+	// File is loaded after the files in Dir and must exist.
+	File string
+}
+
+// OptionsFromEnv returns options read from CONFIG_DIR, CONFIG_PROFILE and
+// CONFIG_FILE, with dir as the directory if CONFIG_DIR is not set.
+func OptionsFromEnv(dir string) Options {
+	if value, ok := os.LookupEnv("CONFIG_DIR"); ok {
+		dir = value
+	}
+	return Options{
+		Dir:     dir,
+		Profile: os.Getenv("CONFIG_PROFILE"),
+		File:    os.Getenv("CONFIG_FILE"),
+	}
+}
+
+// RegisterFlags registers the --config-dir, --profile and --config flags, using
+// the current options as defaults.
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Dir, "config-dir", o.Dir, "directory of app.yml and app-<profile>.yml")
+	fs.StringVar(&o.Profile, "profile", o.Profile, "configuration profile, selects app-<profile>.yml")
+	fs.StringVar(&o.File, "config", o.File, "configuration file overriding the files in the config directory")
+}
+
+// Load fills cfg, a pointer to a struct, in layers: the default tags, app.yml,
+// app-<profile>.yml, the file of opts and finally the environment variables
+// envconfig would read. Keys in the YAML files which do not match a field are an
+// error, as is every field tagged required which is still empty afterwards.
+func Load(cfg interface{}, opts Options) error {
+	_, err := load(cfg, opts)
+	return err
+}
+
+// Print loads cfg like Load and writes every value with its source. Secrets are
+// masked. Values are written even if required ones are missing, which is
+// reported by the returned error.
+func Print(w io.Writer, cfg interface{}, opts Options) error {
+	fields, err := load(cfg, opts)
+	if fields == nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ENV\tYAML\tVALUE\tSOURCE")
+	for _, f := range fields {
+		source := f.source
+		if source == "" {
+			source = "unset"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%v\t%s\n", f.key, f.name, f.value.Interface(), source)
+	}
+	if flushErr := tw.Flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+func load(cfg interface{}, opts Options) ([]field, error) {
+	fields, err := gatherFields(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range fields {
+		f := &fields[i]
+		if f.defaultValue == "" {
+			continue
+		}
+		if err := parseValue(f.defaultValue, f.value); err != nil {
+			return nil, errutil.Wrapf(err, "invalid default %q of %s", f.defaultValue, f.name)
+		}
+		f.source = "default"
+	}
+
+	for _, file := range opts.files() {
+		keys, err := loadFile(cfg, file.path, file.optional)
+		if err != nil {
+			return nil, err
+		}
+		for i := range fields {
+			if keys[fields[i].name] {
+				fields[i].source = file.path
+			}
+		}
+	}
+
+	for i := range fields {
+		f := &fields[i]
+		value, source, err := f.lookupEnv()
+		if err != nil {
+			return nil, err
+		}
+		if source == "" {
+			continue
+		}
+		if err := parseValue(value, f.value); err != nil {
+			return nil, errutil.Wrapf(err, "invalid value of %s", f.key)
+		}
+		f.source = source
+	}
+
+	var missing []string
+	for _, f := range fields {
+		if f.required && isZero(f.value) {
+			missing = append(missing, f.describe())
+		}
+	}
+	if len(missing) > 0 {
+		return fields, errutil.Errorf("missing required configuration: %s", strings.Join(missing, ", "))
+	}
+	return fields, nil
+}
+
+// LoadConfig fills cfg from its default tags and the environment.
 func LoadConfig(cfg interface{}) error {
-	err := envconfig.Process("", cfg)
+	err := Load(cfg, Options{})
 	return errutil.Wrap(err, "failed to load config")
 }
+
+type configFile struct {
+	path     string
+	optional bool
+}
+
+func (o Options) files() []configFile {
+	var files []configFile
+	if o.Dir != "" {
+		files = append(files, configFile{path: filepath.Join(o.Dir, "app.yml"), optional: true})
+		if o.Profile != "" {
+			files = append(files, configFile{path: filepath.Join(o.Dir, "app-"+o.Profile+".yml")})
+		}
+	}
+	if o.File != "" {
+		files = append(files, configFile{path: o.File})
+	}
+	return files
+}
+
+// loadFile fills cfg from a YAML file and returns the paths of the keys set in
+// it, like db and db.host.
+func loadFile(cfg interface{}, path string, optional bool) (map[string]bool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if optional && os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errutil.Wrapf(err, "failed to read config file %s", path)
+	}
+	if err = yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, errutil.Wrapf(err, "invalid config file %s", path)
+	}
+
+	var doc map[string]interface{}
+	if err = yaml.Unmarshal(data, &doc); err != nil {
+		return nil, errutil.Wrapf(err, "invalid config file %s", path)
+	}
+	keys := make(map[string]bool)
+	collectKeys(keys, "", doc)
+	return keys, nil
+}
+
+func collectKeys(keys map[string]bool, path string, node interface{}) {
+	add := func(key string, value interface{}) {
+		if path != "" {
+			key = path + "." + key
+		}
+		keys[key] = true
+		collectKeys(keys, key, value)
+	}
+	switch node := node.(type) {
+	case map[string]interface{}:
+		for key, value := range node {
+			add(key, value)
+		}
+	case map[interface{}]interface{}:
+		for key, value := range node {
+			add(fmt.Sprint(key), value)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testRetry struct {
+	MaxAttempts int           `default:"1" yaml:"maxAttempts"`
+	MaxBackoff  time.Duration `default:"1s" yaml:"maxBackoff"`
+}
+
+type testDB struct {
+	Host    string    `required:"true" yaml:"host"`
+	Port    int       `default:"5432" yaml:"port"`
+	SSLMode string    `default:"require" yaml:"sslMode"`
+	Retry   testRetry `yaml:"retry"`
+}
+
+type testConfig struct {
+	AppDomainName string   `required:"true" split_words:"true" yaml:"appDomainName"`
+	Origins       []string `yaml:"origins"`
+	DB            testDB   `yaml:"db"`
+}
+
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "TestLoad")
+	require.NoError(t, err)
+	for name, content := range files {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	}
+	return dir
+}
+
+func setEnv(t *testing.T, env map[string]string) func() {
+	for key, value := range env {
+		require.NoError(t, os.Setenv(key, value))
+	}
+	return func() {
+		for key := range env {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+func TestLoadLayers(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"app.yml": `
+appDomainName: example.com
+origins: [a, b]
+db:
+  host: localhost
+  port: 5433
+  retry:
+    maxAttempts: 3
+`,
+		"app-prod.yml": `
+db:
+  host: db.internal
+  retry:
+    maxBackoff: 2s
+`,
+	})
+	defer os.RemoveAll(dir)
+	defer setEnv(t, map[string]string{"DB_PORT": "6432", "DB_SSLMODE": "disable"})()
+
+	cfg := testConfig{}
+	require.NoError(t, Load(&cfg, Options{Dir: dir, Profile: "prod"}))
+
+	require.Equal(t, testConfig{
+		AppDomainName: "example.com",
+		Origins:       []string{"a", "b"},
+		DB: testDB{
+			Host:    "db.internal",
+			Port:    6432,
+			SSLMode: "disable",
+			Retry:   testRetry{MaxAttempts: 3, MaxBackoff: 2 * time.Second},
+		},
+	}, cfg)
+}
+
+func TestLoadExplicitFileOverridesDir(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"app.yml":   "appDomainName: example.com\ndb:\n  host: localhost\n",
+		"other.yml": "db:\n  host: other\n",
+	})
+	defer os.RemoveAll(dir)
+
+	cfg := testConfig{}
+	require.NoError(t, Load(&cfg, Options{Dir: dir, File: filepath.Join(dir, "other.yml")}))
+	require.Equal(t, "example.com", cfg.AppDomainName)
+	require.Equal(t, "other", cfg.DB.Host)
+
+	err := Load(&testConfig{}, Options{Dir: dir, File: filepath.Join(dir, "missing.yml")})
+	require.Error(t, err)
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"app.yml": "appDomainName: example.com\ndb:\n  url: postgres://localhost\n",
+	})
+	defer os.RemoveAll(dir)
+
+	err := Load(&testConfig{}, Options{Dir: dir})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "url")
+}
+
+func TestLoadRejectsMissingProfile(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{})
+	defer os.RemoveAll(dir)
+
+	err := Load(&testConfig{}, Options{Dir: dir, Profile: "prod"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "app-prod.yml")
+}
+
+func TestLoadListsMissingRequiredFields(t *testing.T) {
+	err := Load(&testConfig{}, Options{})
+	require.EqualError(t, err,
+		"missing required configuration: APP_DOMAIN_NAME (appDomainName), DB_HOST (db.host)")
+}
+
+type secretConfig struct {
+	Password Secret   `yaml:"password"`
+	Keys     []Secret `yaml:"keys"`
+	User     string   `yaml:"user"`
+}
+
+func TestSecretFromFile(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{"password": "s3cr3t\n"})
+	defer os.RemoveAll(dir)
+	defer setEnv(t, map[string]string{"PASSWORD_FILE": filepath.Join(dir, "password"), "KEYS": "k1,k2"})()
+
+	cfg := secretConfig{}
+	require.NoError(t, Load(&cfg, Options{}))
+	require.Equal(t, "s3cr3t", cfg.Password.Value())
+	require.Equal(t, []Secret{"k1", "k2"}, cfg.Keys)
+
+	defer setEnv(t, map[string]string{"PASSWORD": "other"})()
+	require.Error(t, Load(&secretConfig{}, Options{}))
+}
+
+func TestSecretIsMasked(t *testing.T) {
+	cfg := secretConfig{Password: "s3cr3t", Keys: []Secret{"k1"}, User: "admin"}
+
+	data, err := json.Marshal(cfg)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"Password":"******","Keys":["******"],"User":"admin"}`, string(data))
+	require.Equal(t, "{****** [******] admin}", fmt.Sprint(cfg))
+}
+
+func TestPrint(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{"app.yml": "user: admin\n"})
+	defer os.RemoveAll(dir)
+	defer setEnv(t, map[string]string{"PASSWORD": "s3cr3t"})()
+
+	var out bytes.Buffer
+	require.NoError(t, Print(&out, &secretConfig{}, Options{Dir: dir}))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 4)
+	require.Equal(t, []string{"PASSWORD", "password", "******", "env", "PASSWORD"}, strings.Fields(lines[1]))
+	require.Equal(t, []string{"KEYS", "keys", "[]", "unset"}, strings.Fields(lines[2]))
+	require.Equal(t, []string{"USER", "user", "admin", filepath.Join(dir, "app.yml")}, strings.Fields(lines[3]))
+}
+
+type reloadConfig struct {
+	Host string `yaml:"host"`
+	Web  struct {
+		Origins []string `yaml:"origins"`
+	} `yaml:"web" reload:"true"`
+	Timeout time.Duration `default:"1s" yaml:"timeout" reload:"true"`
+}
+
+func TestWatcherReload(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{"app.yml": "host: db\nweb:\n  origins: [a]\n"})
+	defer os.RemoveAll(dir)
+	opts := Options{Dir: dir}
+
+	cfg := reloadConfig{}
+	require.NoError(t, Load(&cfg, opts))
+
+	var reloaded []*reloadConfig
+	w := NewWatcher(&cfg, opts)
+	w.Subscribe(func(cfg interface{}) { reloaded = append(reloaded, cfg.(*reloadConfig)) })
+
+	require.NoError(t, w.Reload())
+	require.Empty(t, reloaded)
+
+	writeFile := func(content string) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "app.yml"), []byte(content), 0600))
+	}
+
+	writeFile("host: db\nweb:\n  origins: [a, b]\ntimeout: 2s\n")
+	require.NoError(t, w.Reload())
+	require.Len(t, reloaded, 1)
+	require.Equal(t, []string{"a", "b"}, reloaded[0].Web.Origins)
+	require.Equal(t, 2*time.Second, reloaded[0].Timeout)
+	require.Equal(t, reloaded[0], w.Current())
+
+	writeFile("host: other\n")
+	err := w.Reload()
+	require.EqualError(t, err, "changes of HOST (host) require a restart")
+	require.Len(t, reloaded, 1)
+
+	writeFile("host: db\ntimeout: nonsense\n")
+	require.Error(t, w.Reload())
+	require.Len(t, reloaded, 1)
+}
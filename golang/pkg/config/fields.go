@@ -0,0 +1,320 @@
+package config
+
+import (
+	"encoding"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+)
+
+// The environment variable names follow envconfig, so these are its expressions
+// for splitting field names into words.
+var (
+	gatherRegexp  = regexp.MustCompile("([^A-Z]+|[A-Z]+[^A-Z]+|[A-Z]+)")
+	acronymRegexp = regexp.MustCompile("([A-Z]+)([A-Z][^A-Z]+)")
+)
+
+type field struct {
+	value reflect.Value
+	// name is the path of the field in the YAML files, e.g. db.retry.maxAttempts.
+	name string
+	// key is the environment variable and alt its alternative without prefix.
+	key          string
+	alt          string
+	defaultValue string
+	required     bool
+	// reload is set for fields tagged reload, or within a struct tagged reload,
+	// which may change while the application runs.
+	reload bool
+	// source is where the value was loaded from, empty if it was not set.
+	source string
+}
+
+// lookupEnv returns the value of the field's environment variable and the
+// source of it. A secret can also be read from the file named by <key>_FILE.
+func (f field) lookupEnv() (value string, source string, err error) {
+	for _, key := range []string{f.key, f.alt} {
+		if key == "" {
+			continue
+		}
+		value, ok := os.LookupEnv(key)
+		if !isSecret(f.value) {
+			if ok {
+				return value, "env " + key, nil
+			}
+			continue
+		}
+		path, fileOk := os.LookupEnv(key + "_FILE")
+		switch {
+		case ok && fileOk:
+			return "", "", errutil.Errorf("only one of %s and %s_FILE may be set", key, key)
+		case ok:
+			return value, "env " + key, nil
+		case fileOk:
+			value, err = readSecretFile(path)
+			return value, "env " + key + "_FILE", err
+		}
+	}
+	return "", "", nil
+}
+
+func (f field) describe() string {
+	if f.name == "" || f.name == "-" {
+		return f.key
+	}
+	return f.key + " (" + f.name + ")"
+}
+
+func gatherFields(cfg interface{}) ([]field, error) {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return nil, errutil.New("config must be a pointer to a struct")
+	}
+	return gatherStruct(v.Elem(), "", "", false), nil
+}
+
+func gatherStruct(s reflect.Value, prefix, path string, reload bool) []field {
+	var fields []field
+	for i := 0; i < s.NumField(); i++ {
+		v := s.Field(i)
+		ftype := s.Type().Field(i)
+		if !v.CanSet() || isTrue(ftype.Tag.Get("ignored")) {
+			continue
+		}
+
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if v.Type().Elem().Kind() != reflect.Struct {
+					break
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+
+		f := field{
+			value:        v,
+			name:         yamlPath(path, ftype),
+			key:          envKey(prefix, ftype),
+			alt:          strings.ToUpper(ftype.Tag.Get("envconfig")),
+			defaultValue: ftype.Tag.Get("default"),
+			required:     isTrue(ftype.Tag.Get("required")),
+			reload:       reload || isTrue(ftype.Tag.Get("reload")),
+		}
+
+		if v.Kind() == reflect.Struct && !isScalar(v) {
+			innerPrefix, innerPath := f.key, f.name
+			if ftype.Anonymous {
+				innerPrefix, innerPath = prefix, path
+			}
+			fields = append(fields, gatherStruct(v, innerPrefix, innerPath, f.reload)...)
+			continue
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func envKey(prefix string, ftype reflect.StructField) string {
+	key := ftype.Name
+	if isTrue(ftype.Tag.Get("split_words")) {
+		var words []string
+		for _, match := range gatherRegexp.FindAllStringSubmatch(ftype.Name, -1) {
+			if m := acronymRegexp.FindStringSubmatch(match[0]); len(m) == 3 {
+				words = append(words, m[1], m[2])
+			} else {
+				words = append(words, match[0])
+			}
+		}
+		if len(words) > 0 {
+			key = strings.Join(words, "_")
+		}
+	}
+	if alt := ftype.Tag.Get("envconfig"); alt != "" {
+		key = alt
+	}
+	if prefix != "" {
+		key = prefix + "_" + key
+	}
+	return strings.ToUpper(key)
+}
+
+// yamlPath returns the path of the field in the YAML files, named like
+// yaml.v2 does, or "-" if YAML skips the field.
+func yamlPath(path string, ftype reflect.StructField) string {
+	if path == "-" {
+		return path
+	}
+	tag := strings.Split(ftype.Tag.Get("yaml"), ",")
+	name := tag[0]
+	switch {
+	case name == "-":
+		return "-"
+	case name == "":
+		name = strings.ToLower(ftype.Name)
+	}
+	for _, flag := range tag[1:] {
+		if flag == "inline" {
+			return path
+		}
+	}
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// isScalar reports whether a struct decodes itself from a single string.
+func isScalar(v reflect.Value) bool {
+	return decoderFrom(v) != nil || setterFrom(v) != nil || textUnmarshaler(v) != nil || binaryUnmarshaler(v) != nil
+}
+
+// parseValue converts value like envconfig does and stores it in v.
+func parseValue(value string, v reflect.Value) error {
+	if d := decoderFrom(v); d != nil {
+		return d.Decode(value)
+	}
+	if s := setterFrom(v); s != nil {
+		return s.Set(value)
+	}
+	if t := textUnmarshaler(v); t != nil {
+		return t.UnmarshalText([]byte(value))
+	}
+	if b := binaryUnmarshaler(v); b != nil {
+		return b.UnmarshalBinary([]byte(value))
+	}
+
+	typ := v.Type()
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+		if v.IsNil() {
+			v.Set(reflect.New(typ))
+		}
+		v = v.Elem()
+	}
+
+	switch typ.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if typ == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return err
+			}
+			v.SetInt(int64(d))
+			return nil
+		}
+		i, err := strconv.ParseInt(value, 0, typ.Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 0, typ.Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, typ.Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		sl := reflect.MakeSlice(typ, 0, 0)
+		if typ.Elem().Kind() == reflect.Uint8 {
+			sl = reflect.ValueOf([]byte(value))
+		} else if strings.TrimSpace(value) != "" {
+			values := strings.Split(value, ",")
+			sl = reflect.MakeSlice(typ, len(values), len(values))
+			for i, value := range values {
+				if err := parseValue(value, sl.Index(i)); err != nil {
+					return err
+				}
+			}
+		}
+		v.Set(sl)
+	case reflect.Map:
+		m := reflect.MakeMap(typ)
+		if strings.TrimSpace(value) != "" {
+			for _, pair := range strings.Split(value, ",") {
+				kv := strings.Split(pair, ":")
+				if len(kv) != 2 {
+					return errutil.Errorf("invalid map item: %q", pair)
+				}
+				key := reflect.New(typ.Key()).Elem()
+				if err := parseValue(kv[0], key); err != nil {
+					return err
+				}
+				elem := reflect.New(typ.Elem()).Elem()
+				if err := parseValue(kv[1], elem); err != nil {
+					return err
+				}
+				m.SetMapIndex(key, elem)
+			}
+		}
+		v.Set(m)
+	default:
+		return errutil.Errorf("unsupported type %s", typ)
+	}
+	return nil
+}
+
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+func interfaceFrom(v reflect.Value, fn func(interface{}, *bool)) {
+	if !v.CanInterface() {
+		return
+	}
+	var ok bool
+	fn(v.Interface(), &ok)
+	if !ok && v.CanAddr() {
+		fn(v.Addr().Interface(), &ok)
+	}
+}
+
+func decoderFrom(v reflect.Value) (d envconfig.Decoder) {
+	interfaceFrom(v, func(i interface{}, ok *bool) { d, *ok = i.(envconfig.Decoder) })
+	return d
+}
+
+func setterFrom(v reflect.Value) (s envconfig.Setter) {
+	interfaceFrom(v, func(i interface{}, ok *bool) { s, *ok = i.(envconfig.Setter) })
+	return s
+}
+
+func textUnmarshaler(v reflect.Value) (t encoding.TextUnmarshaler) {
+	interfaceFrom(v, func(i interface{}, ok *bool) { t, *ok = i.(encoding.TextUnmarshaler) })
+	return t
+}
+
+func binaryUnmarshaler(v reflect.Value) (b encoding.BinaryUnmarshaler) {
+	interfaceFrom(v, func(i interface{}, ok *bool) { b, *ok = i.(encoding.BinaryUnmarshaler) })
+	return b
+}
+
+func isTrue(s string) bool {
+	b, _ := strconv.ParseBool(s)
+	return b
+}
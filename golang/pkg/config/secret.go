@@ -0,0 +1,60 @@
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"strings"
+
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+)
+
+const redacted = "******"
+
+// Secret is a configuration value which must not be disclosed, like a password.
+// It is masked when formatted or marshalled, so a config can be logged as a
+// whole. Besides the environment variable, a secret can be read from the file
+// named by the variable with a _FILE suffix, e.g. DB_PASSWORD_FILE, which is how
+// Kubernetes and Docker mount secrets.
+type Secret string
+
+// Value returns the secret in clear text.
+func (s Secret) Value() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s Secret) MarshalYAML() (interface{}, error) {
+	return s.String(), nil
+}
+
+var secretType = reflect.TypeOf(Secret(""))
+
+// isSecret reports whether v holds a secret or a list of secrets.
+func isSecret(v reflect.Value) bool {
+	t := v.Type()
+	if t.Kind() == reflect.Slice || t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t == secretType
+}
+
+// readSecretFile returns the content of the file without the trailing line break
+// editors and kubectl tend to add.
+func readSecretFile(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", errutil.Wrapf(err, "failed to read secret file %s", path)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
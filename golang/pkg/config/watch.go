@@ -0,0 +1,148 @@
+package config
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+)
+
+// pollInterval is how often the config files are checked for changes.
+const pollInterval = 5 * time.Second
+
+// Watcher reloads a configuration when one of its files changes or the process
+// receives SIGHUP. Only fields tagged reload, or within a struct tagged reload,
+// may change. A reload which changes any other field, like the DB host, is
+// rejected and the running configuration is kept until the application is
+// restarted.
+type Watcher struct {
+	opts Options
+
+	mu          sync.Mutex
+	current     interface{}
+	modTimes    map[string]time.Time
+	subscribers []func(cfg interface{})
+}
+
+// NewWatcher returns a watcher of cfg, a pointer to a struct loaded with opts.
+func NewWatcher(cfg interface{}, opts Options) *Watcher {
+	w := &Watcher{opts: opts, current: cfg}
+	w.modTimes = w.statFiles()
+	return w
+}
+
+// Subscribe registers fn to be called with every reloaded configuration, a
+// pointer of the same type as the one passed to NewWatcher. Subscribers are
+// called one reload at a time and must not call the watcher.
+func (w *Watcher) Subscribe(fn func(cfg interface{})) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subscribers = append(w.subscribers, fn)
+}
+
+// Current returns the configuration of the last successful reload.
+func (w *Watcher) Current() interface{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current
+}
+
+// Run reloads the configuration on SIGHUP and when the files change, until ctx
+// is done.
+func (w *Watcher) Run(ctx context.Context) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			log.Info().Msg("reloading config on SIGHUP")
+		case <-ticker.C:
+			if !w.filesChanged() {
+				continue
+			}
+			log.Info().Msg("reloading config on file change")
+		}
+		if err := w.Reload(); err != nil {
+			log.Error().Err(err).Msg("config reload failed, keeping the running config")
+		}
+	}
+}
+
+// Reload loads the configuration again and passes it to the subscribers, unless
+// it is invalid or changes fields which cannot be reloaded.
+func (w *Watcher) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.modTimes = w.statFiles()
+
+	next := reflect.New(reflect.TypeOf(w.current).Elem()).Interface()
+	nextFields, err := load(next, w.opts)
+	if err != nil {
+		return err
+	}
+	currentFields, err := gatherFields(w.current)
+	if err != nil {
+		return err
+	}
+
+	var changed, structural []string
+	for i, f := range currentFields {
+		if reflect.DeepEqual(f.value.Interface(), nextFields[i].value.Interface()) {
+			continue
+		}
+		if f.reload {
+			changed = append(changed, f.describe())
+		} else {
+			structural = append(structural, f.describe())
+		}
+	}
+	if len(structural) > 0 {
+		return errutil.Errorf("changes of %s require a restart", strings.Join(structural, ", "))
+	}
+	if len(changed) == 0 {
+		log.Info().Msg("config unchanged")
+		return nil
+	}
+
+	w.current = next
+	for _, fn := range w.subscribers {
+		fn(next)
+	}
+	log.Info().Strs("changed", changed).Msg("config reloaded")
+	return nil
+}
+
+func (w *Watcher) filesChanged() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return !reflect.DeepEqual(w.modTimes, w.statFiles())
+}
+
+// statFiles returns the modification times of the config files, the zero time
+// for files which do not exist.
+func (w *Watcher) statFiles() map[string]time.Time {
+	modTimes := make(map[string]time.Time)
+	for _, file := range w.opts.files() {
+		var modTime time.Time
+		if info, err := os.Stat(file.path); err == nil {
+			modTime = info.ModTime()
+		}
+		modTimes[file.path] = modTime
+	}
+	return modTimes
+}
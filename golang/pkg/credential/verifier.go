@@ -0,0 +1,146 @@
+// Package credential verifies the passwords of user accounts.
+package credential
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/mmrath/gobase/golang/pkg/crypto"
+	"github.com/mmrath/gobase/golang/pkg/db"
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+	"github.com/mmrath/gobase/golang/pkg/model"
+)
+
+// MaxInvalidAttempts is the number of failed logins after which an account is locked.
+const MaxInvalidAttempts = 3
+
+const invalidCredentialMsg = "invalid email or password"
+
+// Verifier checks the email and password of a login and applies the account
+// lockout and expiry rules shared by all applications.
+type Verifier struct {
+	userDao           model.UserDao
+	userCredentialDao model.UserCredentialDao
+	onLockout         func()
+	accountType       *model.AccountType
+}
+
+func NewVerifier() *Verifier {
+	return &Verifier{
+		userDao:           model.NewUserDao(),
+		userCredentialDao: model.NewUserCredentialDao(),
+		onLockout:         func() {},
+	}
+}
+
+// OnLockout sets a function which is called when a failed login locks the
+// account, e.g. to count lockouts. It returns v.
+func (v *Verifier) OnLockout(fn func()) *Verifier {
+	v.onLockout = fn
+	return v
+}
+
+// ForAccountType restricts logins to accounts of type t. Other accounts are
+// rejected like unknown emails, without counting the attempt against them. It returns v.
+func (v *Verifier) ForAccountType(t model.AccountType) *Verifier {
+	v.accountType = &t
+	return v
+}
+
+// VerifyTx returns the user with the given email if the password matches.
+// Failed attempts are counted in tx, so the caller must commit tx even when
+// a client error is returned for the lockout to take effect.
+func (v *Verifier) VerifyTx(tx *db.Tx, login model.LoginRequest) (model.User, error) {
+	user, err := v.userDao.FindByEmail(tx, login.Email)
+
+	if err != nil {
+		if db.IsNoDataFound(err) {
+			return user, rejectUnknown(login)
+		}
+		return user, errutil.Wrap(err, "failed to find user by email")
+	}
+	if v.accountType != nil && user.AccountType != *v.accountType {
+		return user, rejectUnknown(login)
+	}
+
+	if !user.Active {
+		return user, errutil.NewUnauthorized("user is not active")
+	}
+	var uc model.UserCredential
+	uc, err = v.userCredentialDao.Get(tx, user.ID)
+	if err != nil {
+		if db.IsNoDataFound(err) {
+			return user, errutil.NewUnauthorized(invalidCredentialMsg)
+		}
+		return user, errutil.Wrap(err, "failed to get credentials from db")
+	}
+
+	if !uc.Activated {
+		return user, errutil.NewUnauthorized("user is not activated")
+	} else if !uc.ExpiresAt.IsZero() && uc.ExpiresAt.Before(time.Now()) {
+		return user, errutil.NewUnauthorized("password expired")
+	} else if uc.Locked {
+		return user, errutil.NewUnauthorized("account is locked")
+	}
+
+	if uc.PasswordHash == "" {
+		// passwordless accounts log in by email only
+		return user, errutil.NewUnauthorized(invalidCredentialMsg)
+	}
+
+	var matched bool
+	matched, err = crypto.CheckPassword(login.Password, uc.PasswordHash)
+
+	if err != nil {
+		return user, errutil.Wrap(err, "failed to check password")
+	}
+
+	if !matched {
+		if uc.InvalidAttempts >= MaxInvalidAttempts {
+			err = v.userCredentialDao.IncrementInvalidAttempts(tx, user.ID, true)
+			if err != nil {
+				return user, errutil.Wrapf(err, "failed to lock and increment invalid attempts")
+			}
+			v.onLockout()
+		} else {
+			err = v.userCredentialDao.IncrementInvalidAttempts(tx, user.ID, false)
+			if err != nil {
+				return user, errutil.Wrapf(err, "failed to increment invalid attempts")
+			}
+		}
+		return user, errutil.NewUnauthorized(invalidCredentialMsg)
+	}
+
+	if uc.InvalidAttempts > 0 {
+		err = v.userCredentialDao.ResetInvalidAttempts(tx, user.ID)
+		if err != nil {
+			// allow user to login, don't report error here
+			log.Error().Err(err).Msg("failed resetting invalid attempts")
+		}
+	}
+	return user, nil
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// rejectUnknown returns the error for a login with an unknown email after
+// checking the password against a dummy hash, so that the response time does
+// not tell whether an account exists.
+func rejectUnknown(login model.LoginRequest) error {
+	dummyHashOnce.Do(func() {
+		var err error
+		dummyHash, err = crypto.HashPassword("dummy password")
+		if err != nil {
+			log.Error().Err(err).Msg("failed to hash dummy password")
+		}
+	})
+	if dummyHash != "" {
+		_, _ = crypto.CheckPassword(login.Password, dummyHash)
+	}
+	return errutil.NewUnauthorized(invalidCredentialMsg)
+}
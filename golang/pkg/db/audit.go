@@ -0,0 +1,36 @@
+package db
+
+import (
+	"context"
+
+	"github.com/go-chi/chi/middleware"
+
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+)
+
+type auditUserIDKey struct{}
+
+// NewAuditContext returns a context whose transactions are attributed to the
+// application user with the given id. It is recorded by the audit trigger in
+// audit.logged_actions and fills the updated_by column of audited tables.
+func NewAuditContext(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, auditUserIDKey{}, userID)
+}
+
+func auditUserIDFromContext(ctx context.Context) string {
+	userID, _ := ctx.Value(auditUserIDKey{}).(string)
+	return userID
+}
+
+// setAuditContext makes the application user and the request id of ctx
+// available to the triggers for the rest of the transaction.
+func (tx *Tx) setAuditContext(ctx context.Context) error {
+	userID := auditUserIDFromContext(ctx)
+	requestID := middleware.GetReqID(ctx)
+	if userID == "" && requestID == "" {
+		return nil
+	}
+	err := tx.Exec("SELECT set_config('app.user_id', ?, true), set_config('app.request_id', ?, true)",
+		userID, requestID).Error
+	return errutil.Wrap(err, "failed to set audit context")
+}
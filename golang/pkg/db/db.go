@@ -2,7 +2,9 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
+	"time"
 
 	"github.com/jinzhu/gorm"
 
@@ -10,18 +12,23 @@ import (
 	_ "github.com/jinzhu/gorm/dialects/postgres"
 	"github.com/rotisserie/eris"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/mmrath/gobase/golang/pkg/config"
 	"github.com/mmrath/gobase/golang/pkg/errutil"
+	"github.com/mmrath/gobase/golang/pkg/tracing"
 )
 
 type Config struct {
-	Host     string
-	Port     int `default:"5432"`
-	Username string
-	Password string
-	Name     string
-	SSLMode  string `default:"require"`
-	Debug    bool   `default:"false" yaml:"debug"`
+	Host     string        `yaml:"host"`
+	Port     int           `default:"5432" yaml:"port"`
+	Username string        `yaml:"username"`
+	Password config.Secret `yaml:"password"`
+	Name     string        `yaml:"name"`
+	SSLMode  string        `default:"require" yaml:"sslMode"`
+	Debug    bool          `default:"false" yaml:"debug"`
+	Retry    RetryPolicy   `yaml:"retry"`
 }
 
 // DBConn returns a postgres connection pool.
@@ -30,49 +37,126 @@ func Open(cfg Config) (*DB, error) {
 
 	db, err := gorm.Open("postgres", cfg.URL())
 
-	db.SingularTable(true)
-
 	if err != nil {
 		return nil, eris.Wrapf(err, "failed to open connection")
 	}
 
+	db.SingularTable(true)
+	registerTracing(db)
+
 	log.Info().Msg("successfully connected to db")
 
 	if cfg.Debug {
 		db = db.Debug()
 	}
 
-	return &DB{db}, nil
+	return &DB{gorm: db, retry: cfg.Retry}, nil
 }
 
 func (c Config) URL() string {
-	return fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=%s", c.Username, c.Password, c.Host, c.Port, c.Name, c.SSLMode)
+	return fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=%s", c.Username, c.Password.Value(), c.Host, c.Port, c.Name, c.SSLMode)
 }
 
 type DB struct {
-	gorm *gorm.DB
+	gorm  *gorm.DB
+	retry RetryPolicy
+}
+
+// WithRetryPolicy returns a DB sharing the connection pool of db, whose
+// transactions are retried according to policy.
+func (db *DB) WithRetryPolicy(policy RetryPolicy) *DB {
+	return &DB{gorm: db.gorm, retry: policy}
 }
 
 func IsNoDataFound(err error) bool {
 	return gorm.IsRecordNotFoundError(err)
 }
 
+// Close closes the connection pool.
+func (db *DB) Close() error {
+	return db.gorm.Close()
+}
+
+// Ping checks that a connection to the database can be established.
+func (db *DB) Ping(ctx context.Context) error {
+	return errutil.Wrap(db.gorm.DB().PingContext(ctx), "failed to ping db")
+}
+
+// SchemaVersion returns the version of the last migration applied by
+// db-migration, and whether it failed half way.
+func (db *DB) SchemaVersion(ctx context.Context) (version int64, dirty bool, err error) {
+	row := db.gorm.DB().QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1")
+	err = row.Scan(&version, &dirty)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	return version, dirty, errutil.Wrap(err, "failed to read schema version")
+}
+
+// RunInTx runs fn in a transaction, which is committed if fn returns nil and
+// rolled back if it returns an error or panics.
 func (db *DB) RunInTx(ctx context.Context, fn func(tx *Tx) error) error {
-	gormTx := db.gorm.BeginTx(ctx, nil)
+	return db.RunInTxWithOptions(ctx, nil, fn)
+}
+
+// RunInTxWithOptions is like RunInTx, but starts the transaction with the given
+// isolation level and read-only mode. nil options use the database defaults.
+//
+// If the transaction fails with a serialization failure or a deadlock, it is run
+// again as configured by the retry policy of db. fn must therefore not have side
+// effects outside of tx.
+func (db *DB) RunInTxWithOptions(ctx context.Context, opts *sql.TxOptions, fn func(tx *Tx) error) error {
+	for attempt := 1; ; attempt++ {
+		err := db.runInTx(ctx, opts, fn)
+		if err == nil || attempt >= db.retry.MaxAttempts || !IsRetryable(err) {
+			return err
+		}
+		log.Warn().Err(err).Int("attempt", attempt).Msg("retrying db transaction")
+		if !db.retry.wait(ctx, attempt) {
+			return err
+		}
+	}
+}
+
+func (db *DB) runInTx(ctx context.Context, opts *sql.TxOptions, fn func(tx *Tx) error) (err error) {
+	start := time.Now()
+	// a panic in fn is rolled back by cleanUp
+	outcome := outcomeRollback
+	ctx, span := tracing.Start(ctx, "db.transaction", trace.WithAttributes(semconv.DBSystemPostgres))
+	defer func() {
+		observeTx(start, outcome)
+		span.SetAttributes(txOutcomeKey.String(outcome))
+		tracing.End(span, err)
+	}()
+
+	gormTx := db.gorm.BeginTx(ctx, opts)
 	if gormTx.Error != nil {
+		outcome = outcomeError
 		return errutil.Wrap(gormTx.Error, "failed to begin db transaction")
 	}
 
-	tx := &Tx{gormTx}
+	tx := newTx(gormTx.Set(traceContextKey, ctx))
 
 	defer tx.cleanUp()
 
-	if err := fn(tx); err != nil {
-		_ = tx.Commit()
+	err = tx.setAuditContext(ctx)
+	if err == nil {
+		err = fn(tx)
+	}
+	if err != nil {
+		if rbErr := tx.Rollback().Error; rbErr != nil {
+			// we return the original error
+			log.Error().Err(rbErr).Msg("error while rolling back transaction")
+		}
 		return err
 	}
 
-	return tx.Commit().Error
+	if err = tx.Commit().Error; err != nil {
+		outcome = outcomeError
+		return errutil.Wrap(err, "failed to commit db transaction")
+	}
+	outcome = outcomeCommit
+	return nil
 }
 
 func (db *DB) BeginTx(ctx context.Context) (*Tx, error) {
@@ -80,7 +164,7 @@ func (db *DB) BeginTx(ctx context.Context) (*Tx, error) {
 	if gormTx.Error != nil {
 		return nil, errutil.Wrap(gormTx.Error, "failed to begin db transaction")
 	}
-	return &Tx{gormTx}, nil
+	return newTx(gormTx), nil
 }
 
 func (tx *Tx) Close() {
@@ -97,6 +181,40 @@ func (tx *Tx) Close() {
 
 type Tx struct {
 	*gorm.DB
+	// savepoints counts the savepoints created in this transaction, to give each a unique name
+	savepoints *int
+}
+
+func newTx(gormTx *gorm.DB) *Tx {
+	return &Tx{DB: gormTx, savepoints: new(int)}
+}
+
+// RunInTx runs fn in a savepoint of tx. If fn returns an error or panics, only
+// the changes made by fn are rolled back and tx can still be used and committed.
+func (tx *Tx) RunInTx(fn func(tx *Tx) error) error {
+	*tx.savepoints++
+	name := fmt.Sprintf("sp_%d", *tx.savepoints)
+
+	if err := tx.Exec("SAVEPOINT " + name).Error; err != nil {
+		return errutil.Wrap(err, "failed to create savepoint")
+	}
+
+	defer func() {
+		if err := recover(); err != nil {
+			_ = tx.Exec("ROLLBACK TO SAVEPOINT " + name)
+			panic(err)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Exec("ROLLBACK TO SAVEPOINT " + name).Error; rbErr != nil {
+			// we return the original error
+			log.Error().Err(rbErr).Msg("error while rolling back to savepoint")
+		}
+		return err
+	}
+
+	return errutil.Wrap(tx.Exec("RELEASE SAVEPOINT "+name).Error, "failed to release savepoint")
 }
 
 func (tx *Tx) cleanUp() {
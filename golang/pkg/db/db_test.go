@@ -0,0 +1,225 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+)
+
+// testDB is nil if the test database is not running, in which case the tests are skipped.
+var testDB *DB
+
+func TestMain(m *testing.M) {
+	portPrefix := os.Getenv("E2E_TEST_PORT_PREFIX")
+	if portPrefix == "" {
+		portPrefix = "40"
+	}
+	port, err := strconv.Atoi(portPrefix + "32")
+	if err != nil {
+		panic(err)
+	}
+
+	testDB, err = Open(Config{
+		Host:     "localhost",
+		Port:     port,
+		Username: "db_migration",
+		Password: "s3cr3t_3",
+		Name:     "devdb",
+		SSLMode:  "disable",
+	})
+	if err != nil {
+		fmt.Printf("skipping db tests, database is not available: %v\n", err)
+		testDB = nil
+		os.Exit(m.Run())
+	}
+
+	mustExec("CREATE TABLE IF NOT EXISTS tx_test(id SERIAL PRIMARY KEY, name TEXT NOT NULL)")
+	code := m.Run()
+	mustExec("DROP TABLE tx_test")
+	os.Exit(code)
+}
+
+func mustExec(stmt string) {
+	if err := testDB.gorm.Exec(stmt).Error; err != nil {
+		panic(err)
+	}
+}
+
+func setUp(t *testing.T) {
+	if testDB == nil {
+		t.Skip("database is not available")
+	}
+	mustExec("TRUNCATE tx_test")
+}
+
+func insert(tx *Tx, name string) error {
+	return tx.Exec("INSERT INTO tx_test(name) VALUES (?)", name).Error
+}
+
+func count(t *testing.T, name string) int {
+	var n int
+	err := testDB.gorm.Raw("SELECT count(*) FROM tx_test WHERE name = ?", name).Row().Scan(&n)
+	require.NoError(t, err)
+	return n
+}
+
+func TestRunInTxCommits(t *testing.T) {
+	setUp(t)
+
+	err := testDB.RunInTx(context.Background(), func(tx *Tx) error {
+		return insert(tx, "committed")
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, count(t, "committed"))
+}
+
+func TestRunInTxRollsBackOnError(t *testing.T) {
+	setUp(t)
+	fnErr := errors.New("failed")
+
+	err := testDB.RunInTx(context.Background(), func(tx *Tx) error {
+		require.NoError(t, insert(tx, "rolled back"))
+		return fnErr
+	})
+	require.Equal(t, fnErr, err)
+	require.Equal(t, 0, count(t, "rolled back"))
+}
+
+func TestRunInTxRollsBackOnPanic(t *testing.T) {
+	setUp(t)
+
+	require.Panics(t, func() {
+		_ = testDB.RunInTx(context.Background(), func(tx *Tx) error {
+			require.NoError(t, insert(tx, "panicked"))
+			panic("failed")
+		})
+	})
+	require.Equal(t, 0, count(t, "panicked"))
+}
+
+func TestNestedRunInTxRollsBackToSavepoint(t *testing.T) {
+	setUp(t)
+
+	err := testDB.RunInTx(context.Background(), func(tx *Tx) error {
+		require.NoError(t, insert(tx, "outer"))
+
+		err := tx.RunInTx(func(tx *Tx) error {
+			require.NoError(t, insert(tx, "inner"))
+			// a failing statement aborts the transaction up to the savepoint
+			return tx.Exec("INSERT INTO tx_test(name) VALUES (NULL)").Error
+		})
+		require.Error(t, err)
+
+		err = tx.RunInTx(func(tx *Tx) error {
+			return insert(tx, "released")
+		})
+		require.NoError(t, err)
+		return insert(tx, "outer")
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, count(t, "outer"))
+	require.Equal(t, 0, count(t, "inner"))
+	require.Equal(t, 1, count(t, "released"))
+}
+
+func TestNestedRunInTxIsRolledBackWithOuter(t *testing.T) {
+	setUp(t)
+	fnErr := errors.New("failed")
+
+	err := testDB.RunInTx(context.Background(), func(tx *Tx) error {
+		err := tx.RunInTx(func(tx *Tx) error {
+			return insert(tx, "inner")
+		})
+		require.NoError(t, err)
+		return fnErr
+	})
+	require.Equal(t, fnErr, err)
+	require.Equal(t, 0, count(t, "inner"))
+}
+
+func TestRunInTxWithOptions(t *testing.T) {
+	setUp(t)
+
+	err := testDB.RunInTxWithOptions(context.Background(), &sql.TxOptions{ReadOnly: true}, func(tx *Tx) error {
+		return insert(tx, "read only")
+	})
+	require.Error(t, err)
+	require.Equal(t, 0, count(t, "read only"))
+
+	opts := &sql.TxOptions{Isolation: sql.LevelSerializable}
+	err = testDB.RunInTxWithOptions(context.Background(), opts, func(tx *Tx) error {
+		var level string
+		err := tx.Raw("SHOW transaction_isolation").Row().Scan(&level)
+		require.NoError(t, err)
+		require.Equal(t, "serializable", level)
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestRunInTxRetriesSerializationFailures(t *testing.T) {
+	setUp(t)
+	retryDB := testDB.WithRetryPolicy(RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+
+	attempts := 0
+	err := retryDB.RunInTx(context.Background(), func(tx *Tx) error {
+		attempts++
+		require.NoError(t, insert(tx, "retried"))
+		if attempts < 3 {
+			return errutil.Wrap(&pq.Error{Code: serializationFailure}, "conflict")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, attempts)
+	require.Equal(t, 1, count(t, "retried"))
+
+	attempts = 0
+	err = retryDB.RunInTx(context.Background(), func(tx *Tx) error {
+		attempts++
+		return &pq.Error{Code: deadlockDetected}
+	})
+	require.True(t, IsRetryable(err))
+	require.Equal(t, 3, attempts)
+}
+
+func TestIsRetryable(t *testing.T) {
+	require.True(t, IsRetryable(errutil.Wrap(&pq.Error{Code: serializationFailure}, "failed")))
+	require.True(t, IsRetryable(&pq.Error{Code: deadlockDetected}))
+	require.False(t, IsRetryable(&pq.Error{Code: "23505"}))
+	require.False(t, IsRetryable(errors.New("failed")))
+}
+
+func TestRunInTxSetsAuditContext(t *testing.T) {
+	setUp(t)
+	ctx := NewAuditContext(context.Background(), "42")
+
+	err := testDB.RunInTx(ctx, func(tx *Tx) error {
+		var userID string
+		err := tx.Raw("SELECT current_setting('app.user_id', true)").Row().Scan(&userID)
+		require.NoError(t, err)
+		require.Equal(t, "42", userID)
+		return nil
+	})
+	require.NoError(t, err)
+
+	// the setting is local to the transaction
+	err = testDB.RunInTx(context.Background(), func(tx *Tx) error {
+		var userID sql.NullString
+		err := tx.Raw("SELECT current_setting('app.user_id', true)").Row().Scan(&userID)
+		require.NoError(t, err)
+		require.Empty(t, userID.String)
+		return nil
+	})
+	require.NoError(t, err)
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mmrath/gobase/golang/pkg/metrics"
+)
+
+const (
+	outcomeCommit   = "commit"
+	outcomeRollback = "rollback"
+	outcomeError    = "error"
+)
+
+var (
+	txTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "db_transactions_total",
+		Help: "Number of transactions run by RunInTx by outcome: commit, rollback or error if the transaction could not be started or committed.",
+	}, []string{"outcome"})
+	txDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "db_transaction_duration_seconds",
+		Help:    "Duration of transactions run by RunInTx by outcome.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"outcome"})
+)
+
+func init() {
+	metrics.MustRegister(txTotal, txDuration)
+}
+
+func observeTx(start time.Time, outcome string) {
+	txTotal.WithLabelValues(outcome).Inc()
+	txDuration.WithLabelValues(outcome).Observe(time.Since(start).Seconds())
+}
+
+// StatsCollector returns a collector of the connection pool statistics of db.
+// It is registered by the application, as there may be several pools.
+func (db *DB) StatsCollector() prometheus.Collector {
+	return &statsCollector{db: db.gorm.DB()}
+}
+
+var (
+	openConnectionsDesc = prometheus.NewDesc("db_open_connections",
+		"Number of established connections, in use and idle.", nil, nil)
+	inUseDesc = prometheus.NewDesc("db_in_use_connections",
+		"Number of connections in use.", nil, nil)
+	idleDesc = prometheus.NewDesc("db_idle_connections",
+		"Number of idle connections.", nil, nil)
+	maxOpenDesc = prometheus.NewDesc("db_max_open_connections",
+		"Maximum number of open connections, 0 if unlimited.", nil, nil)
+	waitCountDesc = prometheus.NewDesc("db_wait_count_total",
+		"Number of connections waited for.", nil, nil)
+	waitDurationDesc = prometheus.NewDesc("db_wait_duration_seconds_total",
+		"Time blocked waiting for a new connection.", nil, nil)
+	maxIdleClosedDesc = prometheus.NewDesc("db_max_idle_closed_total",
+		"Number of connections closed due to the idle limit.", nil, nil)
+	maxLifetimeClosedDesc = prometheus.NewDesc("db_max_lifetime_closed_total",
+		"Number of connections closed due to their maximum lifetime.", nil, nil)
+)
+
+type statsCollector struct {
+	db *sql.DB
+}
+
+func (c *statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- openConnectionsDesc
+	ch <- inUseDesc
+	ch <- idleDesc
+	ch <- maxOpenDesc
+	ch <- waitCountDesc
+	ch <- waitDurationDesc
+	ch <- maxIdleClosedDesc
+	ch <- maxLifetimeClosedDesc
+}
+
+func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.db.Stats()
+	ch <- prometheus.MustNewConstMetric(openConnectionsDesc, prometheus.GaugeValue, float64(stats.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(inUseDesc, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(idleDesc, prometheus.GaugeValue, float64(stats.Idle))
+	ch <- prometheus.MustNewConstMetric(maxOpenDesc, prometheus.GaugeValue, float64(stats.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(waitCountDesc, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(waitDurationDesc, prometheus.CounterValue, stats.WaitDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(maxIdleClosedDesc, prometheus.CounterValue, float64(stats.MaxIdleClosed))
+	ch <- prometheus.MustNewConstMetric(maxLifetimeClosedDesc, prometheus.CounterValue, float64(stats.MaxLifetimeClosed))
+}
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	serializationFailure = "40001"
+	deadlockDetected     = "40P01"
+)
+
+// RetryPolicy controls how often RunInTx retries a transaction which failed
+// because of a serialization failure or a deadlock. Retrying is disabled
+// unless MaxAttempts is greater than one.
+type RetryPolicy struct {
+	MaxAttempts int           `default:"1" yaml:"maxAttempts"`
+	MinBackoff  time.Duration `default:"10ms" yaml:"minBackoff"`
+	MaxBackoff  time.Duration `default:"1s" yaml:"maxBackoff"`
+}
+
+// IsRetryable reports whether err was caused by a serialization failure or a
+// deadlock, in which case running the same transaction again may succeed.
+func IsRetryable(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == serializationFailure || pqErr.Code == deadlockDetected
+}
+
+// backoff returns the jittered delay before the given retry, doubling with every
+// attempt up to MaxBackoff. Half of it is random so that conflicting
+// transactions do not collide again.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.MinBackoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := int64(d) / 2
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// wait sleeps before the given retry and returns false if ctx is done first.
+func (p RetryPolicy) wait(ctx context.Context, attempt int) bool {
+	timer := time.NewTimer(p.backoff(attempt))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/mmrath/gobase/golang/pkg/tracing"
+)
+
+const (
+	// traceContextKey holds the context of the transaction span in the gorm
+	// values of a Tx, as gorm does not pass contexts to its callbacks.
+	traceContextKey = "tracing:context"
+	querySpanKey    = "tracing:span"
+)
+
+// dbSQLTableKey is the semantic convention for the table of a query, which the
+// semconv package lacks.
+const dbSQLTableKey = attribute.Key("db.sql.table")
+
+// txOutcomeKey records whether a transaction was committed or rolled back.
+const txOutcomeKey = attribute.Key("db.transaction.outcome")
+
+// registerTracing traces every create, query, update and delete of g which runs
+// in a transaction of RunInTx, as a child of the transaction span.
+func registerTracing(g *gorm.DB) {
+	cb := g.Callback()
+	cb.Create().Before("gorm:create").Register("tracing:start_create", startQuerySpan("INSERT"))
+	cb.Create().After("gorm:create").Register("tracing:end_create", endQuerySpan)
+	cb.Query().Before("gorm:query").Register("tracing:start_query", startQuerySpan("SELECT"))
+	cb.Query().After("gorm:query").Register("tracing:end_query", endQuerySpan)
+	cb.RowQuery().Before("gorm:row_query").Register("tracing:start_row_query", startQuerySpan("SELECT"))
+	cb.RowQuery().After("gorm:row_query").Register("tracing:end_row_query", endQuerySpan)
+	cb.Update().Before("gorm:update").Register("tracing:start_update", startQuerySpan("UPDATE"))
+	cb.Update().After("gorm:update").Register("tracing:end_update", endQuerySpan)
+	cb.Delete().Before("gorm:delete").Register("tracing:start_delete", startQuerySpan("DELETE"))
+	cb.Delete().After("gorm:delete").Register("tracing:end_delete", endQuerySpan)
+}
+
+func startQuerySpan(operation string) func(scope *gorm.Scope) {
+	return func(scope *gorm.Scope) {
+		value, ok := scope.Get(traceContextKey)
+		if !ok {
+			return
+		}
+		table := scope.TableName()
+		_, span := tracing.Start(value.(context.Context), operation+" "+table,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				semconv.DBSystemPostgres,
+				semconv.DBOperationKey.String(operation),
+				dbSQLTableKey.String(table),
+			),
+		)
+		scope.InstanceSet(querySpanKey, span)
+	}
+}
+
+func endQuerySpan(scope *gorm.Scope) {
+	value, ok := scope.InstanceGet(querySpanKey)
+	if !ok {
+		return
+	}
+	span := value.(trace.Span)
+	span.SetAttributes(semconv.DBStatementKey.String(scope.SQL))
+
+	err := scope.DB().Error
+	if gorm.IsRecordNotFoundError(err) {
+		// finding nothing is an answer, not a failure
+		err = nil
+	}
+	tracing.End(span, err)
+}
@@ -1,9 +1,11 @@
 package email
 
+import "github.com/mmrath/gobase/golang/pkg/config"
+
 type SMTPConfig struct {
-	Host     string  `required:"true" yaml:"host"`
-	Port     int     `mapstructure:"port" yaml:"port"`
-	Username string  `mapstructure:"username" yaml:"username"`
-	Password string  `mapstructure:"password" yaml:"password"`
-	From     Address `mapstructure:"from" yaml:"from"`
+	Host     string        `required:"true" yaml:"host"`
+	Port     int           `mapstructure:"port" yaml:"port"`
+	Username string        `mapstructure:"username" yaml:"username"`
+	Password config.Secret `mapstructure:"password" yaml:"password"`
+	From     Address       `mapstructure:"from" yaml:"from" reload:"true"`
 }
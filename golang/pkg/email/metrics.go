@@ -0,0 +1,34 @@
+package email
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mmrath/gobase/golang/pkg/metrics"
+)
+
+var (
+	sendTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "email_sent_total",
+		Help: "Number of emails sent by outcome: success or failure.",
+	}, []string{"outcome"})
+	sendDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "email_send_duration_seconds",
+		Help:    "Latency of sending emails, including the connection to the mail server.",
+		Buckets: prometheus.DefBuckets,
+	})
+)
+
+func init() {
+	metrics.MustRegister(sendTotal, sendDuration)
+}
+
+func observeSend(start time.Time, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	}
+	sendTotal.WithLabelValues(outcome).Inc()
+	sendDuration.Observe(time.Since(start).Seconds())
+}
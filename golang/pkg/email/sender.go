@@ -2,6 +2,7 @@
 package email
 
 import (
+	"context"
 	"fmt"
 	"html/template"
 	"log"
@@ -16,15 +17,23 @@ import (
 	"github.com/hashicorp/errwrap"
 	"github.com/jaytaylor/html2text"
 	"github.com/vanng822/go-premailer/premailer"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/mmrath/gobase/golang/pkg/tracing"
 )
 
+// recipientsKey records the number of recipients of an email, not their addresses.
+const recipientsKey = attribute.Key("email.recipients")
+
 var (
 	debug     bool
 	templates *template.Template
 )
 
 type Mailer interface {
-	Send(email *Message) error
+	Send(ctx context.Context, email *Message) error
 }
 
 // Mailer is a SMTP mailer.
@@ -36,7 +45,7 @@ type mailer struct {
 // NewMailer returns a configured SMTP Mailer.
 func NewMailer(conf SMTPConfig) (Mailer, error) {
 	s := &mailer{
-		client: mail.NewDialer(conf.Host, conf.Port, conf.Username, conf.Password),
+		client: mail.NewDialer(conf.Host, conf.Port, conf.Username, conf.Password.Value()),
 		from:   conf.From,
 	}
 
@@ -56,8 +65,24 @@ func NewMailer(conf SMTPConfig) (Mailer, error) {
 	return nil, errwrap.Wrapf("failed to dial mail server", err)
 }
 
-// Send sends the mail via smtp.
-func (m *mailer) Send(email *Message) error {
+// Send sends the mail via smtp, in a span which is a child of the span in ctx.
+func (m *mailer) Send(ctx context.Context, email *Message) error {
+	_, span := tracing.Start(ctx, "email.send",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.NetPeerNameKey.String(m.client.Host),
+			semconv.NetPeerPortKey.Int(m.client.Port),
+			recipientsKey.Int(len(email.To)),
+		),
+	)
+	start := time.Now()
+	err := m.send(email)
+	observeSend(start, err)
+	tracing.End(span, err)
+	return err
+}
+
+func (m *mailer) send(email *Message) error {
 	if debug {
 		log.Println("To:", email.To)
 		log.Println("Subject:", email.Subject)
@@ -29,6 +29,12 @@ func (v clientError) Error() string {
 	return fmt.Sprintf("error:[ %s ]", strings.Join(s, ","))
 }
 
+// IsClientError reports whether err is an error meant to be displayed to the user.
+func IsClientError(err error) bool {
+	var ce *clientError
+	return errors.As(err, &ce)
+}
+
 func NewBadRequest(msg string) error {
 	err := &clientError{Errors: []string{msg}, Code: http.StatusBadRequest}
 	return errors.WithStack(err)
@@ -43,6 +49,24 @@ func NewUnauthorized(msg string) error {
 	return errors.WithStack(err)
 }
 
+func NewForbidden(msg string) error {
+	err := &clientError{
+		Errors: []string{msg},
+		Code:   http.StatusForbidden,
+	}
+
+	return errors.WithStack(err)
+}
+
+func NewConflict(msg string) error {
+	err := &clientError{
+		Errors: []string{msg},
+		Code:   http.StatusConflict,
+	}
+
+	return errors.WithStack(err)
+}
+
 func NewFieldErrors(fieldErrors map[string]string) error {
 	var result []FieldError
 	for k, v := range fieldErrors {
@@ -0,0 +1,69 @@
+package health
+
+import (
+	"context"
+	"net"
+	"strconv"
+
+	"github.com/mmrath/gobase/golang/pkg/db"
+	"github.com/mmrath/gobase/golang/pkg/email"
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+)
+
+type checker struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+func (c checker) Name() string {
+	return c.name
+}
+
+func (c checker) Check(ctx context.Context) error {
+	return c.check(ctx)
+}
+
+// NewChecker returns a checker named name which runs check.
+func NewChecker(name string, check func(ctx context.Context) error) Checker {
+	return checker{name: name, check: check}
+}
+
+// NewDBChecker checks that the database accepts connections.
+func NewDBChecker(database *db.DB) Checker {
+	return NewChecker("db", database.Ping)
+}
+
+// NewMigrationChecker checks that the database schema is migrated to at least
+// version and that the last migration did not fail. Newer versions are accepted,
+// so the database can be migrated before the applications are updated.
+func NewMigrationChecker(database *db.DB, version int64) Checker {
+	return NewChecker("migration", func(ctx context.Context) error {
+		current, dirty, err := database.SchemaVersion(ctx)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return errutil.Errorf("migration %d failed and needs to be fixed", current)
+		}
+		if current < version {
+			return errutil.Errorf("schema version is %d, expected at least %d", current, version)
+		}
+		return nil
+	})
+}
+
+// NewSMTPChecker checks that the mail server accepts connections. Without a
+// host mails are printed instead of sent, which is always healthy.
+func NewSMTPChecker(cfg email.SMTPConfig) Checker {
+	return NewChecker("smtp", func(ctx context.Context) error {
+		if cfg.Host == "" {
+			return nil
+		}
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)))
+		if err != nil {
+			return errutil.Wrap(err, "failed to connect to mail server")
+		}
+		return conn.Close()
+	})
+}
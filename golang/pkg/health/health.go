@@ -1,47 +1,167 @@
 package health
 
 import (
+	"context"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/render"
 )
 
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+type Config struct {
+	// Timeout bounds each check.
+	Timeout time.Duration `default:"2s" yaml:"timeout"`
+	// CacheTTL is how long results are reused, so frequent probes do not load the
+	// dependencies.
+	CacheTTL time.Duration `default:"5s" split_words:"true" yaml:"cacheTTL"`
+}
+
 type Service interface {
+	// RegisterRoutes mounts /livez, which only reports that the process serves
+	// requests, and /readyz, which reports whether the dependencies are healthy.
 	RegisterRoutes(r chi.Router)
+	// SetReadiness sets a function which reports whether the application accepts
+	// requests, e.g. false while shutting down. It is asked on every readiness probe.
+	SetReadiness(ready func() bool)
 }
+
+// Checker checks a dependency, returning an error if it is unhealthy.
 type Checker interface {
 	Name() string
-	Check() bool
+	Check(ctx context.Context) error
+}
+
+// CheckResult is the outcome of a single check.
+type CheckResult struct {
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	LatencyMS float64   `json:"latencyMs"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// Report is the body of the health endpoints.
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
 }
 
 type service struct {
+	cfg      Config
 	checkers []Checker
+
+	mu        sync.Mutex
+	ready     func() bool
+	results   map[string]CheckResult
+	expiresAt time.Time
 }
 
-func NewService(checkers ...Checker) Service {
-	return &service{checkers}
+func NewService(cfg Config, checkers ...Checker) Service {
+	return &service{cfg: cfg, checkers: checkers}
 }
 
 func (s *service) RegisterRoutes(r chi.Router) {
-	r.Get("/health", s.healthCheck)
+	r.Get("/livez", s.liveness)
+	r.Get("/readyz", s.readiness)
+}
+
+func (s *service) SetReadiness(ready func() bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ready = ready
 }
 
-func (s *service) healthCheck(w http.ResponseWriter, r *http.Request) {
-	statuses := make(map[string]interface{})
-	result := true
+func (s *service) liveness(w http.ResponseWriter, r *http.Request) {
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, Report{Status: StatusOK})
+}
 
-	for _, checker := range s.checkers {
-		ok := checker.Check()
-		if !ok {
-			result = false
-		} else {
-			statuses[checker.Name()] = struct{ healthy bool }{true}
+func (s *service) readiness(w http.ResponseWriter, r *http.Request) {
+	report := Report{Status: StatusOK, Checks: s.check()}
+	for _, result := range report.Checks {
+		if result.Status != StatusOK {
+			report.Status = StatusFail
 		}
 	}
 
-	render.JSON(w, r, map[string]interface{}{
-		"healthy": result,
-		"data":    statuses,
-	})
+	if report.Status == StatusOK {
+		render.Status(r, http.StatusOK)
+	} else {
+		render.Status(r, http.StatusServiceUnavailable)
+	}
+	render.JSON(w, r, report)
+}
+
+// check returns the results of all checks, running them concurrently unless the
+// cached results are still fresh. The checks do not use the context of the probe,
+// as an impatient client would otherwise cache failures for the others.
+func (s *service) check() map[string]CheckResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if s.results == nil || !now.Before(s.expiresAt) {
+		s.results = s.runCheckers(context.Background())
+		s.expiresAt = time.Now().Add(s.cfg.CacheTTL)
+	}
+
+	results := make(map[string]CheckResult, len(s.results)+1)
+	for name, result := range s.results {
+		results[name] = result
+	}
+	if s.ready != nil {
+		result := CheckResult{Status: StatusOK, CheckedAt: now}
+		if !s.ready() {
+			result.Status = StatusFail
+			result.Error = "shutting down"
+		}
+		results["server"] = result
+	}
+	return results
+}
+
+func (s *service) runCheckers(ctx context.Context) map[string]CheckResult {
+	results := make([]CheckResult, len(s.checkers))
+	var wg sync.WaitGroup
+	for i, checker := range s.checkers {
+		wg.Add(1)
+		go func(i int, checker Checker) {
+			defer wg.Done()
+			results[i] = s.runChecker(ctx, checker)
+		}(i, checker)
+	}
+	wg.Wait()
+
+	byName := make(map[string]CheckResult, len(results))
+	for i, checker := range s.checkers {
+		byName[checker.Name()] = results[i]
+	}
+	return byName
+}
+
+func (s *service) runChecker(ctx context.Context, checker Checker) CheckResult {
+	if s.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.cfg.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err := checker.Check(ctx)
+	result := CheckResult{
+		Status:    StatusOK,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+		CheckedAt: start,
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+	return result
 }
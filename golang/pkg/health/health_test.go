@@ -0,0 +1,75 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+)
+
+func probe(t *testing.T, r http.Handler, path string) (int, Report) {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	var report Report
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	return w.Code, report
+}
+
+func TestReadiness(t *testing.T) {
+	var calls int32
+	healthy := NewChecker("healthy", func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	})
+	slow := NewChecker("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	failing := NewChecker("failing", func(ctx context.Context) error {
+		return errutil.New("unreachable")
+	})
+
+	ready := true
+	s := NewService(Config{Timeout: 50 * time.Millisecond, CacheTTL: time.Minute}, healthy, slow, failing)
+	s.SetReadiness(func() bool { return ready })
+	r := chi.NewRouter()
+	s.RegisterRoutes(r)
+
+	code, report := probe(t, r, "/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, StatusFail, report.Status)
+	require.Len(t, report.Checks, 4)
+	require.Equal(t, StatusOK, report.Checks["healthy"].Status)
+	require.Equal(t, StatusFail, report.Checks["slow"].Status)
+	require.GreaterOrEqual(t, report.Checks["slow"].LatencyMS, 50.0)
+	require.Equal(t, "unreachable", report.Checks["failing"].Error)
+	require.Equal(t, StatusOK, report.Checks["server"].Status)
+
+	ready = false
+	_, report = probe(t, r, "/readyz")
+	require.Equal(t, "shutting down", report.Checks["server"].Error)
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls), "results are cached")
+
+	code, report = probe(t, r, "/livez")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, Report{Status: StatusOK}, report)
+}
+
+func TestReadinessOK(t *testing.T) {
+	s := NewService(Config{}, NewChecker("db", func(ctx context.Context) error { return nil }))
+	r := chi.NewRouter()
+	s.RegisterRoutes(r)
+
+	code, report := probe(t, r, "/readyz")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, StatusOK, report.Status)
+	require.Equal(t, StatusOK, report.Checks["db"].Status)
+}
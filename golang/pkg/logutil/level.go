@@ -0,0 +1,33 @@
+// Package logutil configures the global zerolog logger.
+package logutil
+
+import (
+	"github.com/rs/zerolog"
+
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+)
+
+// Level is a log level configured by its name, like debug or info.
+type Level zerolog.Level
+
+func (l *Level) UnmarshalText(text []byte) error {
+	level, err := zerolog.ParseLevel(string(text))
+	if err != nil {
+		return errutil.Errorf("invalid log level %q", text)
+	}
+	*l = Level(level)
+	return nil
+}
+
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+func (l Level) String() string {
+	return zerolog.Level(l).String()
+}
+
+// SetGlobalLevel makes level the minimum level of all loggers.
+func SetGlobalLevel(level Level) {
+	zerolog.SetGlobalLevel(zerolog.Level(level))
+}
@@ -0,0 +1,188 @@
+package model
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/lib/pq/hstore"
+
+	"github.com/mmrath/gobase/golang/pkg/db"
+)
+
+// Audit actions as recorded by audit.if_modified_func.
+const (
+	AuditActionInsert   = "I"
+	AuditActionUpdate   = "U"
+	AuditActionDelete   = "D"
+	AuditActionTruncate = "T"
+)
+
+// AuditRedacted replaces the values of secret columns in audit events.
+const AuditRedacted = "[redacted]"
+
+// auditSecretColumns are the columns of audited tables which hold secrets or
+// hashes of secrets. Their values are never returned or exported from the audit
+// log, only whether they were set or changed.
+var auditSecretColumns = map[string][]string{
+	"user_credential":    {"password_hash", "activation_key", "reset_key", "login_key", "login_code", "totp_secret"},
+	"auth_token":         {"token"},
+	"user_recovery_code": {"code_hash"},
+}
+
+// RedactAuditData replaces the non-null values of the secret columns of table in
+// data, the row data or changed fields of an audit event, with AuditRedacted.
+func RedactAuditData(table string, data map[string]*string) {
+	for _, column := range auditSecretColumns[table] {
+		if value, ok := data[column]; ok && value != nil {
+			redacted := AuditRedacted
+			data[column] = &redacted
+		}
+	}
+}
+
+// AuditEvent is a change recorded in audit.logged_actions.
+type AuditEvent struct {
+	ID         int64              `json:"id"`
+	Table      string             `json:"table"`
+	Action     string             `json:"action"`
+	UserID     string             `json:"userId,omitempty"`
+	RequestID  string             `json:"requestId,omitempty"`
+	DBUser     string             `json:"dbUser,omitempty"`
+	OccurredAt time.Time          `json:"occurredAt"`
+	RowData    map[string]*string `json:"rowData,omitempty"`
+	Changes    []AuditChange      `json:"changes,omitempty"`
+}
+
+// AuditChange is the change of a single column by an update.
+type AuditChange struct {
+	Field string  `json:"field"`
+	Old   *string `json:"old"`
+	New   *string `json:"new"`
+}
+
+// AuditEventFilter selects audit events. Empty fields match everything.
+type AuditEventFilter struct {
+	Table string
+	// KeyColumn is the column RowKey is compared with, id by default.
+	KeyColumn string
+	RowKey    string
+	UserID    string
+	Action    string
+	From      time.Time
+	To        time.Time
+	// Before only selects events older than the event with this id, to page through the results.
+	Before int64
+	Limit  int
+}
+
+type AuditEventDao interface {
+	Find(tx *db.Tx, filter AuditEventFilter) ([]AuditEvent, error)
+}
+
+type auditEventDao struct {
+}
+
+func NewAuditEventDao() AuditEventDao {
+	return &auditEventDao{}
+}
+
+// Find returns the events matching filter, newest first.
+func (dao *auditEventDao) Find(tx *db.Tx, filter AuditEventFilter) ([]AuditEvent, error) {
+	query := tx.Table("audit.logged_actions").
+		Select("event_id, table_name, action, app_user_id, request_id, session_user_name, "+
+			"action_tstamp_stm, row_data, changed_fields").
+		Where("schema_name = ?", "public")
+
+	if filter.Table != "" {
+		query = query.Where("table_name = ?", filter.Table)
+	}
+	if filter.RowKey != "" {
+		keyColumn := filter.KeyColumn
+		if keyColumn == "" {
+			keyColumn = "id"
+		}
+		query = query.Where("row_data -> ? = ?", keyColumn, filter.RowKey)
+	}
+	if filter.UserID != "" {
+		query = query.Where("app_user_id = ?", filter.UserID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("action_tstamp_stm >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("action_tstamp_stm < ?", filter.To)
+	}
+	if filter.Before > 0 {
+		query = query.Where("event_id < ?", filter.Before)
+	}
+
+	rows, err := query.Order("event_id DESC").Limit(filter.Limit).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []AuditEvent
+	for rows.Next() {
+		var event AuditEvent
+		var userID, requestID, dbUser sql.NullString
+		var rowData, changedFields hstore.Hstore
+		err = rows.Scan(&event.ID, &event.Table, &event.Action, &userID, &requestID, &dbUser,
+			&event.OccurredAt, &rowData, &changedFields)
+		if err != nil {
+			return nil, err
+		}
+		event.UserID = userID.String
+		event.RequestID = requestID.String
+		event.DBUser = dbUser.String
+		event.RowData = hstoreToMap(rowData)
+		changes := hstoreToMap(changedFields)
+		RedactAuditData(event.Table, event.RowData)
+		RedactAuditData(event.Table, changes)
+		event.Changes = auditChanges(event.RowData, changes)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func hstoreToMap(h hstore.Hstore) map[string]*string {
+	if h.Map == nil {
+		return nil
+	}
+	result := make(map[string]*string, len(h.Map))
+	for key, value := range h.Map {
+		result[key] = nullStringPtr(value)
+	}
+	return result
+}
+
+// auditChanges pairs the new values of an update with the old ones from the row data,
+// ordered by field name.
+func auditChanges(rowData, changedFields map[string]*string) []AuditChange {
+	if len(changedFields) == 0 {
+		return nil
+	}
+	changes := make([]AuditChange, 0, len(changedFields))
+	for field, value := range changedFields {
+		changes = append(changes, AuditChange{
+			Field: field,
+			Old:   rowData[field],
+			New:   value,
+		})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+	return changes
+}
+
+func nullStringPtr(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
@@ -0,0 +1,59 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestRedactAuditData(t *testing.T) {
+	data := map[string]*string{
+		"id":            strPtr("1"),
+		"password_hash": strPtr("$2a$10$secret"),
+		"totp_secret":   strPtr("JBSWY3DPEHPK3PXP"),
+		"login_code":    strPtr("5994471abb01112afcc18159f6cc74b4f511b99806da59b3caf5a9c173cacfc5"),
+		"reset_key":     nil,
+		"locked":        strPtr("f"),
+	}
+	RedactAuditData("user_credential", data)
+
+	require.Equal(t, "1", *data["id"])
+	require.Equal(t, "f", *data["locked"])
+	require.Equal(t, AuditRedacted, *data["password_hash"])
+	require.Equal(t, AuditRedacted, *data["totp_secret"])
+	require.Equal(t, AuditRedacted, *data["login_code"])
+	require.Nil(t, data["reset_key"], "null values show that no secret is set")
+	_, ok := data["activation_key"]
+	require.False(t, ok, "absent columns are not added")
+}
+
+func TestRedactAuditDataOtherTables(t *testing.T) {
+	token := map[string]*string{"token": strPtr("abc"), "user_id": strPtr("1")}
+	RedactAuditData("auth_token", token)
+	require.Equal(t, AuditRedacted, *token["token"])
+	require.Equal(t, "1", *token["user_id"])
+
+	account := map[string]*string{"email": strPtr("a@b.com")}
+	RedactAuditData("user_account", account)
+	require.Equal(t, "a@b.com", *account["email"])
+}
+
+func TestAuditChangesAreRedacted(t *testing.T) {
+	rowData := map[string]*string{"password_hash": strPtr("old"), "locked": strPtr("t")}
+	changed := map[string]*string{"password_hash": strPtr("new"), "locked": strPtr("f")}
+	RedactAuditData("user_credential", rowData)
+	RedactAuditData("user_credential", changed)
+
+	changes := auditChanges(rowData, changed)
+	require.Len(t, changes, 2)
+	require.Equal(t, "locked", changes[0].Field)
+	require.Equal(t, "t", *changes[0].Old)
+	require.Equal(t, "f", *changes[0].New)
+	require.Equal(t, "password_hash", changes[1].Field)
+	require.Equal(t, AuditRedacted, *changes[1].Old)
+	require.Equal(t, AuditRedacted, *changes[1].New)
+}
@@ -2,15 +2,78 @@ package model
 
 import (
 	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/mmrath/gobase/golang/pkg/db"
 )
 
+// AuthToken is a persisted refresh token. Only the hash of the token is stored.
 type AuthToken struct {
-	ID         uint64    `json:"id,omitempty"`
-	CreatedAt  time.Time `json:"created_at,omitempty"`
-	UpdatedAt  time.Time `json:"updated_at,omitempty"`
-	UserID     uint64    `json:"-"`
-	Token      string    `json:"-"`
-	ExpiresAt  time.Time `json:"-"`
-	Mobile     bool      `sql:",notnull" json:"mobile"`
-	Identifier string    `json:"identifier,omitempty"`
+	ID         int64      `json:"id,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt,omitempty"`
+	UpdatedAt  time.Time  `json:"updatedAt,omitempty"`
+	UserID     int64      `json:"-"`
+	Token      string     `json:"-"`
+	TokenID    string     `json:"-"`
+	FamilyID   uuid.UUID  `json:"-" gorm:"type:uuid;"`
+	ExpiresAt  time.Time  `json:"expiresAt,omitempty"`
+	UsedAt     *time.Time `json:"usedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	Mobile     bool       `sql:",notnull" json:"mobile"`
+	Identifier string     `json:"identifier,omitempty" sql:"default:null"`
+}
+
+type AuthTokenDao interface {
+	Insert(tx *db.Tx, token *AuthToken) error
+	FindByToken(tx *db.Tx, tokenHash string) (AuthToken, error)
+	FindByTokenID(tx *db.Tx, tokenID string) (AuthToken, error)
+	MarkUsed(tx *db.Tx, id int64) error
+	RevokeFamily(tx *db.Tx, familyID uuid.UUID) error
+	IsTokenIDRevoked(tx *db.Tx, tokenID string) (bool, error)
+}
+
+type authTokenDao struct {
+}
+
+func NewAuthTokenDao() AuthTokenDao {
+	return &authTokenDao{}
+}
+
+func (dao *authTokenDao) Insert(tx *db.Tx, token *AuthToken) error {
+	return tx.Create(token).Error
+}
+
+// FindByToken locks the row so that concurrent refreshes of the same token are serialized.
+func (dao *authTokenDao) FindByToken(tx *db.Tx, tokenHash string) (AuthToken, error) {
+	token := AuthToken{}
+	err := tx.Set("gorm:query_option", "FOR UPDATE").
+		Where("token = ?", tokenHash).
+		First(&token).Error
+	return token, err
+}
+
+func (dao *authTokenDao) FindByTokenID(tx *db.Tx, tokenID string) (AuthToken, error) {
+	token := AuthToken{}
+	err := tx.Where("token_id = ?", tokenID).First(&token).Error
+	return token, err
+}
+
+func (dao *authTokenDao) MarkUsed(tx *db.Tx, id int64) error {
+	return tx.Model(&AuthToken{ID: id}).
+		Updates(map[string]interface{}{"used_at": time.Now()}).Error
+}
+
+func (dao *authTokenDao) RevokeFamily(tx *db.Tx, familyID uuid.UUID) error {
+	return tx.Model(&AuthToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Updates(map[string]interface{}{"revoked_at": time.Now()}).Error
+}
+
+func (dao *authTokenDao) IsTokenIDRevoked(tx *db.Tx, tokenID string) (bool, error) {
+	count := 0
+	err := tx.Model(&AuthToken{}).
+		Where("token_id = ? AND revoked_at IS NOT NULL", tokenID).
+		Count(&count).Error
+	return count != 0, err
 }
@@ -0,0 +1,123 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+
+	"github.com/mmrath/gobase/golang/pkg/auth"
+	"github.com/mmrath/gobase/golang/pkg/db"
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+)
+
+// Authorizer answers whether a user has a permission, granted through the user's
+// roles or the roles of the user's groups. The permissions are loaded once, so an
+// Authorizer is meant to live for a single request.
+type Authorizer interface {
+	Can(ctx context.Context, resource, authority string) (bool, error)
+	// Require returns a forbidden error unless the user has the permission.
+	Require(ctx context.Context, resource, authority string) error
+}
+
+type authorizerKeyType int
+
+var authorizerKey authorizerKeyType
+
+// NewAuthorizerContext returns a context carrying the authorizer of the logged in user.
+func NewAuthorizerContext(ctx context.Context, authorizer Authorizer) context.Context {
+	return context.WithValue(ctx, authorizerKey, authorizer)
+}
+
+// AuthorizerFromContext returns the authorizer of the logged in user. Without one
+// every permission is denied.
+func AuthorizerFromContext(ctx context.Context) Authorizer {
+	if authorizer, ok := ctx.Value(authorizerKey).(Authorizer); ok {
+		return authorizer
+	}
+	return denyAll{}
+}
+
+type authorizer struct {
+	db            *db.DB
+	userID        int64
+	permissionDao PermissionDao
+
+	mu          sync.Mutex
+	permissions map[string]bool
+}
+
+// NewAuthorizer returns an authorizer of the user with the given id. It does not
+// check whether the user is active, which is up to the caller authenticating it.
+func NewAuthorizer(database *db.DB, userID int64) Authorizer {
+	return &authorizer{db: database, userID: userID, permissionDao: NewPermissionDao()}
+}
+
+// NewAuthoritiesAuthorizer returns an authorizer granting the permissions of
+// authorities, for callers which have loaded them already.
+func NewAuthoritiesAuthorizer(authorities auth.Authorities) Authorizer {
+	return &authorizer{permissions: permissionSet(authorities.Permissions)}
+}
+
+func (a *authorizer) Can(ctx context.Context, resource, authority string) (bool, error) {
+	permissions, err := a.load(ctx)
+	if err != nil {
+		return false, err
+	}
+	return permissions[strings.ToLower(auth.PermissionName(resource, authority))], nil
+}
+
+func (a *authorizer) Require(ctx context.Context, resource, authority string) error {
+	return requireAuthority(ctx, a, resource, authority)
+}
+
+func (a *authorizer) load(ctx context.Context) (map[string]bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.permissions != nil {
+		return a.permissions, nil
+	}
+
+	var names []string
+	err := a.db.RunInTxWithOptions(ctx, &sql.TxOptions{ReadOnly: true}, func(tx *db.Tx) (err error) {
+		names, err = a.permissionDao.FindNamesByUserID(tx, a.userID)
+		return err
+	})
+	if err != nil {
+		return nil, errutil.Wrap(err, "failed to find permissions of user")
+	}
+
+	a.permissions = permissionSet(names)
+	return a.permissions, nil
+}
+
+// permissionSet returns the set of the lowercased names. It is never nil, so
+// that a loaded empty set is not loaded again.
+func permissionSet(names []string) map[string]bool {
+	permissions := make(map[string]bool, len(names))
+	for _, name := range names {
+		permissions[strings.ToLower(name)] = true
+	}
+	return permissions
+}
+
+func requireAuthority(ctx context.Context, a Authorizer, resource, authority string) error {
+	ok, err := a.Can(ctx, resource, authority)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errutil.NewForbidden("permission denied")
+	}
+	return nil
+}
+
+type denyAll struct{}
+
+func (denyAll) Can(ctx context.Context, resource, authority string) (bool, error) {
+	return false, nil
+}
+
+func (d denyAll) Require(ctx context.Context, resource, authority string) error {
+	return requireAuthority(ctx, d, resource, authority)
+}
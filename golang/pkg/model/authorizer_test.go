@@ -0,0 +1,59 @@
+package model
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/mmrath/gobase/golang/pkg/auth"
+	"github.com/mmrath/gobase/golang/pkg/db"
+)
+
+func TestAuthoritiesAuthorizer(t *testing.T) {
+	ctx := context.Background()
+	authorizer := NewAuthoritiesAuthorizer(auth.Authorities{Permissions: []string{"user:read", "Role:Write"}})
+
+	ok, err := authorizer.Can(ctx, "user", "read")
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = authorizer.Can(ctx, "ROLE", "write")
+	require.NoError(t, err)
+	require.True(t, ok, "permissions are matched ignoring case")
+	ok, err = authorizer.Can(ctx, "user", "write")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.NoError(t, authorizer.Require(ctx, "user", "read"))
+	require.Equal(t, http.StatusForbidden, statusOf(authorizer.Require(ctx, "user", "write")))
+
+	none := NewAuthoritiesAuthorizer(auth.Authorities{})
+	require.Equal(t, http.StatusForbidden, statusOf(none.Require(ctx, "user", "read")))
+}
+
+func TestAuthorizerFromContext(t *testing.T) {
+	ctx := context.Background()
+	require.Equal(t, http.StatusForbidden, statusOf(AuthorizerFromContext(ctx).Require(ctx, "user", "read")),
+		"without an authorizer every permission is denied")
+
+	authorizer := NewAuthoritiesAuthorizer(auth.Authorities{Permissions: []string{"user:read"}})
+	ctx = NewAuthorizerContext(ctx, authorizer)
+	require.NoError(t, AuthorizerFromContext(ctx).Require(ctx, "user", "read"))
+}
+
+func TestAuthorizer(t *testing.T) {
+	setUp(t)
+	ctx := context.Background()
+	user := createUser(t)
+
+	authorizer := NewAuthorizer(testDB, user.ID)
+	require.Equal(t, http.StatusForbidden, statusOf(authorizer.Require(ctx, "user", "read")))
+
+	runInTx(t, func(tx *db.Tx) error {
+		return NewRoleDao().SetUserRoles(tx, user.ID, []int32{findRole(t, AdministratorRole).ID})
+	})
+	require.Equal(t, http.StatusForbidden, statusOf(authorizer.Require(ctx, "user", "read")),
+		"permissions are loaded once")
+	require.NoError(t, NewAuthorizer(testDB, user.ID).Require(ctx, "User", "Read"))
+}
@@ -0,0 +1,72 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/mmrath/gobase/golang/pkg/db"
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+	"github.com/mmrath/gobase/golang/pkg/testutil"
+)
+
+// testDB is nil if the test database is not running, in which case the tests using it are skipped.
+var testDB *db.DB
+
+func TestMain(m *testing.M) {
+	var err error
+	testDB, err = testutil.OpenDB()
+	if err != nil {
+		fmt.Printf("skipping model tests using the database, it is not available: %v\n", err)
+		testDB = nil
+	}
+	os.Exit(m.Run())
+}
+
+func setUp(t *testing.T) {
+	if testDB == nil {
+		t.Skip("database is not available")
+	}
+}
+
+var seq int64
+
+// uniqueName returns a name which is not used by any other test run, as the
+// database is not reset between them.
+func uniqueName(prefix string) string {
+	return fmt.Sprintf("%s-%d-%d", prefix, time.Now().UnixNano(), atomic.AddInt64(&seq, 1))
+}
+
+func runInTx(t *testing.T, fn func(tx *db.Tx) error) {
+	require.NoError(t, testDB.RunInTx(context.Background(), fn))
+}
+
+func createUser(t *testing.T) User {
+	user := User{FirstName: "Test", LastName: "User", Email: uniqueName("user") + "@example.com", Active: true}
+	runInTx(t, func(tx *db.Tx) error {
+		return NewUserDao().Insert(tx, &user)
+	})
+	return user
+}
+
+func findRole(t *testing.T, name string) Role {
+	var role Role
+	runInTx(t, func(tx *db.Tx) (err error) {
+		role, err = NewRoleDao().FindByName(tx, name)
+		return err
+	})
+	return role
+}
+
+func statusOf(err error) int {
+	w := httptest.NewRecorder()
+	errutil.RenderError(w, httptest.NewRequest(http.MethodGet, "/", nil), err)
+	return w.Code
+}
@@ -1,50 +1,110 @@
 package model
 
 import (
-	"strings"
-
 	"github.com/mmrath/gobase/golang/pkg/db"
 )
 
 type Permission struct {
 	ID          int32  `json:"id,omitempty"`
-	Application string `json:"application,omitempty" sql:"default:null"`
+	Resource    string `json:"resource,omitempty" sql:"default:null"`
 	Authority   string `json:"authority,omitempty" sql:"default:null"`
 	Description string `json:"description,omitempty" sql:"default:null"`
 }
 
+// PermissionGroup is the permissions of one resource.
+type PermissionGroup struct {
+	Resource    string       `json:"resource"`
+	Permissions []Permission `json:"permissions"`
+}
+
+// GroupPermissions groups permissions ordered by resource by their resource.
+func GroupPermissions(perms []Permission) []PermissionGroup {
+	groups := []PermissionGroup{}
+	for _, perm := range perms {
+		if len(groups) == 0 || groups[len(groups)-1].Resource != perm.Resource {
+			groups = append(groups, PermissionGroup{Resource: perm.Resource})
+		}
+		last := &groups[len(groups)-1]
+		last.Permissions = append(last.Permissions, perm)
+	}
+	return groups
+}
+
 type PermissionDao interface {
 	FindByID(tx *db.Tx, id int32) (Permission, error)
-	FindAllByApplication(tx *db.Tx, app string) ([]Permission, error)
+	FindAllByResource(tx *db.Tx, resource string) ([]Permission, error)
 	FindAll(tx *db.Tx) ([]Permission, error)
+	FindNamesByUserID(tx *db.Tx, userID int64) ([]string, error)
+	FindGrantedIDs(tx *db.Tx) ([]int32, error)
+	Upsert(tx *db.Tx, perm *Permission) error
+	Delete(tx *db.Tx, id int32) error
 }
 
 type permissionDao struct {
 }
 
 func (p permissionDao) FindByID(tx *db.Tx, id int32) (perm Permission, err error) {
-	err = tx.Find(&perm, id).Error
+	err = tx.First(&perm, id).Error
 	return
 }
 
-func (p permissionDao) FindAllByApplication(tx *db.Tx, app string) ([]Permission, error) {
+// FindAllByResource returns the permissions of a resource ordered by authority.
+func (p permissionDao) FindAllByResource(tx *db.Tx, resource string) ([]Permission, error) {
 	var perms []Permission
-	err := tx.Where("UPPER(application) = ", strings.ToUpper(app)).Find(perms).Error
+	err := tx.Where("lower(resource) = lower(?)", resource).Order("authority").Find(&perms).Error
 	if err != nil {
 		return nil, err
 	}
 	return perms, nil
 }
 
+// FindAll returns all permissions ordered by resource and authority.
 func (p permissionDao) FindAll(tx *db.Tx) ([]Permission, error) {
 	var perms []Permission
-	err := tx.Find(perms).Error
+	err := tx.Order("resource, authority").Find(&perms).Error
 	if err != nil {
 		return nil, err
 	}
 	return perms, nil
 }
 
+// FindNamesByUserID returns the effective permissions of a user as "resource:authority",
+// granted either through roles of the user or through roles of the user's groups.
+func (p permissionDao) FindNamesByUserID(tx *db.Tx, userID int64) ([]string, error) {
+	rows, err := tx.Raw(`
+		SELECT DISTINCT p.resource || ':' || p.authority
+		FROM permission p
+		         JOIN role_permission rp ON rp.permission_id = p.id
+		WHERE rp.role_id IN (`+userRoleIDsQuery+`)
+		ORDER BY 1`, userID, userID).Rows()
+	if err != nil {
+		return nil, err
+	}
+	return scanStrings(rows)
+}
+
+// FindGrantedIDs returns the ids of the permissions granted to at least one role.
+func (p permissionDao) FindGrantedIDs(tx *db.Tx) ([]int32, error) {
+	ids := []int32{}
+	err := tx.Model(&RolePermission{}).Order("permission_id").Pluck("DISTINCT permission_id", &ids).Error
+	return ids, err
+}
+
+// Upsert creates a permission or updates the description of the existing one
+// with the same resource and authority, ignoring case.
+func (p permissionDao) Upsert(tx *db.Tx, perm *Permission) error {
+	return tx.Raw(`
+		INSERT INTO permission (resource, authority, description)
+		VALUES (?, ?, ?)
+		ON CONFLICT (lower(resource), lower(authority)) DO UPDATE SET description = excluded.description
+		RETURNING id`, perm.Resource, perm.Authority, perm.Description).
+		Row().Scan(&perm.ID)
+}
+
+func (p permissionDao) Delete(tx *db.Tx, id int32) error {
+	return tx.Delete(&Permission{}, "id = ?", id).Error
+}
+
 func NewPermissionDao() PermissionDao {
 	return &permissionDao{}
 }
@@ -7,6 +7,9 @@ import (
 	"github.com/mmrath/gobase/golang/pkg/errutil"
 )
 
+// AdministratorRole is the role created by the migrations with full access to oppo.
+const AdministratorRole = "Administrator"
+
 type Role struct {
 	AuditDetails
 	ID          int32        `json:"id,omitempty"`
@@ -20,17 +23,44 @@ type RolePermission struct {
 	PermissionID int32 `json:"permissionId,omitempty" validate:"required"`
 }
 
+type UserRole struct {
+	UserID int64 `json:"userId,omitempty" validate:"required"`
+	RoleID int32 `json:"roleId,omitempty" validate:"required"`
+}
+
 type RoleAndPermission struct {
 	Role        Role
 	Permissions []int32
 }
 
+// RoleSummary is a role with the number of users and groups it is assigned to.
+type RoleSummary struct {
+	Role
+	UserCount  int `json:"userCount"`
+	GroupCount int `json:"groupCount"`
+}
+
+// CloneRoleRequest creates a role with the permissions of an existing one.
+type CloneRoleRequest struct {
+	Name        string `json:"name,omitempty" validate:"required"`
+	Description string `json:"description,omitempty" validate:"required"`
+}
+
 type RoleDao interface {
 	Find(tx *db.Tx, id int32) (Role, error)
 	FindPermissionsByRoleID(tx *db.Tx, id int32) ([]int32, error)
+	FindNamesByUserID(tx *db.Tx, userID int64) ([]string, error)
+	FindByName(tx *db.Tx, name string) (Role, error)
 	ExistsByName(tx *db.Tx, name string) (bool, error)
 	Create(tx *db.Tx, role *Role, permissions []int32) error
 	Update(tx *db.Tx, role *Role, permissions []int32) error
+	List(tx *db.Tx) ([]RoleSummary, error)
+	CountAssignments(tx *db.Tx, id int32) (users int, groups int, err error)
+	ReassignRole(tx *db.Tx, from int32, to int32) error
+	Delete(tx *db.Tx, id int32) error
+	ExistAll(tx *db.Tx, ids []int32) (bool, error)
+	FindIDsByUserID(tx *db.Tx, userID int64) ([]int32, error)
+	SetUserRoles(tx *db.Tx, userID int64, roles []int32) error
 }
 
 type roleDao struct {
@@ -53,6 +83,32 @@ func (dao *roleDao) FindPermissionsByRoleID(tx *db.Tx, id int32) ([]int32, error
 	return permissions, err
 }
 
+// userRoleIDsQuery selects the ids of roles assigned to a user directly or through a group.
+// It takes the user id twice.
+const userRoleIDsQuery = `
+	SELECT ur.role_id FROM user_role ur WHERE ur.user_id = ?
+	UNION
+	SELECT ugr.role_id
+	FROM user_group_role ugr
+	         JOIN user_group_user ugu ON ugu.group_id = ugr.group_id
+	WHERE ugu.user_id = ?`
+
+// FindNamesByUserID returns the names of the roles of a user, including roles of the user's groups.
+func (dao *roleDao) FindNamesByUserID(tx *db.Tx, userID int64) ([]string, error) {
+	rows, err := tx.Raw(`SELECT name FROM role WHERE id IN (`+userRoleIDsQuery+`) ORDER BY name`,
+		userID, userID).Rows()
+	if err != nil {
+		return nil, err
+	}
+	return scanStrings(rows)
+}
+
+func (dao *roleDao) FindByName(tx *db.Tx, name string) (Role, error) {
+	role := Role{}
+	err := tx.First(&role, "LOWER(name) = LOWER(?)", name).Error
+	return role, err
+}
+
 func (dao *roleDao) ExistsByName(tx *db.Tx, name string) (bool, error) {
 	count := 0
 	err := tx.Find(&Role{}, " LOWER(name) = LOWER(?)", name).Count(&count).Error
@@ -68,8 +124,20 @@ func (dao *roleDao) Create(tx *db.Tx, role *Role, permissions []int32) error {
 	return dao.createRolePermissions(tx, role.ID, permissions)
 }
 
+// Update saves role and replaces its permissions if its version is still the one
+// in the database and returns a conflict error otherwise.
 func (dao *roleDao) Update(tx *db.Tx, role *Role, permissions []int32) error {
-	err := tx.Save(role).Error
+	err := updateVersioned(tx, "role", role.ID, role.Version, map[string]interface{}{
+		"name":        role.Name,
+		"description": role.Description,
+		"updated_by":  role.UpdatedBy,
+	})
+	if errutil.IsClientError(err) {
+		return err
+	}
+	if err == nil {
+		err = tx.First(role, role.ID).Error
+	}
 	if err != nil {
 		log.Error().
 			Int32("roleId", role.ID).
@@ -94,14 +162,108 @@ func (dao *roleDao) createRolePermissions(tx *db.Tx, roleID int32, permissions [
 	if len(permissions) == 0 {
 		return nil
 	}
-	rolePermissions := make([]RolePermission, len(permissions))
-	for i, perm := range permissions {
-		rolePermissions[i].RoleID = roleID
-		rolePermissions[i].PermissionID = perm
-		err := tx.Create(rolePermissions).Error
+	for _, perm := range permissions {
+		err := tx.Create(&RolePermission{RoleID: roleID, PermissionID: perm}).Error
 		if err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+// List returns all roles ordered by name.
+func (dao *roleDao) List(tx *db.Tx) ([]RoleSummary, error) {
+	roles := []RoleSummary{}
+	err := tx.Raw(`
+		SELECT r.*,
+		       (SELECT count(*) FROM user_role ur WHERE ur.role_id = r.id)       AS user_count,
+		       (SELECT count(*) FROM user_group_role ugr WHERE ugr.role_id = r.id) AS group_count
+		FROM role r
+		ORDER BY lower(r.name)`).Scan(&roles).Error
+	return roles, err
+}
+
+// CountAssignments returns the number of users and groups a role is assigned to directly.
+func (dao *roleDao) CountAssignments(tx *db.Tx, id int32) (users int, groups int, err error) {
+	err = tx.Raw(`
+		SELECT (SELECT count(*) FROM user_role WHERE role_id = ?),
+		       (SELECT count(*) FROM user_group_role WHERE role_id = ?)`, id, id).
+		Row().Scan(&users, &groups)
+	return users, groups, err
+}
+
+// ReassignRole assigns the role to to all users and groups which have the role
+// from, and removes from from them.
+func (dao *roleDao) ReassignRole(tx *db.Tx, from int32, to int32) error {
+	for _, table := range []string{"user_role", "user_group_role"} {
+		member := "user_id"
+		if table == "user_group_role" {
+			member = "group_id"
+		}
+		err := tx.Exec(`INSERT INTO `+table+` (`+member+`, role_id)
+			SELECT `+member+`, ? FROM `+table+` WHERE role_id = ?
+			ON CONFLICT DO NOTHING`, to, from).Error
+		if err != nil {
+			return errutil.Wrapf(err, "failed to reassign %s", table)
+		}
+		err = tx.Exec(`DELETE FROM `+table+` WHERE role_id = ?`, from).Error
+		if err != nil {
+			return errutil.Wrapf(err, "failed to remove role from %s", table)
+		}
+	}
+	return nil
+}
+
+// Delete deletes a role and its permissions. It fails if the role is still
+// assigned to users or groups.
+func (dao *roleDao) Delete(tx *db.Tx, id int32) error {
+	err := tx.Delete(&RolePermission{}, "role_id = ?", id).Error
+	if err != nil {
+		return errutil.Wrap(err, "failed to delete permissions of role")
+	}
+	return tx.Delete(&Role{}, "id = ?", id).Error
+}
+
+// ExistAll reports whether there is a role for each of the ids.
+func (dao *roleDao) ExistAll(tx *db.Tx, ids []int32) (bool, error) {
+	unique := make(map[int32]bool, len(ids))
+	for _, id := range ids {
+		unique[id] = true
+	}
+	if len(unique) == 0 {
+		return true, nil
+	}
+	count := 0
+	err := tx.Model(&Role{}).Where("id IN (?)", ids).Count(&count).Error
+	return count == len(unique), err
+}
+
+// FindIDsByUserID returns the ids of the roles assigned to a user directly, not through groups.
+func (dao *roleDao) FindIDsByUserID(tx *db.Tx, userID int64) ([]int32, error) {
+	roles := []int32{}
+	err := tx.Model(&UserRole{}).
+		Where("user_id = ?", userID).
+		Order("role_id").
+		Pluck("role_id", &roles).Error
+	return roles, err
+}
+
+// SetUserRoles replaces the roles assigned to a user directly.
+func (dao *roleDao) SetUserRoles(tx *db.Tx, userID int64, roles []int32) error {
+	err := tx.Delete(&UserRole{}, "user_id = ?", userID).Error
+	if err != nil {
+		return errutil.Wrap(err, "failed to delete existing roles of user")
+	}
+	assigned := make(map[int32]bool, len(roles))
+	for _, roleID := range roles {
+		if assigned[roleID] {
+			continue
+		}
+		assigned[roleID] = true
+		err = tx.Create(&UserRole{UserID: userID, RoleID: roleID}).Error
+		if err != nil {
+			return errutil.Wrap(err, "failed to assign role to user")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,5 @@
+package model
+
+// SchemaVersion is the latest migration in apps/db-migration/resources/migrations,
+// which the models are written against.
+const SchemaVersion = 10010
@@ -1,9 +1,52 @@
 package model
 
-import "time"
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/mmrath/gobase/golang/pkg/db"
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+)
 
 type AuditDetails struct {
 	UpdatedAt time.Time `json:"updatedAt,omitempty" db:"updated_at"`
 	UpdatedBy string    `json:"updatedBy,omitempty" db:"updated_by"`
 	Version   uint32    `json:"version,omitempty" db:"version"`
 }
+
+// updateVersioned updates the row of an audited table only if it still has the
+// given version, so that concurrent changes are not silently overwritten.
+// The version itself is incremented by the auto_set_audit_columns trigger.
+func updateVersioned(tx *db.Tx, table string, id interface{}, version uint32, fields map[string]interface{}) error {
+	result := tx.Table(table).
+		Where("id = ? AND version = ?", id, version).
+		Updates(fields)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errutil.NewConflict(table + " has been modified or deleted by someone else, reload and try again")
+	}
+	return nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// escapeLike escapes the wildcards of a LIKE pattern, so that s is matched literally.
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+func scanStrings(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+	var result []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		result = append(result, value)
+	}
+	return result, rows.Err()
+}
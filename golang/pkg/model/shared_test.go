@@ -0,0 +1,47 @@
+package model
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/mmrath/gobase/golang/pkg/db"
+)
+
+func TestUpdateVersioned(t *testing.T) {
+	setUp(t)
+	user := createUser(t)
+	stale := user
+
+	user.FirstName = "Updated"
+	runInTx(t, func(tx *db.Tx) error {
+		return NewUserDao().Update(tx, &user)
+	})
+	require.Equal(t, "Updated", user.FirstName)
+	require.True(t, user.Version > stale.Version, "the version is incremented")
+
+	stale.FirstName = "Overwritten"
+	err := testDB.RunInTx(context.Background(), func(tx *db.Tx) error {
+		return NewUserDao().Update(tx, &stale)
+	})
+	require.Equal(t, http.StatusConflict, statusOf(err))
+
+	err = testDB.RunInTx(context.Background(), func(tx *db.Tx) error {
+		return updateVersioned(tx, user.TableName(), int64(-1), user.Version, map[string]interface{}{"first_name": "Missing"})
+	})
+	require.Equal(t, http.StatusConflict, statusOf(err), "deleted rows are reported as conflicts")
+
+	var found User
+	runInTx(t, func(tx *db.Tx) (err error) {
+		found, err = NewUserDao().Find(tx, user.ID)
+		return err
+	})
+	require.Equal(t, "Updated", found.FirstName)
+	require.Equal(t, user.Version, found.Version)
+}
+
+func TestEscapeLike(t *testing.T) {
+	require.Equal(t, `100\% a\_b c\\d`, escapeLike(`100% a_b c\d`))
+}
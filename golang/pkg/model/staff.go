@@ -6,3 +6,13 @@ type Staff struct {
 	FirstName string `json:"firstName,omitempty"`
 	LastName  string `json:"lastName,omitempty"`
 }
+
+// NewStaff returns the staff view of a user account.
+func NewStaff(user User) Staff {
+	return Staff{
+		ID:        user.ID,
+		Email:     user.Email,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+	}
+}
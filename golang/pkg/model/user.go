@@ -1,6 +1,8 @@
 package model
 
 import (
+	"strings"
+
 	"github.com/google/uuid"
 	"github.com/mmrath/gobase/golang/pkg/db"
 )
@@ -8,15 +10,25 @@ import (
 type User struct {
 	AuditDetails
 
-	ID          int64     `json:"id,omitempty"`
-	UUID        uuid.UUID `json:"uuid,omitempty" gorm:"type:uuid;"`
-	FirstName   string    `json:"firstName,omitempty" sql:"default:null"`
-	LastName    string    `json:"lastName,omitempty" sql:"default:null"`
-	Email       string    `json:"email,omitempty" sql:"default:null"`
-	PhoneNumber string    `json:"phoneNumber,omitempty" sql:"default:null"`
-	Active      bool      `json:"active,omitempty"`
+	ID          int64       `json:"id,omitempty"`
+	UUID        uuid.UUID   `json:"uuid,omitempty" gorm:"type:uuid;"`
+	FirstName   string      `json:"firstName,omitempty" sql:"default:null"`
+	LastName    string      `json:"lastName,omitempty" sql:"default:null"`
+	Email       string      `json:"email,omitempty" sql:"default:null"`
+	PhoneNumber string      `json:"phoneNumber,omitempty" sql:"default:null"`
+	AccountType AccountType `json:"accountType"`
+	Active      bool        `json:"active,omitempty"`
 }
 
+// AccountType distinguishes customers, who sign up through clipo, from staff, who log in to oppo.
+type AccountType int32
+
+const (
+	// AccountTypeCustomer is also what accounts created before account types existed read as.
+	AccountTypeCustomer AccountType = 0
+	AccountTypeStaff    AccountType = 1
+)
+
 type UserProfile struct {
 	FirstName   string `json:"firstName,omitempty" sql:"default:null"`
 	LastName    string `json:"lastName,omitempty" sql:"default:null"`
@@ -56,12 +68,61 @@ type LoginRequest struct {
 }
 
 type CreateUserRequest struct {
-	FirstName   string  `json:"firstName,omitempty" validate:"required,aplha"`
-	LastName    string  `json:"lastName,omitempty" validate:"required,alpha"`
-	Email       string  `json:"email,omitempty" validate:"required,email"`
-	PhoneNumber string  `json:"phoneNumber,omitempty"`
-	Active      bool    `json:"active,omitempty"`
-	Roles       []int32 `json:"roles,omitempty"`
+	FirstName   string      `json:"firstName,omitempty" validate:"required,alpha,max=32"`
+	LastName    string      `json:"lastName,omitempty" validate:"required,alpha,max=32"`
+	Email       string      `json:"email,omitempty" validate:"required,email,max=254"`
+	PhoneNumber string      `json:"phoneNumber,omitempty"`
+	AccountType AccountType `json:"accountType" validate:"min=0,max=1"`
+	Active      bool        `json:"active,omitempty"`
+	Roles       []int32     `json:"roles,omitempty"`
+}
+
+// UpdateUserRequest changes a user. Version must be the version of the user the
+// changes are based on. Whether the user is active is changed by deactivating and
+// reactivating.
+type UpdateUserRequest struct {
+	FirstName   string      `json:"firstName,omitempty" validate:"required,alpha,max=32"`
+	LastName    string      `json:"lastName,omitempty" validate:"required,alpha,max=32"`
+	Email       string      `json:"email,omitempty" validate:"required,email,max=254"`
+	PhoneNumber string      `json:"phoneNumber,omitempty"`
+	AccountType AccountType `json:"accountType" validate:"min=0,max=1"`
+	Roles       []int32     `json:"roles"`
+	Version     uint32      `json:"version,omitempty"`
+}
+
+// UserAndRoles is a user with the ids of the roles assigned to it directly.
+type UserAndRoles struct {
+	User  User    `json:"user"`
+	Roles []int32 `json:"roles"`
+}
+
+// CreatedUser is a user created by an administrator. InvitationSent is false if
+// the invitation email could not be sent, in which case it can be sent again.
+type CreatedUser struct {
+	UserAndRoles
+	InvitationSent bool `json:"invitationSent"`
+}
+
+// UserFilter selects users in UserDao.List. Empty fields match all users.
+type UserFilter struct {
+	// Search matches the start of the email, first or last name, ignoring case.
+	Search      string
+	Active      *bool
+	AccountType *AccountType
+	// Sort is a column of UserSortColumns.
+	Sort       string
+	Descending bool
+	Offset     int
+	Limit      int
+}
+
+// UserSortColumns maps the fields users can be sorted by to their columns.
+var UserSortColumns = map[string]string{
+	"id":        "id",
+	"email":     "email",
+	"firstName": "first_name",
+	"lastName":  "last_name",
+	"updatedAt": "updated_at",
 }
 
 type RegisterAccountRequest struct {
@@ -85,6 +146,9 @@ type UserDao interface {
 	Update(tx *db.Tx, user *User) error
 	FindByEmail(tx *db.Tx, email string) (User, error)
 	ExistsByEmail(tx *db.Tx, email string) (bool, error)
+	List(tx *db.Tx, filter UserFilter) (users []User, total int, err error)
+	SetActive(tx *db.Tx, id int64, active bool) error
+	ExistAll(tx *db.Tx, ids []int64) (bool, error)
 }
 
 func (dao *userDao) Find(tx *db.Tx, id int64) (User, error) {
@@ -99,8 +163,22 @@ func (dao *userDao) Insert(tx *db.Tx, user *User) error {
 	return err
 }
 
+// Update saves user if its version is still the one in the database and
+// returns a conflict error otherwise. On success user is reloaded with the new version.
 func (dao *userDao) Update(tx *db.Tx, user *User) error {
-	return tx.Save(user).Error
+	err := updateVersioned(tx, user.TableName(), user.ID, user.Version, map[string]interface{}{
+		"first_name":   user.FirstName,
+		"last_name":    user.LastName,
+		"email":        user.Email,
+		"phone_number": user.PhoneNumber,
+		"account_type": user.AccountType,
+		"active":       user.Active,
+		"updated_by":   user.UpdatedBy,
+	})
+	if err != nil {
+		return err
+	}
+	return tx.First(user, user.ID).Error
 }
 
 func (dao *userDao) FindByEmail(tx *db.Tx, email string) (User, error) {
@@ -114,3 +192,57 @@ func (dao *userDao) ExistsByEmail(tx *db.Tx, email string) (bool, error) {
 	err := tx.Model(&User{}).Where("email = ?", email).Count(&count).Error
 	return count != 0, err
 }
+
+// List returns a page of the users matching filter and the number of all matching users.
+func (dao *userDao) List(tx *db.Tx, filter UserFilter) (users []User, total int, err error) {
+	query := tx.Model(&User{})
+	if filter.Search != "" {
+		pattern := escapeLike(strings.ToLower(filter.Search)) + "%"
+		query = query.Where("lower(email) LIKE ? OR lower(first_name) LIKE ? OR lower(last_name) LIKE ?",
+			pattern, pattern, pattern)
+	}
+	if filter.Active != nil {
+		query = query.Where("active = ?", *filter.Active)
+	}
+	if filter.AccountType != nil {
+		query = query.Where("account_type = ?", *filter.AccountType)
+	}
+
+	err = query.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	order := UserSortColumns[filter.Sort]
+	if order == "" {
+		order = "id"
+	}
+	if filter.Descending {
+		order += " DESC"
+	}
+	if order != "id" {
+		// keeps pages stable for users with equal values
+		order += ", id"
+	}
+
+	err = query.Order(order).Offset(filter.Offset).Limit(filter.Limit).Find(&users).Error
+	return users, total, err
+}
+
+func (dao *userDao) SetActive(tx *db.Tx, id int64, active bool) error {
+	return tx.Model(&User{ID: id}).UpdateColumn("active", active).Error
+}
+
+// ExistAll reports whether there is a user for each of the ids.
+func (dao *userDao) ExistAll(tx *db.Tx, ids []int64) (bool, error) {
+	unique := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		unique[id] = true
+	}
+	if len(unique) == 0 {
+		return true, nil
+	}
+	count := 0
+	err := tx.Model(&User{}).Where("id IN (?)", ids).Count(&count).Error
+	return count == len(unique), err
+}
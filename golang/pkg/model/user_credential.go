@@ -20,6 +20,13 @@ type UserCredential struct {
 	ResetKey               string    `json:"resetKey,omitempty" sql:"default:null"`
 	ResetKeyExpiresAt      time.Time `json:"resetKeyExpiresAt,omitempty"`
 	ResetAt                time.Time `json:"resetAt,omitempty"`
+	TOTPSecret             string    `json:"-" sql:"default:null"`
+	TOTPEnabled            bool      `json:"totpEnabled"`
+	TOTPLastUsedStep       int64     `json:"-" sql:"default:null"`
+	LoginKey               string    `json:"-" sql:"default:null"`
+	LoginCode              string    `json:"-" sql:"default:null"`
+	LoginKeyExpiresAt      time.Time `json:"-"`
+	LoginCodeAttempts      uint16    `json:"-"`
 	UpdatedAt              time.Time `json:"updatedAt,omitempty"`
 	Version                uint16    `json:"version,omitempty"`
 }
@@ -38,6 +45,14 @@ type UserCredentialDao interface {
 	ResetPassword(tx *db.Tx, id int64, newPassword string) error
 	ChangePassword(tx *db.Tx, id int64, newPassword string) error
 	ResetInvalidAttempts(tx *db.Tx, id int64) error
+	UpdateTOTPSecret(tx *db.Tx, id int64, secret string) error
+	EnableTOTP(tx *db.Tx, id int64, usedStep int64) error
+	DisableTOTP(tx *db.Tx, id int64) error
+	UpdateTOTPLastUsedStep(tx *db.Tx, id int64, usedStep int64) error
+	UpdateLoginKey(tx *db.Tx, id int64, loginKey string, loginCode string, expiresAt time.Time) error
+	FindByLoginKey(tx *db.Tx, loginKey string) (UserCredential, error)
+	IncrementLoginCodeAttempts(tx *db.Tx, id int64) error
+	ConsumeLoginKey(tx *db.Tx, id int64) error
 }
 
 func NewUserCredentialDao() UserCredentialDao {
@@ -125,3 +140,72 @@ func (dao *userCredentialDao) ResetInvalidAttempts(tx *db.Tx, id int64) error {
 		UpdateColumn("invalid_attempts", 0).Error
 	return err
 }
+
+// UpdateTOTPSecret stores the secret of a pending enrollment. It is not enforced until EnableTOTP.
+func (dao *userCredentialDao) UpdateTOTPSecret(tx *db.Tx, id int64, secret string) error {
+	return tx.Model(&UserCredential{ID: id}).
+		Updates(map[string]interface{}{
+			"totp_secret":         secret,
+			"totp_enabled":        false,
+			"totp_last_used_step": nil,
+		}).Error
+}
+
+func (dao *userCredentialDao) EnableTOTP(tx *db.Tx, id int64, usedStep int64) error {
+	return tx.Model(&UserCredential{ID: id}).
+		Updates(map[string]interface{}{
+			"totp_enabled":        true,
+			"totp_last_used_step": usedStep,
+		}).Error
+}
+
+func (dao *userCredentialDao) DisableTOTP(tx *db.Tx, id int64) error {
+	return tx.Model(&UserCredential{ID: id}).
+		Updates(map[string]interface{}{
+			"totp_secret":         nil,
+			"totp_enabled":        false,
+			"totp_last_used_step": nil,
+		}).Error
+}
+
+func (dao *userCredentialDao) UpdateTOTPLastUsedStep(tx *db.Tx, id int64, usedStep int64) error {
+	return tx.Model(&UserCredential{ID: id}).
+		UpdateColumn("totp_last_used_step", usedStep).Error
+}
+
+// UpdateLoginKey replaces the login key and code. The failed code attempts are
+// kept, so that requesting a new code does not allow more guesses; they are
+// reset when the user logs in with the key or a code.
+func (dao *userCredentialDao) UpdateLoginKey(tx *db.Tx, id int64, loginKey string, loginCode string, expiresAt time.Time) error {
+	return tx.Model(&UserCredential{ID: id}).
+		Updates(map[string]interface{}{
+			"login_key":            loginKey,
+			"login_code":           loginCode,
+			"login_key_expires_at": expiresAt,
+		}).Error
+}
+
+func (dao *userCredentialDao) FindByLoginKey(tx *db.Tx, loginKey string) (UserCredential, error) {
+	userCred := UserCredential{}
+	err := tx.Where("login_key = ?", loginKey).
+		First(&userCred).Error
+	return userCred, err
+}
+
+func (dao *userCredentialDao) IncrementLoginCodeAttempts(tx *db.Tx, id int64) error {
+	return tx.Model(&UserCredential{ID: id}).
+		UpdateColumn("login_code_attempts", gorm.Expr("login_code_attempts + ?", 1)).Error
+}
+
+// ConsumeLoginKey invalidates the login key and code. As they were delivered by
+// email, using them also proves the email address, which activates the account.
+func (dao *userCredentialDao) ConsumeLoginKey(tx *db.Tx, id int64) error {
+	return tx.Model(&UserCredential{ID: id}).
+		Updates(map[string]interface{}{
+			"login_key":            nil,
+			"login_code":           nil,
+			"login_key_expires_at": nil,
+			"login_code_attempts":  0,
+			"activated":            true,
+		}).Error
+}
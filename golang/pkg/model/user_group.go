@@ -0,0 +1,176 @@
+package model
+
+import (
+	"github.com/mmrath/gobase/golang/pkg/db"
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+)
+
+// UserGroup is a named set of users. The roles assigned to a group are granted to all its members.
+type UserGroup struct {
+	AuditDetails
+	ID          int32  `json:"id,omitempty"`
+	Name        string `json:"name,omitempty" sql:"default:null" validate:"required"`
+	Description string `json:"description,omitempty" sql:"default:null" validate:"required"`
+}
+
+type UserGroupUser struct {
+	GroupID int32 `json:"groupId,omitempty" validate:"required"`
+	UserID  int64 `json:"userId,omitempty" validate:"required"`
+}
+
+type UserGroupRole struct {
+	GroupID int32 `json:"groupId,omitempty" validate:"required"`
+	RoleID  int32 `json:"roleId,omitempty" validate:"required"`
+}
+
+// UserGroupAndRoles is a group with the ids of the roles assigned to it.
+type UserGroupAndRoles struct {
+	Group UserGroup `json:"group"`
+	Roles []int32   `json:"roles"`
+}
+
+// UserGroupSummary is a group with the number of its members.
+type UserGroupSummary struct {
+	UserGroup
+	MemberCount int `json:"memberCount"`
+}
+
+// UpdateMembersRequest adds and removes members of a group at once.
+type UpdateMembersRequest struct {
+	Add    []int64 `json:"add"`
+	Remove []int64 `json:"remove"`
+}
+
+type UserGroupDao interface {
+	Find(tx *db.Tx, id int32) (UserGroup, error)
+	List(tx *db.Tx) ([]UserGroupSummary, error)
+	ExistsByName(tx *db.Tx, name string) (bool, error)
+	Create(tx *db.Tx, group *UserGroup) error
+	Update(tx *db.Tx, group *UserGroup) error
+	Delete(tx *db.Tx, id int32) error
+	FindRoleIDs(tx *db.Tx, id int32) ([]int32, error)
+	SetRoles(tx *db.Tx, id int32, roles []int32) error
+	FindMembers(tx *db.Tx, id int32) ([]User, error)
+	AddMembers(tx *db.Tx, id int32, userIDs []int64) error
+	RemoveMembers(tx *db.Tx, id int32, userIDs []int64) error
+}
+
+type userGroupDao struct {
+}
+
+func NewUserGroupDao() UserGroupDao {
+	return &userGroupDao{}
+}
+
+func (dao *userGroupDao) Find(tx *db.Tx, id int32) (UserGroup, error) {
+	group := UserGroup{}
+	err := tx.First(&group, id).Error
+	return group, err
+}
+
+// List returns all groups ordered by name.
+func (dao *userGroupDao) List(tx *db.Tx) ([]UserGroupSummary, error) {
+	groups := []UserGroupSummary{}
+	err := tx.Raw(`
+		SELECT g.*,
+		       (SELECT count(*) FROM user_group_user ugu WHERE ugu.group_id = g.id) AS member_count
+		FROM user_group g
+		ORDER BY lower(g.name)`).Scan(&groups).Error
+	return groups, err
+}
+
+func (dao *userGroupDao) ExistsByName(tx *db.Tx, name string) (bool, error) {
+	count := 0
+	err := tx.Model(&UserGroup{}).Where("LOWER(name) = LOWER(?)", name).Count(&count).Error
+	return count != 0, err
+}
+
+func (dao *userGroupDao) Create(tx *db.Tx, group *UserGroup) error {
+	return tx.Model(group).Create(group).Error
+}
+
+// Update saves group if its version is still the one in the database and
+// returns a conflict error otherwise. On success group is reloaded with the new version.
+func (dao *userGroupDao) Update(tx *db.Tx, group *UserGroup) error {
+	err := updateVersioned(tx, "user_group", group.ID, group.Version, map[string]interface{}{
+		"name":        group.Name,
+		"description": group.Description,
+		"updated_by":  group.UpdatedBy,
+	})
+	if err != nil {
+		return err
+	}
+	return tx.First(group, group.ID).Error
+}
+
+// Delete deletes a group together with its memberships and role assignments.
+func (dao *userGroupDao) Delete(tx *db.Tx, id int32) error {
+	err := tx.Delete(&UserGroupUser{}, "group_id = ?", id).Error
+	if err != nil {
+		return errutil.Wrap(err, "failed to delete members of group")
+	}
+	err = tx.Delete(&UserGroupRole{}, "group_id = ?", id).Error
+	if err != nil {
+		return errutil.Wrap(err, "failed to delete roles of group")
+	}
+	return tx.Delete(&UserGroup{}, "id = ?", id).Error
+}
+
+func (dao *userGroupDao) FindRoleIDs(tx *db.Tx, id int32) ([]int32, error) {
+	roles := []int32{}
+	err := tx.Model(&UserGroupRole{}).
+		Where("group_id = ?", id).
+		Order("role_id").
+		Pluck("role_id", &roles).Error
+	return roles, err
+}
+
+// SetRoles replaces the roles assigned to a group.
+func (dao *userGroupDao) SetRoles(tx *db.Tx, id int32, roles []int32) error {
+	err := tx.Delete(&UserGroupRole{}, "group_id = ?", id).Error
+	if err != nil {
+		return errutil.Wrap(err, "failed to delete existing roles of group")
+	}
+	assigned := make(map[int32]bool, len(roles))
+	for _, roleID := range roles {
+		if assigned[roleID] {
+			continue
+		}
+		assigned[roleID] = true
+		err = tx.Create(&UserGroupRole{GroupID: id, RoleID: roleID}).Error
+		if err != nil {
+			return errutil.Wrap(err, "failed to assign role to group")
+		}
+	}
+	return nil
+}
+
+// FindMembers returns the users of a group ordered by email.
+func (dao *userGroupDao) FindMembers(tx *db.Tx, id int32) ([]User, error) {
+	users := []User{}
+	err := tx.Where("id IN (SELECT user_id FROM user_group_user WHERE group_id = ?)", id).
+		Order("email").
+		Find(&users).Error
+	return users, err
+}
+
+// AddMembers adds users to a group. Users which already are members are ignored.
+func (dao *userGroupDao) AddMembers(tx *db.Tx, id int32, userIDs []int64) error {
+	for _, userID := range userIDs {
+		err := tx.Exec(`INSERT INTO user_group_user (group_id, user_id) VALUES (?, ?)
+			ON CONFLICT DO NOTHING`, id, userID).Error
+		if err != nil {
+			return errutil.Wrap(err, "failed to add member to group")
+		}
+	}
+	return nil
+}
+
+// RemoveMembers removes users from a group. Users which are not members are ignored.
+func (dao *userGroupDao) RemoveMembers(tx *db.Tx, id int32, userIDs []int64) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	err := tx.Delete(&UserGroupUser{}, "group_id = ? AND user_id IN (?)", id, userIDs).Error
+	return errutil.Wrap(err, "failed to remove members from group")
+}
@@ -0,0 +1,110 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/mmrath/gobase/golang/pkg/db"
+)
+
+func createGroup(t *testing.T) UserGroup {
+	group := UserGroup{Name: uniqueName("group"), Description: "Test group"}
+	runInTx(t, func(tx *db.Tx) error {
+		return NewUserGroupDao().Create(tx, &group)
+	})
+	return group
+}
+
+func TestUserGroupMembers(t *testing.T) {
+	setUp(t)
+	dao := NewUserGroupDao()
+	group := createGroup(t)
+	first := createUser(t)
+	second := createUser(t)
+
+	runInTx(t, func(tx *db.Tx) error {
+		require.NoError(t, dao.AddMembers(tx, group.ID, []int64{first.ID, second.ID}))
+		// members are added once
+		require.NoError(t, dao.AddMembers(tx, group.ID, []int64{first.ID}))
+		members, err := dao.FindMembers(tx, group.ID)
+		require.NoError(t, err)
+		require.Len(t, members, 2)
+
+		require.NoError(t, dao.RemoveMembers(tx, group.ID, []int64{first.ID, -1}))
+		require.NoError(t, dao.RemoveMembers(tx, group.ID, nil))
+		members, err = dao.FindMembers(tx, group.ID)
+		require.NoError(t, err)
+		require.Len(t, members, 1)
+		require.Equal(t, second.ID, members[0].ID)
+
+		groups, err := dao.List(tx)
+		require.NoError(t, err)
+		for _, g := range groups {
+			if g.ID == group.ID {
+				require.Equal(t, 1, g.MemberCount)
+			}
+		}
+		return nil
+	})
+}
+
+func TestUserGroupRolesGrantPermissions(t *testing.T) {
+	setUp(t)
+	dao := NewUserGroupDao()
+	group := createGroup(t)
+	user := createUser(t)
+	admin := findRole(t, AdministratorRole)
+
+	runInTx(t, func(tx *db.Tx) error {
+		require.NoError(t, dao.SetRoles(tx, group.ID, []int32{admin.ID, admin.ID}))
+		roles, err := dao.FindRoleIDs(tx, group.ID)
+		require.NoError(t, err)
+		require.Equal(t, []int32{admin.ID}, roles)
+
+		require.NoError(t, dao.AddMembers(tx, group.ID, []int64{user.ID}))
+		names, err := NewRoleDao().FindNamesByUserID(tx, user.ID)
+		require.NoError(t, err)
+		require.Equal(t, []string{AdministratorRole}, names)
+		permissions, err := NewPermissionDao().FindNamesByUserID(tx, user.ID)
+		require.NoError(t, err)
+		require.Contains(t, permissions, "user:read")
+
+		// the group's roles are not assigned to the user directly
+		ids, err := NewRoleDao().FindIDsByUserID(tx, user.ID)
+		require.NoError(t, err)
+		require.Empty(t, ids)
+
+		require.NoError(t, dao.SetRoles(tx, group.ID, nil))
+		permissions, err = NewPermissionDao().FindNamesByUserID(tx, user.ID)
+		require.NoError(t, err)
+		require.Empty(t, permissions)
+		return nil
+	})
+}
+
+func TestUserGroupDelete(t *testing.T) {
+	setUp(t)
+	dao := NewUserGroupDao()
+	group := createGroup(t)
+	user := createUser(t)
+	admin := findRole(t, AdministratorRole)
+
+	runInTx(t, func(tx *db.Tx) error {
+		exists, err := dao.ExistsByName(tx, strings.ToUpper(group.Name))
+		require.NoError(t, err)
+		require.True(t, exists, "names are compared ignoring case")
+
+		require.NoError(t, dao.SetRoles(tx, group.ID, []int32{admin.ID}))
+		require.NoError(t, dao.AddMembers(tx, group.ID, []int64{user.ID}))
+		require.NoError(t, dao.Delete(tx, group.ID))
+
+		_, err = dao.Find(tx, group.ID)
+		require.True(t, db.IsNoDataFound(err))
+		permissions, err := NewPermissionDao().FindNamesByUserID(tx, user.ID)
+		require.NoError(t, err)
+		require.Empty(t, permissions)
+		return nil
+	})
+}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"time"
+
+	"github.com/mmrath/gobase/golang/pkg/db"
+)
+
+// UserRecoveryCode is a one-time code which replaces the second factor at login.
+// Only the hash of the code is stored.
+type UserRecoveryCode struct {
+	ID        int64
+	CreatedAt time.Time
+	UserID    int64
+	CodeHash  string
+	UsedAt    *time.Time
+}
+
+type UserRecoveryCodeDao interface {
+	ReplaceAll(tx *db.Tx, userID int64, codeHashes []string) error
+	Use(tx *db.Tx, userID int64, codeHash string) (bool, error)
+	CountUnused(tx *db.Tx, userID int64) (int, error)
+	DeleteAll(tx *db.Tx, userID int64) error
+}
+
+type userRecoveryCodeDao struct {
+}
+
+func NewUserRecoveryCodeDao() UserRecoveryCodeDao {
+	return &userRecoveryCodeDao{}
+}
+
+// ReplaceAll invalidates all existing codes of the user and stores the new ones.
+func (dao *userRecoveryCodeDao) ReplaceAll(tx *db.Tx, userID int64, codeHashes []string) error {
+	err := dao.DeleteAll(tx, userID)
+	if err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		err = tx.Create(&UserRecoveryCode{UserID: userID, CodeHash: hash}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Use marks an unused code as used and reports whether there was one.
+func (dao *userRecoveryCodeDao) Use(tx *db.Tx, userID int64, codeHash string) (bool, error) {
+	result := tx.Model(&UserRecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Updates(map[string]interface{}{"used_at": time.Now()})
+	return result.RowsAffected == 1, result.Error
+}
+
+func (dao *userRecoveryCodeDao) CountUnused(tx *db.Tx, userID int64) (int, error) {
+	count := 0
+	err := tx.Model(&UserRecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	return count, err
+}
+
+func (dao *userRecoveryCodeDao) DeleteAll(tx *db.Tx, userID int64) error {
+	return tx.Delete(&UserRecoveryCode{}, "user_id = ?", userID).Error
+}
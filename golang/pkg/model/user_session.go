@@ -0,0 +1,94 @@
+package model
+
+import (
+	"time"
+
+	"github.com/mmrath/gobase/golang/pkg/db"
+)
+
+// UserSession is a persisted http session. Only the hash of the session token is stored.
+type UserSession struct {
+	ID             int64     `json:"id"`
+	Token          string    `json:"-"`
+	UserID         int64     `json:"userId,omitempty" sql:"default:null"`
+	Data           []byte    `json:"-"`
+	CreatedAt      time.Time `json:"createdAt"`
+	LastAccessedAt time.Time `json:"lastAccessedAt"`
+	ExpiresAt      time.Time `json:"expiresAt"`
+	IPAddress      string    `json:"ipAddress,omitempty" sql:"default:null"`
+	UserAgent      string    `json:"userAgent,omitempty" sql:"default:null"`
+}
+
+type UserSessionDao interface {
+	Insert(tx *db.Tx, session *UserSession) error
+	FindByToken(tx *db.Tx, tokenHash string) (UserSession, error)
+	FindActive(tx *db.Tx, userID int64, idleSince time.Time) ([]UserSession, error)
+	UpdateData(tx *db.Tx, id int64, userID int64, data []byte) error
+	Touch(tx *db.Tx, id int64) error
+	Delete(tx *db.Tx, id int64) (bool, error)
+	DeleteByToken(tx *db.Tx, tokenHash string) error
+	DeleteByUserID(tx *db.Tx, userID int64) (int64, error)
+	DeleteExpired(tx *db.Tx, idleSince time.Time) (int64, error)
+}
+
+type userSessionDao struct {
+}
+
+func NewUserSessionDao() UserSessionDao {
+	return &userSessionDao{}
+}
+
+func (dao *userSessionDao) Insert(tx *db.Tx, session *UserSession) error {
+	return tx.Create(session).Error
+}
+
+func (dao *userSessionDao) FindByToken(tx *db.Tx, tokenHash string) (UserSession, error) {
+	session := UserSession{}
+	err := tx.Where("token = ?", tokenHash).First(&session).Error
+	return session, err
+}
+
+// FindActive returns sessions which have neither expired nor been idle since idleSince,
+// most recently used first. A userID of 0 returns the sessions of all users.
+func (dao *userSessionDao) FindActive(tx *db.Tx, userID int64, idleSince time.Time) ([]UserSession, error) {
+	var sessions []UserSession
+	q := tx.Where("expires_at > ? AND last_accessed_at > ?", time.Now(), idleSince)
+	if userID != 0 {
+		q = q.Where("user_id = ?", userID)
+	}
+	err := q.Order("last_accessed_at DESC").Find(&sessions).Error
+	return sessions, err
+}
+
+func (dao *userSessionDao) UpdateData(tx *db.Tx, id int64, userID int64, data []byte) error {
+	var user interface{}
+	if userID != 0 {
+		user = userID
+	}
+	return tx.Model(&UserSession{ID: id}).
+		Updates(map[string]interface{}{"user_id": user, "data": data, "last_accessed_at": time.Now()}).Error
+}
+
+func (dao *userSessionDao) Touch(tx *db.Tx, id int64) error {
+	return tx.Model(&UserSession{ID: id}).
+		Updates(map[string]interface{}{"last_accessed_at": time.Now()}).Error
+}
+
+func (dao *userSessionDao) Delete(tx *db.Tx, id int64) (bool, error) {
+	result := tx.Delete(&UserSession{}, "id = ?", id)
+	return result.RowsAffected != 0, result.Error
+}
+
+func (dao *userSessionDao) DeleteByToken(tx *db.Tx, tokenHash string) error {
+	return tx.Delete(&UserSession{}, "token = ?", tokenHash).Error
+}
+
+func (dao *userSessionDao) DeleteByUserID(tx *db.Tx, userID int64) (int64, error) {
+	result := tx.Delete(&UserSession{}, "user_id = ?", userID)
+	return result.RowsAffected, result.Error
+}
+
+func (dao *userSessionDao) DeleteExpired(tx *db.Tx, idleSince time.Time) (int64, error) {
+	result := tx.Delete(&UserSession{}, "expires_at <= ? OR last_accessed_at <= ?", time.Now(), idleSince)
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,114 @@
+// Package otp implements time-based one-time passwords as defined by RFC 6238,
+// compatible with common authenticator apps.
+package otp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mmrath/gobase/golang/pkg/crypto"
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+)
+
+const (
+	// Period is the number of seconds a code is valid for.
+	Period = 30
+	// Digits is the length of a code.
+	Digits = 6
+	// Skew is the number of periods before and after the current one which are
+	// also accepted, to allow for clock drift between server and device.
+	Skew = 1
+
+	secretLength = 20
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a random base32 encoded secret.
+func GenerateSecret() (string, error) {
+	secret, err := crypto.GenerateRandomBytes(secretLength)
+	if err != nil {
+		return "", errutil.Wrap(err, "failed to generate otp secret")
+	}
+	return encoding.EncodeToString(secret), nil
+}
+
+// URI returns the otpauth URI of a secret, usually shown as QR code to enroll an authenticator app.
+func URI(issuer, account, secret string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(Digits))
+	params.Set("period", fmt.Sprint(Period))
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: params.Encode(),
+	}
+	return u.String()
+}
+
+// TimeStep returns the RFC 6238 counter for t.
+func TimeStep(t time.Time) int64 {
+	return t.Unix() / Period
+}
+
+// Code returns the code of a base32 encoded secret for the given time step.
+func Code(secret string, step int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil {
+		return "", errutil.Wrap(err, "invalid otp secret")
+	}
+	return hotp(key, uint64(step), Digits), nil
+}
+
+// Validate checks code against the secret at time t and returns the time step it
+// matched. Callers must reject steps at or before the last accepted one so that a
+// code cannot be used twice.
+func Validate(secret, code string, t time.Time) (step int64, ok bool, err error) {
+	code = strings.TrimSpace(code)
+	if len(code) != Digits {
+		return 0, false, nil
+	}
+
+	current := TimeStep(t)
+	for i := -Skew; i <= Skew; i++ {
+		expected, err := Code(secret, current+int64(i))
+		if err != nil {
+			return 0, false, err
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return current + int64(i), true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// hotp implements RFC 4226. SHA1 is what RFC 6238 and authenticator apps use.
+func hotp(key []byte, counter uint64, digits int) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+
+	mac := hmac.New(sha1.New, key)
+	_, _ = mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
@@ -0,0 +1,42 @@
+package otp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test vectors of RFC 6238 appendix B for SHA1.
+func TestHOTPMatchesRFC6238(t *testing.T) {
+	key := []byte("12345678901234567890")
+	vectors := map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	}
+	for unix, expected := range vectors {
+		require.Equal(t, expected, hotp(key, uint64(TimeStep(time.Unix(unix, 0))), 8), "time %d", unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+
+	now := time.Unix(1600000000, 0)
+	code, err := Code(secret, TimeStep(now.Add(-Period*time.Second)))
+	require.NoError(t, err)
+
+	step, ok, err := Validate(secret, code, now)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, TimeStep(now)-1, step)
+
+	_, ok, err = Validate(secret, code, now.Add(2*Period*time.Second))
+	require.NoError(t, err)
+	require.False(t, ok)
+}
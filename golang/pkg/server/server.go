@@ -0,0 +1,219 @@
+// Package server runs an HTTP server until the process is asked to stop and
+// then shuts it down gracefully.
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+)
+
+type Config struct {
+	ReadTimeout       time.Duration `default:"15s" split_words:"true" yaml:"readTimeout"`
+	ReadHeaderTimeout time.Duration `default:"5s" split_words:"true" yaml:"readHeaderTimeout"`
+	WriteTimeout      time.Duration `default:"30s" split_words:"true" yaml:"writeTimeout"`
+	IdleTimeout       time.Duration `default:"120s" split_words:"true" yaml:"idleTimeout"`
+	// DrainDelay is how long the server keeps serving after it stopped being ready,
+	// so load balancers stop sending requests before the listener is closed.
+	DrainDelay time.Duration `default:"5s" split_words:"true" yaml:"drainDelay"`
+	// ShutdownTimeout bounds the time for in-flight requests, background workers
+	// and the shutdown hooks to finish.
+	ShutdownTimeout time.Duration `default:"30s" split_words:"true" yaml:"shutdownTimeout"`
+	// TLSCertFile and TLSKeyFile enable TLS if both are set.
+	TLSCertFile string `split_words:"true" yaml:"tlsCertFile"`
+	TLSKeyFile  string `split_words:"true" yaml:"tlsKeyFile"`
+}
+
+type hook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Server is an http.Server which shuts down gracefully on SIGINT or SIGTERM.
+// Shutting down, it first stops being ready and waits for the drain delay, then
+// stops accepting connections and waits for in-flight requests, then stops the
+// background workers and finally runs the shutdown hooks in reverse order of
+// registration, all within the shutdown timeout.
+type Server struct {
+	httpServer *http.Server
+	cfg        Config
+	ready      int32
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+	hooks   []hook
+}
+
+// New returns a server of handler listening on port, which may also be a host:port.
+func New(port string, handler http.Handler, cfg Config) *Server {
+	addr := port
+	if !strings.Contains(port, ":") {
+		addr = ":" + port
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{
+		httpServer: &http.Server{
+			Addr:              addr,
+			Handler:           handler,
+			ReadTimeout:       cfg.ReadTimeout,
+			ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+			WriteTimeout:      cfg.WriteTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+		},
+		cfg:    cfg,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Handler returns the handler of the server.
+func (s *Server) Handler() http.Handler {
+	return s.httpServer.Handler
+}
+
+// Ready reports whether the server accepts requests and is not shutting down.
+func (s *Server) Ready() bool {
+	return atomic.LoadInt32(&s.ready) == 1
+}
+
+// Go runs a background worker, whose context is cancelled once the server
+// stopped serving requests. The server waits for the worker to return.
+func (s *Server) Go(worker func(ctx context.Context)) {
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		worker(s.ctx)
+	}()
+}
+
+// OnShutdown registers a hook, like closing the database, which is run after
+// the requests and the background workers finished.
+func (s *Server) OnShutdown(name string, fn func(ctx context.Context) error) {
+	s.hooks = append(s.hooks, hook{name: name, fn: fn})
+}
+
+// Run listens on the address of the server and serves until ctx is done or the
+// process receives SIGINT or SIGTERM.
+func (s *Server) Run(ctx context.Context) error {
+	if (s.cfg.TLSCertFile == "") != (s.cfg.TLSKeyFile == "") {
+		return errutil.New("both or none of the TLS certificate and key files must be set")
+	}
+	ln, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return errutil.Wrapf(err, "failed to listen on %s", s.httpServer.Addr)
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve is Run on a listener which is already open.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	ctx, stop := signalContext(ctx)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if s.cfg.TLSCertFile != "" {
+			serveErr <- s.httpServer.ServeTLS(ln, s.cfg.TLSCertFile, s.cfg.TLSKeyFile)
+		} else {
+			serveErr <- s.httpServer.Serve(ln)
+		}
+	}()
+	atomic.StoreInt32(&s.ready, 1)
+	log.Info().Str("address", ln.Addr().String()).Bool("tls", s.cfg.TLSCertFile != "").Msg("server started")
+
+	var err error
+	select {
+	case err = <-serveErr:
+		atomic.StoreInt32(&s.ready, 0)
+		err = errutil.Wrap(err, "server failed")
+		log.Error().Err(err).Msg("server shutting down")
+	case <-ctx.Done():
+		log.Info().Msg("server shutting down")
+		atomic.StoreInt32(&s.ready, 0)
+		s.drain()
+	}
+
+	if shutdownErr := s.shutdown(); err == nil {
+		err = shutdownErr
+	}
+	if err == nil {
+		log.Info().Msg("server stopped gracefully")
+	}
+	return err
+}
+
+func (s *Server) drain() {
+	if s.cfg.DrainDelay <= 0 {
+		return
+	}
+	log.Info().Dur("delay", s.cfg.DrainDelay).Msg("draining before closing the listener")
+	time.Sleep(s.cfg.DrainDelay)
+}
+
+func (s *Server) shutdown() error {
+	ctx := context.Background()
+	if s.cfg.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.cfg.ShutdownTimeout)
+		defer cancel()
+	}
+
+	err := s.httpServer.Shutdown(ctx)
+	if err != nil {
+		err = errutil.Wrap(err, "failed to finish requests")
+	}
+
+	s.cancel()
+	workersDone := make(chan struct{})
+	go func() {
+		s.workers.Wait()
+		close(workersDone)
+	}()
+	select {
+	case <-workersDone:
+	case <-ctx.Done():
+		log.Warn().Msg("background workers did not stop in time")
+	}
+
+	for i := len(s.hooks) - 1; i >= 0; i-- {
+		h := s.hooks[i]
+		if hookErr := h.fn(ctx); hookErr != nil {
+			log.Error().Err(hookErr).Str("hook", h.name).Msg("shutdown hook failed")
+			if err == nil {
+				err = errutil.Wrapf(hookErr, "shutdown hook %s failed", h.name)
+			}
+		}
+	}
+	return err
+}
+
+// signalContext returns a context which is done when ctx is or on SIGINT or SIGTERM.
+func signalContext(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			log.Info().Str("signal", sig.String()).Msg("received signal")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGracefulShutdown(t *testing.T) {
+	requestStarted := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(requestStarted)
+		time.Sleep(100 * time.Millisecond)
+		_, _ = w.Write([]byte("done"))
+	})
+
+	srv := New("0", handler, Config{DrainDelay: 10 * time.Millisecond, ShutdownTimeout: 5 * time.Second})
+
+	var mu sync.Mutex
+	var events []string
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+	srv.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		record("worker")
+	})
+	srv.OnShutdown("first", func(ctx context.Context) error {
+		record("first")
+		return nil
+	})
+	srv.OnShutdown("second", func(ctx context.Context) error {
+		record("second")
+		return nil
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(ctx, ln) }()
+
+	response := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			response <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		response <- string(body)
+	}()
+
+	<-requestStarted
+	require.True(t, srv.Ready())
+	cancel()
+
+	require.Equal(t, "done", <-response)
+	require.NoError(t, <-served)
+	require.False(t, srv.Ready())
+	require.Equal(t, []string{"worker", "second", "first"}, events)
+}
+
+func TestRunRequiresCertAndKey(t *testing.T) {
+	srv := New("0", http.NotFoundHandler(), Config{TLSCertFile: "cert.pem"})
+	require.Error(t, srv.Run(context.Background()))
+}
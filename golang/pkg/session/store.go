@@ -0,0 +1,345 @@
+// Package session implements a gorilla sessions.Store which keeps session data in Postgres.
+package session
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/gob"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/rs/zerolog/log"
+
+	"github.com/mmrath/gobase/golang/pkg/config"
+	"github.com/mmrath/gobase/golang/pkg/crypto"
+	"github.com/mmrath/gobase/golang/pkg/db"
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+	"github.com/mmrath/gobase/golang/pkg/model"
+)
+
+// UserIDKey is the session value holding the id of the logged in user. It is
+// stored alongside the session so that sessions can be listed and terminated per user.
+const UserIDKey = "userId"
+
+// touchInterval limits how often the last access time is written for sessions which are only read.
+const touchInterval = time.Minute
+
+type Config struct {
+	// AuthKeys and EncryptionKeys are base64 encoded and paired by position. The
+	// first pair protects new cookies while all pairs are accepted, so keys can be
+	// rotated by prepending a new pair and dropping the oldest later on.
+	AuthKeys        []config.Secret `yaml:"authKeys" split_words:"true"`
+	EncryptionKeys  []config.Secret `yaml:"encryptionKeys" split_words:"true"`
+	IdleTimeout     time.Duration   `yaml:"idleTimeout" default:"30m" split_words:"true"`
+	AbsoluteTimeout time.Duration   `yaml:"absoluteTimeout" default:"12h" split_words:"true"`
+	SweepInterval   time.Duration   `yaml:"sweepInterval" default:"10m" split_words:"true"`
+	Secure          bool            `yaml:"secure" default:"true"`
+	// AllowRandomKeys protects cookies with random keys if none are configured.
+	// It is meant for development only, as sessions do not survive a restart and
+	// are not accepted by other replicas.
+	AllowRandomKeys bool `yaml:"allowRandomKeys" split_words:"true"`
+}
+
+// Store keeps session values in the user_session table. The cookie only
+// carries the signed and encrypted session token.
+type Store struct {
+	db              *db.DB
+	dao             model.UserSessionDao
+	codecs          []securecookie.Codec
+	options         sessions.Options
+	idleTimeout     time.Duration
+	absoluteTimeout time.Duration
+	sweepInterval   time.Duration
+}
+
+func NewStore(database *db.DB, cfg Config) (*Store, error) {
+	keyPairs, err := keyPairs(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		db:     database,
+		dao:    model.NewUserSessionDao(),
+		codecs: securecookie.CodecsFromPairs(keyPairs...),
+		options: sessions.Options{
+			Path:     "/",
+			MaxAge:   int(cfg.AbsoluteTimeout.Seconds()),
+			Secure:   cfg.Secure,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		},
+		idleTimeout:     cfg.IdleTimeout,
+		absoluteTimeout: cfg.AbsoluteTimeout,
+		sweepInterval:   cfg.SweepInterval,
+	}, nil
+}
+
+func keyPairs(cfg Config) ([][]byte, error) {
+	if len(cfg.AuthKeys) == 0 {
+		if !cfg.AllowRandomKeys {
+			return nil, errutil.New("no session keys configured")
+		}
+		log.Warn().Msg("no session keys configured, generating random keys")
+		return [][]byte{securecookie.GenerateRandomKey(64), securecookie.GenerateRandomKey(32)}, nil
+	}
+	if len(cfg.EncryptionKeys) != 0 && len(cfg.EncryptionKeys) != len(cfg.AuthKeys) {
+		return nil, errutil.New("number of session encryption keys must match the number of auth keys")
+	}
+
+	var pairs [][]byte
+	for i, encoded := range cfg.AuthKeys {
+		authKey, err := base64.StdEncoding.DecodeString(encoded.Value())
+		if err != nil {
+			return nil, errutil.Wrapf(err, "invalid session auth key %d", i)
+		}
+		var encryptionKey []byte
+		if len(cfg.EncryptionKeys) != 0 {
+			encryptionKey, err = base64.StdEncoding.DecodeString(cfg.EncryptionKeys[i].Value())
+			if err != nil {
+				return nil, errutil.Wrapf(err, "invalid session encryption key %d", i)
+			}
+		}
+		pairs = append(pairs, authKey, encryptionKey)
+	}
+	return pairs, nil
+}
+
+// Get returns the session cached for the request, loading it on first use.
+func (s *Store) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New loads the session referenced by the request's cookie. A new session is
+// returned if there is no cookie or the session has expired or been terminated.
+func (s *Store) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	options := s.options
+	session.Options = &options
+	session.IsNew = true
+
+	c, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+
+	var token string
+	if err := securecookie.DecodeMulti(name, c.Value, &token, s.codecs...); err != nil {
+		return session, errutil.Wrap(err, "failed to decode session cookie")
+	}
+
+	found, err := s.load(r.Context(), session, token)
+	if err != nil {
+		return session, err
+	}
+	session.IsNew = !found
+	return session, nil
+}
+
+func (s *Store) load(ctx context.Context, session *sessions.Session, token string) (found bool, err error) {
+	tokenHash, err := crypto.SHA256([]byte(token))
+	if err != nil {
+		return false, errutil.Wrap(err, "failed to hash session token")
+	}
+
+	err = s.db.RunInTx(ctx, func(tx *db.Tx) error {
+		stored, err := s.dao.FindByToken(tx, tokenHash)
+		if err != nil {
+			if db.IsNoDataFound(err) {
+				return nil
+			}
+			return errutil.Wrap(err, "failed to find session")
+		}
+
+		now := time.Now()
+		if !now.Before(stored.ExpiresAt) || !now.Before(stored.LastAccessedAt.Add(s.idleTimeout)) {
+			_, err = s.dao.Delete(tx, stored.ID)
+			return errutil.Wrap(err, "failed to delete expired session")
+		}
+
+		if err = gob.NewDecoder(bytes.NewReader(stored.Data)).Decode(&session.Values); err != nil {
+			return errutil.Wrap(err, "failed to decode session data")
+		}
+
+		if now.Sub(stored.LastAccessedAt) > touchInterval {
+			if err = s.dao.Touch(tx, stored.ID); err != nil {
+				return errutil.Wrap(err, "failed to update session access time")
+			}
+		}
+
+		session.ID = token
+		found = true
+		return nil
+	})
+	return found, err
+}
+
+// Save persists the session and writes its cookie. A negative MaxAge deletes the session.
+func (s *Store) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if err := s.delete(r.Context(), session); err != nil {
+			return err
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(session.Values); err != nil {
+		return errutil.Wrap(err, "failed to encode session data")
+	}
+	userID, _ := session.Values[UserIDKey].(int64)
+
+	if session.ID == "" {
+		if err := s.insert(r, session, userID, data.Bytes()); err != nil {
+			return err
+		}
+	} else if err := s.update(r.Context(), session, userID, data.Bytes()); err != nil {
+		return err
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.codecs...)
+	if err != nil {
+		return errutil.Wrap(err, "failed to encode session cookie")
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+func (s *Store) insert(r *http.Request, session *sessions.Session, userID int64, data []byte) error {
+	tokenBytes, err := crypto.GenerateRandomBytes(32)
+	if err != nil {
+		return errutil.Wrap(err, "failed to generate session token")
+	}
+	token := base64.RawURLEncoding.EncodeToString(tokenBytes)
+	tokenHash, err := crypto.SHA256([]byte(token))
+	if err != nil {
+		return errutil.Wrap(err, "failed to hash session token")
+	}
+
+	now := time.Now()
+	err = s.db.RunInTx(r.Context(), func(tx *db.Tx) error {
+		return s.dao.Insert(tx, &model.UserSession{
+			Token:          tokenHash,
+			UserID:         userID,
+			Data:           data,
+			CreatedAt:      now,
+			LastAccessedAt: now,
+			ExpiresAt:      now.Add(s.absoluteTimeout),
+			IPAddress:      r.RemoteAddr,
+			UserAgent:      r.UserAgent(),
+		})
+	})
+	if err != nil {
+		return errutil.Wrap(err, "failed to insert session")
+	}
+	session.ID = token
+	return nil
+}
+
+func (s *Store) update(ctx context.Context, session *sessions.Session, userID int64, data []byte) error {
+	tokenHash, err := crypto.SHA256([]byte(session.ID))
+	if err != nil {
+		return errutil.Wrap(err, "failed to hash session token")
+	}
+	return s.db.RunInTx(ctx, func(tx *db.Tx) error {
+		stored, err := s.dao.FindByToken(tx, tokenHash)
+		if err != nil {
+			if db.IsNoDataFound(err) {
+				return errutil.NewUnauthorized("session has been terminated")
+			}
+			return errutil.Wrap(err, "failed to find session")
+		}
+		return s.dao.UpdateData(tx, stored.ID, userID, data)
+	})
+}
+
+func (s *Store) delete(ctx context.Context, session *sessions.Session) error {
+	if session.ID == "" {
+		return nil
+	}
+	tokenHash, err := crypto.SHA256([]byte(session.ID))
+	if err != nil {
+		return errutil.Wrap(err, "failed to hash session token")
+	}
+	return s.db.RunInTx(ctx, func(tx *db.Tx) error {
+		return s.dao.DeleteByToken(tx, tokenHash)
+	})
+}
+
+// Renew deletes the stored session and gives it a new token on the next Save,
+// keeping its values. Call it on login to prevent session fixation.
+func (s *Store) Renew(r *http.Request, session *sessions.Session) error {
+	if err := s.delete(r.Context(), session); err != nil {
+		return err
+	}
+	session.ID = ""
+	session.IsNew = true
+	return nil
+}
+
+// List returns the active sessions of a user, or of all users if userID is 0.
+func (s *Store) List(ctx context.Context, userID int64) (sessions []model.UserSession, err error) {
+	err = s.db.RunInTx(ctx, func(tx *db.Tx) error {
+		sessions, err = s.dao.FindActive(tx, userID, time.Now().Add(-s.idleTimeout))
+		return err
+	})
+	return sessions, err
+}
+
+// Terminate deletes the session with the given id. The next request using it gets a new, empty session.
+func (s *Store) Terminate(ctx context.Context, id int64) error {
+	return s.db.RunInTx(ctx, func(tx *db.Tx) error {
+		deleted, err := s.dao.Delete(tx, id)
+		if err != nil {
+			return errutil.Wrap(err, "failed to delete session")
+		}
+		if !deleted {
+			return errutil.NewBadRequest("session does not exist")
+		}
+		return nil
+	})
+}
+
+// TerminateUser deletes all sessions of a user.
+func (s *Store) TerminateUser(ctx context.Context, userID int64) (count int64, err error) {
+	err = s.db.RunInTx(ctx, func(tx *db.Tx) error {
+		count, err = s.dao.DeleteByUserID(tx, userID)
+		return err
+	})
+	return count, err
+}
+
+// Sweep deletes expired and idle sessions.
+func (s *Store) Sweep(ctx context.Context) (count int64, err error) {
+	err = s.db.RunInTx(ctx, func(tx *db.Tx) error {
+		count, err = s.dao.DeleteExpired(tx, time.Now().Add(-s.idleTimeout))
+		return err
+	})
+	return count, err
+}
+
+// RunSweeper sweeps sessions periodically until ctx is done.
+func (s *Store) RunSweeper(ctx context.Context) {
+	ticker := time.NewTicker(s.sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			count, err := s.Sweep(ctx)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to sweep expired sessions")
+				continue
+			}
+			if count > 0 {
+				log.Info().Int64("count", count).Msg("swept expired sessions")
+			}
+		}
+	}
+}
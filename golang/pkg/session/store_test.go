@@ -0,0 +1,289 @@
+package session
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mmrath/gobase/golang/pkg/config"
+	"github.com/mmrath/gobase/golang/pkg/crypto"
+	"github.com/mmrath/gobase/golang/pkg/db"
+	"github.com/mmrath/gobase/golang/pkg/testutil"
+)
+
+const cookieName = "session"
+
+// testDB is nil if the test database is not running, in which case the tests are skipped.
+var testDB *db.DB
+
+func TestMain(m *testing.M) {
+	var err error
+	testDB, err = testutil.OpenDB()
+	if err != nil {
+		fmt.Printf("skipping session store tests, database is not available: %v\n", err)
+		testDB = nil
+	}
+	os.Exit(m.Run())
+}
+
+func setUp(t *testing.T) {
+	if testDB == nil {
+		t.Skip("database is not available")
+	}
+}
+
+func randomKey(size int) config.Secret {
+	return config.Secret(base64.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(size)))
+}
+
+func testConfig() Config {
+	return Config{
+		AuthKeys:        []config.Secret{randomKey(64)},
+		EncryptionKeys:  []config.Secret{randomKey(32)},
+		IdleTimeout:     time.Hour,
+		AbsoluteTimeout: 2 * time.Hour,
+		SweepInterval:   time.Hour,
+	}
+}
+
+func newStore(t *testing.T, cfg Config) *Store {
+	store, err := NewStore(testDB, cfg)
+	require.NoError(t, err)
+	return store
+}
+
+func newRequest(cookie *http.Cookie) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	return r
+}
+
+// save saves session and returns the cookie written for it.
+func save(t *testing.T, store *Store, session *sessions.Session) *http.Cookie {
+	w := httptest.NewRecorder()
+	require.NoError(t, store.Save(newRequest(nil), w, session))
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	return cookies[0]
+}
+
+// newSession saves a new session holding value and returns it with its cookie.
+func newSession(t *testing.T, store *Store, value string) (*sessions.Session, *http.Cookie) {
+	session, err := store.New(newRequest(nil), cookieName)
+	require.NoError(t, err)
+	require.True(t, session.IsNew)
+	session.Values["value"] = value
+	return session, save(t, store, session)
+}
+
+func load(t *testing.T, store *Store, cookie *http.Cookie) *sessions.Session {
+	session, err := store.New(newRequest(cookie), cookieName)
+	require.NoError(t, err)
+	return session
+}
+
+// updateStored sets columns of the stored session with the given token.
+func updateStored(t *testing.T, token string, set string, values ...interface{}) {
+	tokenHash, err := crypto.SHA256([]byte(token))
+	require.NoError(t, err)
+	err = testDB.RunInTx(context.Background(), func(tx *db.Tx) error {
+		return tx.Exec("UPDATE user_session SET "+set+" WHERE token = ?", append(values, tokenHash)...).Error
+	})
+	require.NoError(t, err)
+}
+
+func isStored(t *testing.T, token string) bool {
+	tokenHash, err := crypto.SHA256([]byte(token))
+	require.NoError(t, err)
+	var count int
+	err = testDB.RunInTx(context.Background(), func(tx *db.Tx) error {
+		return tx.Raw("SELECT count(*) FROM user_session WHERE token = ?", tokenHash).Row().Scan(&count)
+	})
+	require.NoError(t, err)
+	return count != 0
+}
+
+func TestNewStoreRequiresKeys(t *testing.T) {
+	_, err := NewStore(nil, Config{})
+	require.Error(t, err)
+
+	_, err = NewStore(nil, Config{AllowRandomKeys: true})
+	require.NoError(t, err)
+
+	_, err = NewStore(nil, Config{
+		AuthKeys:       []config.Secret{randomKey(64), randomKey(64)},
+		EncryptionKeys: []config.Secret{randomKey(32)},
+	})
+	require.Error(t, err)
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	setUp(t)
+	store := newStore(t, testConfig())
+
+	saved, cookie := newSession(t, store, "saved")
+	require.True(t, cookie.HttpOnly)
+	require.NotContains(t, cookie.Value, saved.ID, "the cookie is encrypted")
+
+	loaded := load(t, store, cookie)
+	require.False(t, loaded.IsNew)
+	require.Equal(t, saved.ID, loaded.ID)
+	require.Equal(t, "saved", loaded.Values["value"])
+
+	loaded.Values["value"] = "updated"
+	save(t, store, loaded)
+	require.Equal(t, "updated", load(t, store, cookie).Values["value"])
+}
+
+func TestIdleTimeout(t *testing.T) {
+	setUp(t)
+	store := newStore(t, testConfig())
+
+	saved, cookie := newSession(t, store, "idle")
+	updateStored(t, saved.ID, "last_accessed_at = ?", time.Now().Add(-61*time.Minute))
+
+	loaded := load(t, store, cookie)
+	require.True(t, loaded.IsNew)
+	require.Empty(t, loaded.Values)
+	require.False(t, isStored(t, saved.ID), "idle sessions are deleted when used")
+}
+
+func TestAbsoluteTimeout(t *testing.T) {
+	setUp(t)
+	store := newStore(t, testConfig())
+
+	saved, cookie := newSession(t, store, "expired")
+	// a session in use still expires
+	updateStored(t, saved.ID, "expires_at = ?", time.Now().Add(-time.Second))
+
+	loaded := load(t, store, cookie)
+	require.True(t, loaded.IsNew)
+	require.False(t, isStored(t, saved.ID))
+}
+
+func TestKeyRotation(t *testing.T) {
+	setUp(t)
+	oldCfg := testConfig()
+	oldStore := newStore(t, oldCfg)
+	saved, oldCookie := newSession(t, oldStore, "rotated")
+
+	// the new pair is prepended, the old one still accepted
+	rotatedCfg := testConfig()
+	rotatedCfg.AuthKeys = append(rotatedCfg.AuthKeys, oldCfg.AuthKeys...)
+	rotatedCfg.EncryptionKeys = append(rotatedCfg.EncryptionKeys, oldCfg.EncryptionKeys...)
+	rotatedStore := newStore(t, rotatedCfg)
+
+	loaded := load(t, rotatedStore, oldCookie)
+	require.False(t, loaded.IsNew)
+	require.Equal(t, "rotated", loaded.Values["value"])
+	newCookie := save(t, rotatedStore, loaded)
+
+	// once the old pair is dropped, cookies re-issued with the new pair keep working
+	newCfg := rotatedCfg
+	newCfg.AuthKeys = rotatedCfg.AuthKeys[:1]
+	newCfg.EncryptionKeys = rotatedCfg.EncryptionKeys[:1]
+	currentStore := newStore(t, newCfg)
+	require.Equal(t, saved.ID, load(t, currentStore, newCookie).ID)
+
+	_, err := currentStore.New(newRequest(oldCookie), cookieName)
+	require.Error(t, err)
+	_, err = oldStore.New(newRequest(newCookie), cookieName)
+	require.Error(t, err)
+}
+
+func TestRenew(t *testing.T) {
+	setUp(t)
+	store := newStore(t, testConfig())
+
+	session, oldCookie := newSession(t, store, "renewed")
+	oldToken := session.ID
+
+	require.NoError(t, store.Renew(newRequest(oldCookie), session))
+	require.True(t, session.IsNew)
+	require.False(t, isStored(t, oldToken))
+
+	newCookie := save(t, store, session)
+	require.NotEqual(t, oldToken, session.ID)
+	require.Equal(t, "renewed", load(t, store, newCookie).Values["value"])
+	require.True(t, load(t, store, oldCookie).IsNew, "the old token no longer works")
+}
+
+func TestTerminate(t *testing.T) {
+	setUp(t)
+	store := newStore(t, testConfig())
+
+	saved, cookie := newSession(t, store, "terminated")
+	tokenHash, err := crypto.SHA256([]byte(saved.ID))
+	require.NoError(t, err)
+	var id int64
+	err = testDB.RunInTx(context.Background(), func(tx *db.Tx) error {
+		return tx.Raw("SELECT id FROM user_session WHERE token = ?", tokenHash).Row().Scan(&id)
+	})
+	require.NoError(t, err)
+
+	active, err := store.List(context.Background(), 0)
+	require.NoError(t, err)
+	var listed bool
+	for _, s := range active {
+		listed = listed || s.ID == id
+	}
+	require.True(t, listed)
+
+	require.NoError(t, store.Terminate(context.Background(), id))
+	require.True(t, load(t, store, cookie).IsNew)
+	require.Error(t, store.Terminate(context.Background(), id))
+}
+
+func TestSweep(t *testing.T) {
+	setUp(t)
+	store := newStore(t, testConfig())
+
+	idle, _ := newSession(t, store, "idle")
+	updateStored(t, idle.ID, "last_accessed_at = ?", time.Now().Add(-61*time.Minute))
+	expired, _ := newSession(t, store, "expired")
+	updateStored(t, expired.ID, "expires_at = ?", time.Now().Add(-time.Second))
+	active, _ := newSession(t, store, "active")
+
+	count, err := store.Sweep(context.Background())
+	require.NoError(t, err)
+	require.True(t, count >= 2)
+	require.False(t, isStored(t, idle.ID))
+	require.False(t, isStored(t, expired.ID))
+	require.True(t, isStored(t, active.ID))
+}
+
+func TestRunSweeper(t *testing.T) {
+	setUp(t)
+	cfg := testConfig()
+	cfg.SweepInterval = 10 * time.Millisecond
+	store := newStore(t, cfg)
+
+	expired, _ := newSession(t, store, "expired")
+	updateStored(t, expired.ID, "expires_at = ?", time.Now().Add(-time.Second))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		store.RunSweeper(ctx)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool { return !isStored(t, expired.ID) }, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sweeper did not stop when its context was done")
+	}
+}
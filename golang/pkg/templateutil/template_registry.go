@@ -1,6 +1,7 @@
 package templateutil
 
 import (
+	"context"
 	"html/template"
 	"io"
 	"io/ioutil"
@@ -8,7 +9,10 @@ import (
 	"path/filepath"
 	"strings"
 
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/mmrath/gobase/golang/pkg/errutil"
+	"github.com/mmrath/gobase/golang/pkg/tracing"
 
 	"github.com/rs/zerolog/log"
 )
@@ -17,7 +21,9 @@ type Registry struct {
 	templates *template.Template
 }
 
-func (t *Registry) Render(w io.Writer, name string, data interface{}) error {
+func (t *Registry) Render(ctx context.Context, w io.Writer, name string, data interface{}) (err error) {
+	_, span := tracing.Start(ctx, "template.render", trace.WithAttributes(tracing.TemplateKey.String(name)))
+	defer func() { tracing.End(span, err) }()
 
 	log.Info().Str("name", name).Msg("trying to render template")
 
@@ -45,11 +51,10 @@ func findAndParseTemplates(rootDir string, funcMap template.FuncMap) (*template.
 	root := template.New("")
 
 	err := filepath.Walk(cleanRoot, func(path string, info os.FileInfo, e1 error) error {
+		if e1 != nil {
+			return e1
+		}
 		if !info.IsDir() && strings.HasSuffix(path, ".html") {
-			if e1 != nil {
-				return e1
-			}
-
 			b, e2 := ioutil.ReadFile(path)
 			if e2 != nil {
 				return e2
@@ -68,7 +73,7 @@ func findAndParseTemplates(rootDir string, funcMap template.FuncMap) (*template.
 	return root, err
 }
 
-func (t *Registry) RenderHTTP(w io.Writer, templateName string, data interface{}) error {
-	err := t.Render(w, templateName, data)
+func (t *Registry) RenderHTTP(ctx context.Context, w io.Writer, templateName string, data interface{}) error {
+	err := t.Render(ctx, w, templateName, data)
 	return err
 }
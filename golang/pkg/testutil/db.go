@@ -0,0 +1,31 @@
+package testutil
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/mmrath/gobase/golang/pkg/db"
+)
+
+// OpenDB opens the database of the e2e test environment as db_migration, which
+// may change any table. It fails if the database is not running, in which case
+// the tests using it should be skipped.
+func OpenDB() (*db.DB, error) {
+	portPrefix := os.Getenv("E2E_TEST_PORT_PREFIX")
+	if portPrefix == "" {
+		portPrefix = "40"
+	}
+	port, err := strconv.Atoi(portPrefix + "32")
+	if err != nil {
+		return nil, err
+	}
+
+	return db.Open(db.Config{
+		Host:     "localhost",
+		Port:     port,
+		Username: "db_migration",
+		Password: "s3cr3t_3",
+		Name:     "devdb",
+		SSLMode:  "disable",
+	})
+}
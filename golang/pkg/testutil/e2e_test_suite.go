@@ -50,6 +50,8 @@ func (s *TestSuite) SetTestEnv() {
 	os.Setenv("SMTP_PORT", fmt.Sprintf("%s13", portPrefix))
 	os.Setenv("SMTP_FROM", "test@localhost")
 
+	os.Setenv("JWT_ALLOW_RANDOM_KEY", "true")
+
 	dbURL := os.Getenv("DB_URL")
 
 	if dbURL == "" {
@@ -99,6 +101,8 @@ func cleanDB(db *sql.DB) {
 		"TRUNCATE TABLE user_role CASCADE",
 		"TRUNCATE TABLE role CASCADE",
 		"TRUNCATE TABLE user_credential CASCADE",
+		"TRUNCATE TABLE auth_token CASCADE",
+		"TRUNCATE TABLE user_session CASCADE",
 		"TRUNCATE TABLE permission CASCADE",
 		"TRUNCATE TABLE user_account CASCADE",
 		"TRUNCATE TABLE notification CASCADE",
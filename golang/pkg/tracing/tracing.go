@@ -0,0 +1,161 @@
+// Package tracing records OpenTelemetry traces of requests, transactions and
+// emails and propagates the W3C trace context between services.
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpgrpc"
+	"go.opentelemetry.io/otel/exporters/stdout"
+	"go.opentelemetry.io/otel/propagation"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/mmrath/gobase/golang/pkg/errutil"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// TemplateKey records the name of a rendered template.
+const TemplateKey = attribute.Key("template.name")
+
+// instrumentationName names the tracer of all spans started by this module.
+const instrumentationName = "github.com/mmrath/gobase/golang"
+
+type Config struct {
+	// Exporter is where spans are sent: none, otlp or stdout.
+	Exporter string `default:"none" yaml:"exporter"`
+	// Endpoint is the host:port of the OTLP gRPC collector.
+	Endpoint string `default:"localhost:4317" yaml:"endpoint"`
+	// Insecure disables TLS to the OTLP collector.
+	Insecure bool `yaml:"insecure"`
+	// File is where the stdout exporter appends spans, standard output if empty.
+	File string `yaml:"file"`
+	// SampleRatio is the fraction of new traces which are recorded. Requests of
+	// a sampled trace of another service are always recorded.
+	SampleRatio float64 `default:"1" split_words:"true" yaml:"sampleRatio"`
+}
+
+// Setup installs the global tracer provider exporting the spans of serviceName
+// as configured, and the W3C trace context propagator. The returned function
+// flushes the remaining spans and must be called on shutdown.
+func Setup(serviceName string, cfg Config) (shutdown func(ctx context.Context) error, err error) {
+	otel.SetErrorHandler(errorHandler{})
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var closer io.Closer
+	switch cfg.Exporter {
+	case ExporterNone, "":
+		return func(ctx context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		opts := []otlpgrpc.Option{otlpgrpc.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlpgrpc.WithInsecure())
+		}
+		exporter, err = otlp.NewExporter(context.Background(), otlpgrpc.NewDriver(opts...))
+		if err != nil {
+			return nil, errutil.Wrapf(err, "failed to create otlp exporter for %s", cfg.Endpoint)
+		}
+	case ExporterStdout:
+		var w io.Writer = os.Stdout
+		if cfg.File != "" {
+			f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+			if err != nil {
+				return nil, errutil.Wrapf(err, "failed to open trace file %s", cfg.File)
+			}
+			w, closer = f, f
+		}
+		exporter, err = stdout.NewExporter(stdout.WithWriter(w), stdout.WithoutMetricExport())
+		if err != nil {
+			return nil, errutil.Wrap(err, "failed to create stdout exporter")
+		}
+	default:
+		return nil, errutil.Errorf("unknown trace exporter %s", cfg.Exporter)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+		sdktrace.WithResource(sdkresource.NewWithAttributes(semconv.ServiceNameKey.String(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := errutil.Wrap(provider.Shutdown(ctx), "failed to flush spans")
+		if closer != nil {
+			if closeErr := closer.Close(); err == nil {
+				err = errutil.Wrap(closeErr, "failed to close trace file")
+			}
+		}
+		return err
+	}, nil
+}
+
+// errorHandler logs errors of exporting spans. The SDK also reports nil errors,
+// which are ignored.
+type errorHandler struct{}
+
+func (errorHandler) Handle(err error) {
+	if err != nil {
+		log.Error().Err(err).Msg("tracing failed")
+	}
+}
+
+// Start starts a span which is a child of the span in ctx, if any.
+func Start(ctx context.Context, name string, opts ...trace.SpanOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// End ends span, recording err if it is not nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Middleware continues the trace of the W3C traceparent header of a request, or
+// starts a new one, in a server span named after the chi route pattern.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := Start(ctx, "HTTP "+r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest("", "", r)...),
+		)
+		defer span.End()
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		// the route is only known once the request was routed
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			span.SetName(r.Method + " " + rctx.RoutePattern())
+			span.SetAttributes(semconv.HTTPRouteKey.String(rctx.RoutePattern()))
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(status)...)
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(status))
+	})
+}
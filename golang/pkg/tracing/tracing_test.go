@@ -0,0 +1,69 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddlewareContinuesTrace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestMiddlewareContinuesTrace")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "traces.json")
+
+	shutdown, err := Setup("test", Config{Exporter: ExporterStdout, File: file, SampleRatio: 1})
+	require.NoError(t, err)
+
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, span := Start(r.Context(), "load user")
+		End(span, nil)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	require.NoError(t, shutdown(context.Background()))
+
+	data, err := ioutil.ReadFile(file)
+	require.NoError(t, err)
+	var spans []exportedSpan
+	require.NoError(t, json.Unmarshal(data, &spans))
+	require.Len(t, spans, 2)
+
+	child, server := spans[0], spans[1]
+	require.Equal(t, "GET /users/{id}", server.Name)
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext.TraceID)
+	require.Equal(t, "00f067aa0ba902b7", server.Parent.SpanID)
+	require.Equal(t, "load user", child.Name)
+	require.Equal(t, server.SpanContext.SpanID, child.Parent.SpanID)
+}
+
+type exportedSpan struct {
+	Name        string
+	SpanContext spanContext
+	Parent      spanContext
+}
+
+type spanContext struct {
+	TraceID string
+	SpanID  string
+}
+
+func TestSetupRejectsUnknownExporter(t *testing.T) {
+	_, err := Setup("test", Config{Exporter: "zipkin"})
+	require.EqualError(t, err, "unknown trace exporter zipkin")
+}